@@ -0,0 +1,147 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"bench/counter"
+	"bench/parameter"
+)
+
+// Misbehaving clients of LoadChaos. Each of them talks to a random target host over a raw
+// connection and leaves it broken. Nothing the app does to them is an error, but the app must keep
+// serving the other clients, which is verified right after.
+var chaosActions = []struct {
+	name string
+	f    func(ctx context.Context, conn net.Conn) error
+}{
+	{"abort-response", chaosAbortResponse},
+	{"half-body", chaosHalfBody},
+	{"slow-body", chaosSlowBody},
+	{"reset", chaosReset},
+}
+
+// Misbehaves as a client, then checks that the app still responds.
+// Counted as chaos|<action> and never scored.
+func LoadChaos(ctx context.Context, state *State) error {
+	action := chaosActions[rand.Intn(len(chaosActions))]
+
+	actx, cancel := context.WithTimeout(ctx, parameter.ChaosTimeout)
+	conn, err := dialChaos(actx)
+	if err == nil {
+		err = action.f(actx, conn)
+		conn.Close()
+	}
+	cancel()
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		// the app may refuse misbehaving clients as it likes
+		log.Println("debug: chaos", action.name, err)
+	}
+	counter.Inc(counter.Key{Name: "chaos", Labels: counter.Labels("action", action.name)})
+
+	checker := NewChecker()
+	return checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               "/api/events",
+		ExpectedStatusCode: 200,
+		Description:        "異常な振る舞いをするクライアントがいてもイベント一覧が取得できること",
+	})
+}
+
+// Dials a random target host through dialTarget, with TLS for https targets
+func dialChaos(ctx context.Context) (net.Conn, error) {
+	u, err := url.Parse(GetRandomTargetURL())
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialTarget(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return conn, nil
+}
+
+func chaosRequestHeader(method, path string, contentLength int) string {
+	h := fmt.Sprintf("%s %s HTTP/1.1\r\nHost: %s\r\nUser-Agent: %s\r\n", method, path, TorbAppHost, UserAgent)
+	if contentLength >= 0 {
+		h += fmt.Sprintf("Content-Type: application/json\r\nContent-Length: %d\r\n", contentLength)
+	}
+	return h + "\r\n"
+}
+
+// Closes the connection after the first bytes of the response
+func chaosAbortResponse(ctx context.Context, conn net.Conn) error {
+	if _, err := io.WriteString(conn, chaosRequestHeader("GET", "/", -1)); err != nil {
+		return err
+	}
+	_, err := bufio.NewReader(conn).Peek(1)
+	return err
+}
+
+// Sends the half of the declared body and closes the connection
+func chaosHalfBody(ctx context.Context, conn net.Conn) error {
+	body := `{"nickname":"chaos","login_name":"chaos","password":"chaos"}`
+	_, err := io.WriteString(conn, chaosRequestHeader("POST", "/api/users", len(body))+body[:len(body)/2])
+	return err
+}
+
+// Sends the body a byte at a time (slowloris) until ChaosSlowBodyDuration passes
+func chaosSlowBody(ctx context.Context, conn net.Conn) error {
+	body := strings.Repeat(" ", 1024)
+	if _, err := io.WriteString(conn, chaosRequestHeader("POST", "/api/actions/login", len(body))); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(parameter.ChaosSlowBodyInterval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(parameter.ChaosSlowBodyDuration)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+		if _, err := io.WriteString(conn, " "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sends a part of the request headers and resets the connection (TCP RST), also under TLS
+func chaosReset(ctx context.Context, conn net.Conn) error {
+	header := chaosRequestHeader("GET", "/", -1)
+	if _, err := io.WriteString(conn, header[:len(header)/2]); err != nil {
+		return err
+	}
+	raw := conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		raw = tlsConn.NetConn()
+	}
+	if tcpConn, ok := raw.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	return raw.Close()
+}
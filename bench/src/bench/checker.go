@@ -2,6 +2,7 @@ package bench
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -12,9 +13,11 @@ import (
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -25,42 +28,120 @@ import (
 	"bench/urlcache"
 )
 
-const TorbAppHost = "torb.example.com"
+// Host header of every request, overridable with -app-host for apps behind name-based virtual hosts
+var TorbAppHost = "torb.example.com"
+
+const SessionCookieName = "torb_session"
+
+// Sent on every request so that contestants can find a failed request in their access logs
+const RequestIDHeader = "X-Bench-Request-ID"
 
 var (
 	RedirectAttemptedError = fmt.Errorf("redirect attempted")
-	RequestTimeoutError    = fmt.Errorf("リクエストがタイムアウトしました")
+	RequestTimeoutError    = error(messageError("リクエストがタイムアウトしました"))
 	UserAgent              = "isucon8q-benchmarker"
 	GetTimeout             = parameter.GetTimeout
 	PostTimeout            = parameter.PostTimeout
 	DeleteTimeout          = parameter.DeleteTimeout
+	StaticTimeout          = parameter.StaticTimeout
+	ReportTimeout          = parameter.ReportTimeout
 	InitializeTimeout      = parameter.InitializeTimeout
 	SlowThreshold          = parameter.SlowThreshold
+	SlowThresholds         = parameter.SlowThresholds
 	MaxCheckerRequest      = parameter.MaxCheckerRequest
 	DebugMode              = false
 )
 
 var (
-	checkerMtx          sync.Mutex
-	checkerErrorGuard   bool
-	checkerErrors       []*CheckerError
-	checkerLastSlowPath string
-	checkerLastSlowTime time.Time
+	checkerMtx        sync.Mutex
+	checkerErrorGuard bool
+	checkerErrors     []*CheckerError
 
-	targetHosts     []string
+	targetHosts     []string // host:port
+	targetSchemes   []string
+	hostWeights     []float64
 	requestCount    []int
+	hostLastErrorAt []time.Time
+	hostEvicted     []bool
+	roundRobinNext  int
 	requestCountMtx sync.Mutex
 
 	checkerRequestCounter int32 = 0
+
+	// Request IDs are <benchRunID>-<sequence>, unique across benchmark runs
+	benchRunID          = strconv.FormatInt(time.Now().UnixNano(), 36)
+	benchRequestCounter uint64
+
+	inFlightRequests int64 // sent and not finished reading the response
 )
 
-func SetTargetHosts(target []string) {
+// Sets the target hosts. Each host is either host:port, a URL (e.g. "https://app.example.com") or
+// a unix domain socket (e.g. "unix:/var/run/torb.sock"), and may have a weight for the weighted
+// strategy (e.g. "10.0.0.1=2"). Unix domain sockets are addressed as unix-socket-<n>:80.
+func SetTargetHosts(target []string) error {
+	hosts := make([]string, 0, len(target))
+	schemes := make([]string, 0, len(target))
+	sockets := map[string]string{}
+	weights := make([]float64, 0, len(target))
+	for _, t := range target {
+		host, weight := t, 1.0
+		if i := strings.LastIndex(t, "="); i >= 0 {
+			w, err := strconv.ParseFloat(t[i+1:], 64)
+			if err != nil || w < 0 {
+				return fmt.Errorf("invalid weight of remote %q", t)
+			}
+			host, weight = t[:i], w
+		}
+		scheme, host, err := parseTarget(host)
+		if err != nil {
+			return err
+		}
+		if scheme == "unix" {
+			path := host
+			scheme, host = "http", fmt.Sprintf("unix-socket-%d:80", len(sockets))
+			sockets[host] = path
+		}
+		hosts = append(hosts, host)
+		schemes = append(schemes, scheme)
+		weights = append(weights, weight)
+	}
+
 	checkerMtx.Lock()
 	defer checkerMtx.Unlock()
-	targetHosts = target
+	targetHosts = hosts
+	targetSchemes = schemes
+	unixSockets = sockets
+
+	requestCountMtx.Lock()
+	defer requestCountMtx.Unlock()
+	hostWeights = weights
 	requestCount = make([]int, len(targetHosts))
+	hostLastErrorAt = make([]time.Time, len(targetHosts))
+	hostEvicted = make([]bool, len(targetHosts))
+	return nil
+}
+
+// HostStrategy decides which target host each request is sent to.
+//
+//	least-conn   the host with the fewest in-flight requests (default)
+//	random       uniformly random
+//	round-robin  in turn
+//	weighted     randomly in proportion to the weights of -remotes host=weight
+//	least-error  the host whose last error (network error or 5xx) is the oldest
+//	sticky       the same host for all requests of a virtual user
+var HostStrategy = "least-conn"
+
+func SetHostStrategy(strategy string) error {
+	switch strategy {
+	case "least-conn", "random", "round-robin", "weighted", "least-error", "sticky":
+		HostStrategy = strategy
+		return nil
+	}
+	return fmt.Errorf("invalid host strategy %q", strategy)
 }
 
+type stickyHostKey struct{}
+
 func GetTargetHosts() []string {
 	checkerMtx.Lock()
 	defer checkerMtx.Unlock()
@@ -68,11 +149,62 @@ func GetTargetHosts() []string {
 	return targetHosts
 }
 
-func GetRandomTargetHost() string {
+// Returns scheme://host:port of the target hosts, in the same order as GetTargetHosts
+func GetTargetURLs() []string {
+	checkerMtx.Lock()
+	defer checkerMtx.Unlock()
+
+	urls := make([]string, len(targetHosts))
+	for i, host := range targetHosts {
+		urls[i] = targetSchemes[i] + "://" + host
+	}
+	return urls
+}
+
+func GetRandomTargetURL() string {
 	checkerMtx.Lock()
 	defer checkerMtx.Unlock()
 
-	return targetHosts[rand.Intn(len(targetHosts))]
+	i := rand.Intn(len(targetHosts))
+	return targetSchemes[i] + "://" + targetHosts[i]
+}
+
+// Parses a remote given as host:port or as a URL, and returns its scheme and host:port.
+// The port of a URL defaults to the one of its scheme. Returns "unix" and the path for unix:<path>.
+func parseTarget(s string) (scheme, host string, err error) {
+	if strings.HasPrefix(s, "unix:") {
+		path := strings.TrimPrefix(s, "unix:")
+		if path == "" {
+			return "", "", fmt.Errorf("invalid remote %q: socket path is missing", s)
+		}
+		return "unix", path, nil
+	}
+	if !strings.Contains(s, "://") {
+		if s == "" {
+			return "", "", fmt.Errorf("empty remote")
+		}
+		return "http", s, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid remote %q: %v", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", fmt.Errorf("invalid remote %q: scheme must be http or https", s)
+	}
+	if u.Hostname() == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return "", "", fmt.Errorf("invalid remote %q: only scheme, host and port are allowed", s)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
 }
 
 func decRequestCount(i int) {
@@ -81,36 +213,109 @@ func decRequestCount(i int) {
 	requestCount[i]--
 }
 
-func getFreeHostId() int {
+func getFreeHostId(req *http.Request) int {
 	requestCountMtx.Lock()
 	defer requestCountMtx.Unlock()
-	i := rand.Intn(len(requestCount))
-	for j, cnt := range requestCount {
-		if requestCount[i] > cnt {
-			i = j
+
+	// Evicted hosts are skipped unless all hosts are evicted
+	hosts := make([]int, 0, len(requestCount))
+	for j := range requestCount {
+		if !hostEvicted[j] {
+			hosts = append(hosts, j)
+		}
+	}
+	if len(hosts) == 0 {
+		for j := range requestCount {
+			hosts = append(hosts, j)
+		}
+	}
+
+	i := hosts[rand.Intn(len(hosts))]
+	switch HostStrategy {
+	case "random":
+	case "round-robin":
+		i = hosts[roundRobinNext%len(hosts)]
+		roundRobinNext++
+	case "weighted":
+		var sum float64
+		for _, j := range hosts {
+			sum += hostWeights[j]
+		}
+		r := rand.Float64() * sum
+		for _, j := range hosts {
+			if r < hostWeights[j] {
+				i = j
+				break
+			}
+			r -= hostWeights[j]
+		}
+	case "least-error":
+		for _, j := range hosts {
+			if hostLastErrorAt[j].Before(hostLastErrorAt[i]) {
+				i = j
+			}
+		}
+	case "sticky":
+		if v, ok := req.Context().Value(stickyHostKey{}).(int); ok {
+			i = hosts[v%len(hosts)]
+		}
+	default:
+		for _, j := range hosts {
+			if requestCount[i] > requestCount[j] {
+				i = j
+			}
 		}
 	}
 	requestCount[i]++
 	return i
 }
 
+func markHostError(i int) {
+	requestCountMtx.Lock()
+	defer requestCountMtx.Unlock()
+	hostLastErrorAt[i] = time.Now()
+}
+
+// Evicted hosts do not receive requests until they are re-added
+func SetHostEvicted(i int, evicted bool) {
+	requestCountMtx.Lock()
+	defer requestCountMtx.Unlock()
+	hostEvicted[i] = evicted
+}
+
 type CheckerTransport struct {
 	t *http.Transport
 }
 
 func (ct *CheckerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	i := getFreeHostId()
+	i := getFreeHostId(req)
 	defer decRequestCount(i)
 
-	host := req.URL.Host
-	req.URL.Host = GetTargetHosts()[i]
+	host, scheme := req.URL.Host, req.URL.Scheme
+	checkerMtx.Lock()
+	req.URL.Host, req.URL.Scheme = targetHosts[i], targetSchemes[i]
+	checkerMtx.Unlock()
+	setTargetHost(req.Context(), req.URL.Host)
 
 	if DebugMode {
 		log.Println("RT", req.Header.Get("X-Request-ID"), req.Method, req.URL.String(), req.Header)
 	}
 
+	var body []byte
+	recording := isRecording()
+	if recording {
+		body = copyRequestBody(req)
+	}
+	startedAt := time.Now()
 	res, err := ct.t.RoundTrip(req)
-	req.URL.Host = host
+	req.URL.Host, req.URL.Scheme = host, scheme
+	if recording {
+		recordRequest(req, body, startedAt, res)
+	}
+
+	if err != nil || 500 <= res.StatusCode {
+		markHostError(i)
+	}
 
 	return res, err
 }
@@ -118,24 +323,87 @@ func (ct *CheckerTransport) RoundTrip(req *http.Request) (*http.Response, error)
 var (
 	transport = &CheckerTransport{
 		&http.Transport{
-			MaxIdleConnsPerHost: 65536,
+			Proxy:               proxyFor,
+			DialContext:         dialTarget,
+			MaxIdleConns:        parameter.MaxIdleConns,
+			MaxIdleConnsPerHost: parameter.MaxIdleConnsPerHost,
+			MaxConnsPerHost:     parameter.MaxConnsPerHost,
+			IdleConnTimeout:     parameter.IdleConnTimeout,
+			// Checker.Play decodes gzip by itself to account the transferred bytes and to detect broken gzip
+			DisableCompression: true,
 		},
 	}
 )
 
-func updateLastSlowPath(path string) {
-	checkerMtx.Lock()
-	defer checkerMtx.Unlock()
+// Applies the connection pool parameters to the shared transport. Call before any request.
+func ConfigureConnPool() {
+	transport.t.MaxIdleConns = parameter.MaxIdleConns
+	transport.t.MaxIdleConnsPerHost = parameter.MaxIdleConnsPerHost
+	transport.t.MaxConnsPerHost = parameter.MaxConnsPerHost
+	transport.t.IdleConnTimeout = parameter.IdleConnTimeout
+}
 
-	checkerLastSlowPath = path
-	checkerLastSlowTime = time.Now()
+// Marks the request slow when it is not stopped within d after start
+type slowTimer struct {
+	mu      sync.Mutex
+	d       time.Duration
+	f       func()
+	t       *time.Timer
+	stopped bool
 }
 
-func GetLastSlowPath() (path string, t time.Time) {
-	checkerMtx.Lock()
-	defer checkerMtx.Unlock()
+func (s *slowTimer) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped && s.t == nil {
+		s.t = time.AfterFunc(s.d, s.f)
+	}
+}
 
-	return checkerLastSlowPath, checkerLastSlowTime
+func (s *slowTimer) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.t != nil {
+		s.t.Stop()
+	}
+}
+
+// SetSlowThresholds overrides the slow path threshold of paths which start with the prefix.
+//
+//	<prefix>=<d>,...  e.g. /admin/api/reports/=5s,/api/events/=2s
+//
+// The longest prefix wins and paths matching no prefix use SlowThreshold.
+func SetSlowThresholds(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, s := range strings.Split(spec, ",") {
+		i := strings.LastIndex(s, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid slow threshold %q", s)
+		}
+		d, err := time.ParseDuration(s[i+1:])
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid slow threshold %q", s)
+		}
+		SlowThresholds[s[:i]] = d
+	}
+	return nil
+}
+
+// Returns the slow threshold of the path, which may be a normalized one like /api/events/*
+func SlowThresholdOf(path string) time.Duration {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	threshold, matched := SlowThreshold, ""
+	for prefix, d := range SlowThresholds {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(matched) {
+			threshold, matched = d, prefix
+		}
+	}
+	return threshold
 }
 
 // 起こったら即0点にするエラー
@@ -151,19 +419,32 @@ func (e *fatalError) Error() string {
 }
 
 func fatalErrorf(format string, a ...interface{}) error {
-	return &fatalError{fmt.Sprintf(format, a...)}
+	return &fatalError{Msgf(format, a...)}
 }
 
 type CheckerError struct {
-	t      time.Time
-	err    error
-	method string
-	path   string
-	query  string
+	t         time.Time
+	err       error
+	code      ErrorCode
+	method    string
+	path      string
+	query     string
+	url       string
+	expected  string
+	actual    string
+	requestID string
+	capture   string // path of the dumped request and response
 }
 
 func (e *CheckerError) Error() string {
-	return fmt.Sprintf("%v %v (%v %v %v)", e.t, e.err, e.method, e.path, e.query)
+	detail := fmt.Sprintf("%v %v %v", e.method, e.path, e.query)
+	if e.requestID != "" {
+		detail += fmt.Sprintf(" %s:%s", RequestIDHeader, e.requestID)
+	}
+	if e.capture != "" {
+		detail += " capture:" + e.capture
+	}
+	return fmt.Sprintf("%v %v (%s)", e.t, e.err, detail)
 }
 
 func (e *CheckerError) IsFatal() bool {
@@ -176,6 +457,9 @@ func (e *CheckerError) IsTimeout() bool {
 }
 
 func IsFatal(err error) bool {
+	if ce, ok := err.(*codedError); ok {
+		err = ce.err
+	}
 	if _, ok := err.(*fatalError); ok {
 		return true
 	}
@@ -222,6 +506,12 @@ func GetLastCheckerError() (err error, t time.Time) {
 	return
 }
 
+func CountCheckerErrors() int {
+	checkerMtx.Lock()
+	defer checkerMtx.Unlock()
+	return len(checkerErrors)
+}
+
 func GetCheckerErrors() []error {
 	checkerMtx.Lock()
 	var errs []error
@@ -238,6 +528,10 @@ type Checker struct {
 
 	chRequestToken chan int
 	debugHeaders   map[string]string
+	latencyClass   *LatencyClass
+	stickyHost     int
+	userAgent      userAgent
+	lastResponseAt int64 // unix nano, for think
 }
 
 type CheckAction struct {
@@ -255,11 +549,15 @@ type CheckAction struct {
 	ExpectedHeaders    map[string]string
 	Description        string
 	CheckFunc          func(*http.Response, *bytes.Buffer) error
+	// Reads the body of a 200 response instead of CheckFunc without buffering it, for large responses.
+	// The reader is gunzipped if needed, and the body left unread by it is discarded.
+	StreamFunc func(*http.Response, io.Reader) error
 
 	EnableCache         bool
 	DisableSlowChecking bool
+	AllowServerError    bool // pass 5xx responses to CheckFunc instead of treating them as errors
 
-	Timeout time.Duration
+	Timeout time.Duration // 0 for TimeoutOf the request
 }
 
 func NewChecker() *Checker {
@@ -278,6 +576,13 @@ func NewChecker() *Checker {
 		},
 	}
 
+	c.latencyClass = pickLatencyClass()
+	if c.latencyClass != nil && c.latencyClass.Delay > 0 {
+		c.Client.Transport = &delayTransport{c.latencyClass.Delay, transport}
+	}
+
+	c.stickyHost = rand.Int()
+	c.userAgent = pickUserAgent()
 	c.Cache = urlcache.NewCacheStore()
 	c.debugHeaders = map[string]string{}
 	c.chRequestToken = make(chan int, MaxCheckerRequest)
@@ -296,17 +601,58 @@ func (c *Checker) ResetCookie() {
 	c.Client.Jar = jar
 }
 
+func (c *Checker) getCookie(name string) *http.Cookie {
+	for _, cookie := range c.Client.Jar.Cookies(&url.URL{Scheme: "http", Host: TorbAppHost, Path: "/"}) {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func (c *Checker) setCookie(cookie *http.Cookie) {
+	c.Client.Jar.SetCookies(&url.URL{Scheme: "http", Host: TorbAppHost, Path: "/"}, []*http.Cookie{cookie})
+}
+
 func (c *Checker) OnError(a *CheckAction, req *http.Request, err error) error {
+	code := ErrorCodeRequestFailed
+	if err == RequestTimeoutError {
+		code = ErrorCodeTimeout
+	}
+	return c.onError(a, req, code, err, "")
+}
+
+// Same as OnError, but also captures the response to FailureDir
+func (c *Checker) onResponseError(a *CheckAction, res *http.Response, body *bytes.Buffer, err error) error {
+	if _, ok := err.(*CheckerError); ok {
+		return err
+	}
+	code := ErrorCodeWrongBody
+	if IsFatal(err) {
+		code = ErrorCodeConsistencyViolation
+	}
+	return c.onError(a, res.Request, code, err, captureFailure(a, res, body, err))
+}
+
+// code is used unless err is given one by withErrorCode
+func (c *Checker) onError(a *CheckAction, req *http.Request, code ErrorCode, err error, capture string) error {
 	// OnFailが1つのエラーに対して2回以上呼ばれた時の対策
 	if _, ok := err.(*CheckerError); ok {
 		return err
 	}
 
-	var cerr *CheckerError
+	cerr := &CheckerError{t: time.Now(), code: code, capture: capture}
+	if ce, ok := err.(*codedError); ok {
+		cerr.code, cerr.expected, cerr.actual = ce.code, ce.expected, ce.actual
+		err = ce.err
+	}
+	cerr.err = err
 	if req == nil {
-		cerr = &CheckerError{time.Now(), err, a.Method, a.Path, ""}
+		cerr.method, cerr.path, cerr.url = a.Method, a.Path, a.Path
 	} else {
-		cerr = &CheckerError{time.Now(), err, req.Method, req.URL.Path, req.URL.Query().Encode()}
+		cerr.method, cerr.path, cerr.query = req.Method, req.URL.Path, req.URL.Query().Encode()
+		cerr.url = req.URL.String()
+		cerr.requestID = req.Header.Get(RequestIDHeader)
 	}
 
 	appendError(cerr)
@@ -335,10 +681,30 @@ func (c *Checker) NewRequest(method, uri string, body io.Reader) (*http.Request,
 	return req, err
 }
 
+// Returns the number of requests which are sent and whose responses are not read yet
+func CountInFlightRequests() int64 {
+	return atomic.LoadInt64(&inFlightRequests)
+}
+
 func (c *Checker) Play(ctx context.Context, a *CheckAction) error {
+	if !a.EnableCache && thinksIn(ctx) {
+		if err := c.think(ctx); err != nil {
+			return err
+		}
+	}
+	ctx, span := startSpan(ctx, a.Method+" "+a.Path, spanKindClient)
+	err := c.play(ctx, a, span)
+	span.End(err)
+	return err
+}
+
+func (c *Checker) play(ctx context.Context, a *CheckAction, span *Span) error {
 	if ctx.Err() != nil {
 		return ctx.Err()
 	}
+	defer func() {
+		atomic.StoreInt64(&c.lastResponseAt, time.Now().UnixNano())
+	}()
 
 	select {
 	case token := <-c.chRequestToken:
@@ -385,7 +751,7 @@ func (c *Checker) Play(ctx context.Context, a *CheckAction) error {
 
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		return c.OnError(a, req, fmt.Errorf("リクエストに失敗しました (主催者に連絡してください)"))
+		return c.OnError(a, req, errorf("リクエストに失敗しました (主催者に連絡してください)"))
 	}
 
 	if DebugMode {
@@ -402,33 +768,83 @@ func (c *Checker) Play(ctx context.Context, a *CheckAction) error {
 		}
 	}
 
-	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("User-Agent", c.userAgent.value)
+	if _, ok := a.Headers["Range"]; ok {
+		// A range of a gzip encoded response (e.g. gzip_static of nginx) is a slice of the compressed
+		// stream, which can not be decoded and whose Content-Range is of the compressed size
+		req.Header.Set("Accept-Encoding", "identity")
+	} else {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	req.Header.Set(RequestIDHeader, fmt.Sprintf("%s-%d", benchRunID, atomic.AddUint64(&benchRequestCounter, 1)))
+	if span != nil {
+		req.Header.Set("traceparent", span.traceparent())
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("url.full", req.URL.String())
+		span.SetAttribute("bench.request_id", req.Header.Get(RequestIDHeader))
+	}
 	for key, val := range a.Headers {
 		req.Header.Add(key, val)
 	}
 
-	var timeout time.Duration
-	if a.Timeout > 0 {
-		timeout = a.Timeout
-	} else {
-		timeout = GetTimeout
-		if req.Method == http.MethodPost {
-			timeout = PostTimeout
-		} else if req.Method == http.MethodDelete {
-			timeout = DeleteTimeout
-		}
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = TimeoutOf(req.Method, a.Path)
+	}
+	benchCtx := ctx
+	if HostStrategy == "sticky" {
+		ctx = context.WithValue(ctx, stickyHostKey{}, c.stickyHost)
 	}
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
+	phases := new(requestPhases)
+	ctx = httptrace.WithClientTrace(ctx, phases.trace())
+	var host string
+	ctx = withTargetHost(ctx, &host)
 	req = req.WithContext(ctx)
 
-	tm := time.AfterFunc(SlowThreshold, func() {
+	// The delay of the latency class of the user is added by the client, so it is not the fault of the app
+	var delay time.Duration
+	if c.latencyClass != nil {
+		delay = c.latencyClass.Delay
+	}
+
+	threshold := SlowThresholdOf(a.Path)
+	slow := &slowRequest{path: a.Path}
+	tm := &slowTimer{d: threshold, f: func() {
 		if !a.DisableSlowChecking {
-			updateLastSlowPath(a.Path)
+			observeSlowRequest(slow, threshold)
 		}
-	})
+	}}
+	if proxyURL == nil {
+		tm.d += delay
+		tm.start()
+	} else {
+		// The time to connect through the proxy is not the fault of the app
+		phases.onConn = tm.start
+	}
+	atomic.AddInt64(&inFlightRequests, 1)
+	defer atomic.AddInt64(&inFlightRequests, -1)
+	requestedAt := time.Now()
 	res, err := c.Client.Do(req)
-	tm.Stop()
+	tm.stop()
+	latency := time.Since(requestedAt) - delay
+	if latency < 0 {
+		latency = 0
+	}
+	requestedAt = requestedAt.Add(delay)
+	finishSlowRequest(slow, latency)
+
+	succeeded := false
+	defer func() {
+		// requests aborted because the benchmark ended are not the fault of the app
+		if succeeded || benchCtx.Err() == nil {
+			recordEndpointStat(a.Method, a.Path, latency, succeeded)
+			if host != "" {
+				recordHostStat(host, latency, succeeded)
+			}
+		}
+	}()
 
 	isRedirectErr := false
 	if urlError, ok := err.(*url.Error); ok && urlError.Err == RedirectAttemptedError {
@@ -443,11 +859,11 @@ func (c *Checker) Play(ctx context.Context, a *CheckAction) error {
 			}
 		}
 
-		return c.OnError(a, req, fmt.Errorf("リクエストに失敗しました %v", err))
+		return c.OnError(a, req, errorf("リクエストに失敗しました %v", err))
 	}
 
 	if res == nil {
-		return c.OnError(a, req, fmt.Errorf("レスポンスが不正です"))
+		return c.OnError(a, req, errorf("レスポンスが不正です"))
 	}
 
 	defer res.Body.Close()
@@ -455,41 +871,82 @@ func (c *Checker) Play(ctx context.Context, a *CheckAction) error {
 	body := GetBuffer()
 	defer PutBuffer(body)
 
-	_, err = io.Copy(body, res.Body)
-	if err == context.DeadlineExceeded {
-		return c.OnError(a, req, RequestTimeoutError)
+	// A streamed body is read after the checks of the headers, and body is left empty
+	streaming := a.StreamFunc != nil && res.StatusCode == http.StatusOK
+	bodyReadAt := time.Now()
+	if !streaming {
+		_, err = io.Copy(body, res.Body)
+		phases.record(a.Method, a.Path, time.Since(bodyReadAt))
+		if err == context.DeadlineExceeded {
+			return c.OnError(a, req, RequestTimeoutError)
+		}
+		// Note. リダイレクトなどのときはbodyが既に閉じられている状態で来て closed error が返るので無視する
 	}
-	// Note. リダイレクトなどのときはbodyが既に閉じられている状態で来て closed error が返るので無視する
 
-	if 500 <= res.StatusCode {
-		return c.OnError(a, res.Request, fmt.Errorf("サーバエラーが発生しました。%s", res.Status))
+	recordHAR(a, res, body, requestedAt, latency)
+	span.SetAttribute("http.response.status_code", res.StatusCode)
+
+	if 500 <= res.StatusCode && !a.AllowServerError {
+		return c.onResponseError(a, res, body, withErrorCode(ErrorCodeServerError, "", res.Status, errorf("サーバエラーが発生しました。%s", res.Status)))
+	}
+
+	counter.Add(counter.EndpointKey(counter.NameBytes, a.Method, a.Path), body.Len())
+	if encoding := res.Header.Get("Content-Encoding"); encoding != "" {
+		key := counter.EndpointKey(counter.NameContentEncoding, a.Method, a.Path)
+		key.Labels = counter.Labels("encoding", strings.ToLower(encoding))
+		counter.Inc(key)
+		// 304 and redirect responses may carry the header without a body
+		if strings.EqualFold(encoding, "gzip") && body.Len() > 0 {
+			decoded, err := gunzipBuffer(body)
+			if err != nil {
+				return c.onResponseError(a, res, body, errorf("gzipレスポンスの展開に失敗しました %v", err))
+			}
+			defer PutBuffer(decoded)
+			body = decoded
+		}
 	}
 
 	if a.ExpectedStatusCode != 0 && res.StatusCode != a.ExpectedStatusCode {
-		var body interface{}
+		var reqBody interface{}
 		if a.PostData != nil {
-			body = a.PostData
+			reqBody = a.PostData
 		} else if a.PostJSON != nil {
-			body = a.PostJSON
+			reqBody = a.PostJSON
 		} else {
 			if seeker, ok := a.PostBody.(io.Seeker); ok {
 				seeker.Seek(0, 0)
-				body, _ = ioutil.ReadAll(a.PostBody)
+				reqBody, _ = ioutil.ReadAll(a.PostBody)
 			} else {
-				body = a.PostBody
+				reqBody = a.PostBody
 			}
 		}
-		return c.OnError(a, res.Request, fmt.Errorf("Response code should be %d, got %d, data: %+v", a.ExpectedStatusCode, res.StatusCode, body))
+		err := fmt.Errorf("Response code should be %d, got %d, data: %+v", a.ExpectedStatusCode, res.StatusCode, reqBody)
+		return c.onResponseError(a, res, body, withErrorCode(ErrorCodeWrongStatus, strconv.Itoa(a.ExpectedStatusCode), strconv.Itoa(res.StatusCode), err))
 	}
 
 	if a.ExpectedLocation != nil {
 		l := res.Header["Location"]
 		if len(l) != 1 {
-			return c.OnError(a, res.Request, fmt.Errorf("リダイレクトURLが適切に設定されていません"))
+			return c.onResponseError(a, res, body, withErrorCode(ErrorCodeContractViolation, a.ExpectedLocation.String(), strings.Join(l, ", "), errorf("リダイレクトURLが適切に設定されていません")))
 		}
 		u, err := url.Parse(l[0])
 		if err != nil || !a.ExpectedLocation.MatchString(u.Path) {
-			return c.OnError(a, res.Request, fmt.Errorf("リダイレクト先URLが正しくありません: expected '%s', got '%s'", a.ExpectedLocation, l[0]))
+			return c.onResponseError(a, res, body, withErrorCode(ErrorCodeContractViolation, a.ExpectedLocation.String(), l[0], errorf("リダイレクト先URLが正しくありません: expected '%s', got '%s'", a.ExpectedLocation, l[0])))
+		}
+	}
+
+	if err := checkSetCookies(res); err != nil {
+		return c.onResponseError(a, res, body, err)
+	}
+	if a.ExpectedStatusCode != 0 {
+		if err := checkContentType(a.Path, res, body.Len()); err != nil {
+			return c.onResponseError(a, res, body, err)
+		}
+	}
+
+	if schema := findResponseSchema(strings.ToUpper(a.Method), a.Path, res.StatusCode); schema != nil {
+		if err := validateJSONSchema(body.Bytes(), schema); err != nil {
+			return c.onResponseError(a, res, body, withErrorCode(ErrorCodeContractViolation, "", "", err))
 		}
 	}
 
@@ -500,15 +957,87 @@ func (c *Checker) Play(ctx context.Context, a *CheckAction) error {
 		}
 	}
 
-	if a.CheckFunc != nil {
+	if streaming {
+		if err := c.playStream(ctx, a, res, body); err != nil {
+			return err
+		}
+		phases.record(a.Method, a.Path, time.Since(bodyReadAt))
+	} else if a.CheckFunc != nil {
 		if err := a.CheckFunc(res, body); err != nil {
 			if a.EnableCache {
 				c.Cache.Del(a.Path)
 			}
-			return c.OnError(a, res.Request, err)
+			return c.onResponseError(a, res, body, err)
 		}
 	}
 
-	counter.IncKey(a.Method + "|" + a.Path)
+	key := counter.RequestKey(a.Method, a.Path, res.StatusCode)
+	key.Labels = counter.Labels("device", c.userAgent.device)
+	counter.Inc(key)
+	if c.latencyClass != nil {
+		c.latencyClass.record(key, latency+delay)
+		if a.EnableCache {
+			c.latencyClass.inc(counter.Key{Name: counter.NameStaticFile, Labels: counter.Labels("status", strconv.Itoa(res.StatusCode), "device", c.userAgent.device)})
+		}
+	}
+	succeeded = true
+	return nil
+}
+
+// Counts the bytes read and keeps the first read error, which the reader of a stream may hide
+type countingReader struct {
+	r   io.Reader
+	n   int
+	err error
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// Passes the body of res to StreamFunc of a. body is empty and only used to capture a failure.
+func (c *Checker) playStream(ctx context.Context, a *CheckAction, res *http.Response, body *bytes.Buffer) error {
+	cr := &countingReader{r: res.Body}
+	defer func() {
+		counter.Add(counter.EndpointKey(counter.NameBytes, a.Method, a.Path), cr.n)
+	}()
+
+	readFailed := func() bool {
+		return cr.err != nil && cr.err != io.EOF
+	}
+	onReadError := func() error {
+		if ctx.Err() == context.DeadlineExceeded {
+			return c.OnError(a, res.Request, RequestTimeoutError)
+		}
+		return c.OnError(a, res.Request, errorf("リクエストに失敗しました %v", cr.err))
+	}
+
+	var r io.Reader = cr
+	if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		gr, err := gzip.NewReader(cr)
+		if readFailed() {
+			return onReadError()
+		}
+		if err != nil {
+			return c.onResponseError(a, res, body, errorf("gzipレスポンスの展開に失敗しました %v", err))
+		}
+		r = gr
+	}
+
+	err := a.StreamFunc(res, r)
+	if err == nil {
+		io.Copy(ioutil.Discard, cr)
+	}
+	if readFailed() {
+		return onReadError()
+	}
+	if err != nil {
+		return c.onResponseError(a, res, body, err)
+	}
 	return nil
 }
@@ -0,0 +1,99 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"bench/parameter"
+)
+
+// Write churn: reservations and cancellations of the reservations made earlier in the run are
+// alternated at parameter.ChurnReserveRatio, so that the tables of the app also shrink during the
+// load. The other load scenarios cancel only the reservations they have just made.
+
+// Parses "<reserve>/<cancel>" e.g. "70/30" into parameter.ChurnReserveRatio
+func SetChurnRatio(spec string) error {
+	fields := strings.Split(spec, "/")
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid churn ratio %q: <reserve>/<cancel> e.g. 70/30", spec)
+	}
+	reserve, err1 := strconv.ParseFloat(fields[0], 64)
+	cancel, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || reserve < 0 || cancel < 0 || reserve+cancel == 0 {
+		return fmt.Errorf("invalid churn ratio %q: <reserve>/<cancel> e.g. 70/30", spec)
+	}
+	parameter.ChurnReserveRatio = reserve / (reserve + cancel)
+	return nil
+}
+
+// Reserves a sheet, or cancels a reservation picked from the ledger. It reserves also when no
+// reservation to cancel is found, e.g. at the beginning of the load.
+func LoadReserveCancelChurn(ctx context.Context, state *State) error {
+	if rand.Float64() >= parameter.ChurnReserveRatio {
+		if reservation := state.GetRandomLedgerReservation(); reservation != nil {
+			return churnCancel(ctx, state, reservation)
+		}
+	}
+	return churnReserve(ctx, state)
+}
+
+func churnReserve(ctx context.Context, state *State) error {
+	user, checker, userPush := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer userPush()
+
+	err := loginAppUser(ctx, checker, user)
+	if err != nil {
+		return err
+	}
+
+	eventSheet, eventSheetPush, err := popOrCreateEventSheet(ctx, state)
+	if err != nil {
+		return err
+	}
+	if eventSheet == nil {
+		return nil
+	}
+
+	reservation, err := reserveSheet(ctx, state, checker, user, eventSheet)
+	if reservation == nil && err == nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	eventSheetPush() // NOTE: push only after reserve succeeds
+
+	return nil
+}
+
+// Cancels the reservation as its user, who may be busy in another scenario
+func churnCancel(ctx context.Context, state *State, reservation *Reservation) error {
+	user, checker, userPush := state.PopUserByID(reservation.UserID)
+	if user == nil {
+		return nil
+	}
+	defer userPush()
+
+	err := loginAppUser(ctx, checker, user)
+	if err != nil {
+		return err
+	}
+
+	eventSheet := &EventSheet{reservation.EventID, reservation.SheetRank, reservation.SheetNum, reservation.Price}
+	alreadyLocked, err := cancelSheet(ctx, state, checker, user, eventSheet, reservation)
+	if err != nil {
+		return err
+	}
+	if alreadyLocked {
+		return nil
+	}
+	state.ReleaseEventSheet(reservation)
+
+	return nil
+}
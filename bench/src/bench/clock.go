@@ -0,0 +1,63 @@
+package bench
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"bench/parameter"
+)
+
+// Every duration used for scoring windows and level-up timers is computed from time.Now() values
+// which carry a monotonic clock reading, so they are not affected by a wall clock step.
+// Timestamps in logs and results are still wall clock, so we detect and report the steps.
+
+type ClockJump struct {
+	At     time.Time
+	Offset time.Duration // wall clock elapsed - monotonic clock elapsed
+}
+
+func (j ClockJump) String() string {
+	return Msgf("%s システム時刻が %v ずれました", j.At.Format("01/02 15:04:05"), j.Offset)
+}
+
+var (
+	clockJumpMtx sync.Mutex
+	clockJumps   []ClockJump
+)
+
+// Detects wall clock jumps (e.g. NTP step) by comparing wall and monotonic elapsed time until ctx is done
+func WatchClockJump(ctx context.Context) {
+	ticker := time.NewTicker(parameter.ClockJumpCheckInterval)
+	defer ticker.Stop()
+
+	prev := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			monotonic := now.Sub(prev)
+			wall := now.Round(0).Sub(prev.Round(0)) // Round(0) strips the monotonic clock reading
+			offset := wall - monotonic
+			if offset > parameter.ClockJumpThreshold || offset < -parameter.ClockJumpThreshold {
+				log.Println("warn: Wall clock jumped", offset)
+				clockJumpMtx.Lock()
+				clockJumps = append(clockJumps, ClockJump{now, offset})
+				clockJumpMtx.Unlock()
+			}
+			prev = now
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func GetClockJumps() []ClockJump {
+	clockJumpMtx.Lock()
+	defer clockJumpMtx.Unlock()
+
+	jumps := make([]ClockJump, len(clockJumps))
+	copy(jumps, clockJumps)
+	return jumps
+}
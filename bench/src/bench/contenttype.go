@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Content-Type of the responses with a body, checked by Checker.Play for every expected status code.
+// Rewritten apps often drop or change the headers the frameworks of the reference set, which
+// breaks browsers (e.g. a CSV shown inline, HTML with a guessed charset) without failing any check.
+
+type contentTypeSpec struct {
+	mediaType       string
+	requiresCharset bool // the charset must be utf-8, otherwise it must be utf-8 if any
+}
+
+var (
+	contentTypeJSON = &contentTypeSpec{"application/json", false}
+	contentTypeHTML = &contentTypeSpec{"text/html", true}
+	contentTypeCSV  = &contentTypeSpec{"text/csv", false}
+)
+
+func (s *contentTypeSpec) String() string {
+	if s.requiresCharset {
+		return s.mediaType + "; charset=utf-8"
+	}
+	return s.mediaType
+}
+
+// Returns nil for the paths not checked, e.g. static files which are checked by their content.
+// Errors of the APIs are JSON as the reference app sends them by halt_with_error, reports included.
+func contentTypeSpecOf(path string, statusCode int) *contentTypeSpec {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	switch {
+	case strings.HasPrefix(path, "/admin/api/reports/") && statusCode < 300:
+		return contentTypeCSV
+	case strings.HasPrefix(path, "/api/"), strings.HasPrefix(path, "/admin/api/"):
+		return contentTypeJSON
+	case path == "/", path == "/admin/":
+		return contentTypeHTML
+	}
+	return nil
+}
+
+func checkContentType(path string, res *http.Response, bodyLen int) error {
+	spec := contentTypeSpecOf(path, res.StatusCode)
+	// redirects and 304 may have a body of the server, and the body of 204 is ignored by clients
+	if spec == nil || bodyLen == 0 || res.StatusCode == http.StatusNoContent || 300 <= res.StatusCode && res.StatusCode < 400 {
+		return nil
+	}
+
+	actual := res.Header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(actual)
+	if err == nil && mediaType == spec.mediaType {
+		charset, ok := params["charset"]
+		if ok && strings.EqualFold(charset, "utf-8") || !ok && !spec.requiresCharset {
+			return nil
+		}
+	}
+	return withErrorCode(ErrorCodeWrongContentType, spec.String(), actual, errorf("Content-Typeが正しくありません expected '%s', got '%s'", spec, actual))
+}
@@ -0,0 +1,50 @@
+package bench
+
+import (
+	"net/http"
+	"time"
+
+	"bench/parameter"
+)
+
+// The app sets no cookie but the session cookie, which must be sent on every path and hidden from
+// scripts. Its expiry may be absent (a browser session cookie) or between SessionCookieMinAge and
+// SessionCookieMaxAge, unless it deletes the cookie. Checked by Checker.Play for every response.
+func checkSetCookies(res *http.Response) error {
+	now := time.Now()
+	numSessionCookies := 0
+	for _, cookie := range res.Cookies() {
+		if cookie.Name != SessionCookieName {
+			return withErrorCode(ErrorCodeContractViolation, SessionCookieName, cookie.Name, errorf("予期しないCookie(%s)が設定されました", cookie.Name))
+		}
+		numSessionCookies++
+		if numSessionCookies > 1 {
+			return withErrorCode(ErrorCodeContractViolation, "1", "", errorf("セッションCookieが複数回設定されました"))
+		}
+
+		if cookie.Path != "/" {
+			return withErrorCode(ErrorCodeContractViolation, "/", cookie.Path, errorf("セッションCookieのPathが正しくありません expected '/', got '%s'", cookie.Path))
+		}
+		if !cookie.HttpOnly {
+			return withErrorCode(ErrorCodeContractViolation, "HttpOnly", "", errorf("セッションCookieにHttpOnlyがありません"))
+		}
+
+		var expiry time.Time
+		switch {
+		case cookie.MaxAge < 0 || cookie.Value == "":
+			// deleted
+			continue
+		case cookie.MaxAge > 0:
+			expiry = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		case !cookie.Expires.IsZero():
+			expiry = cookie.Expires
+		default:
+			continue
+		}
+		lifetime := expiry.Sub(now)
+		if lifetime < parameter.SessionCookieMinAge-parameter.ClockSkewTolerance || parameter.SessionCookieMaxAge+parameter.ClockSkewTolerance < lifetime {
+			return withErrorCode(ErrorCodeContractViolation, "", expiry.UTC().Format(http.TimeFormat), errorf("セッションCookieの有効期限が正しくありません %s", expiry.UTC().Format(http.TimeFormat)))
+		}
+	}
+	return nil
+}
@@ -1,81 +1,279 @@
 package counter
 
 import (
-	"regexp"
+	"math/rand/v2"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var (
-	mtx    sync.Mutex
-	cntMap map[string]int64
+// Counters are identified by a Key. Requests are counted by their method, normalized path and
+// status class, and the other counters by their name and free-form labels, e.g.
+//
+//	counter.Inc(counter.RequestKey("GET", "/api/events/1", 200))
+//	counter.Inc(counter.Key{Name: "chaos", Labels: counter.Labels("action", "slow-body")})
+//	counter.Sum(counter.Key{Name: counter.NameRequest, Method: "GET"})
+type Key struct {
+	Name   string `json:"name"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`   // normalized by NormalizePath
+	Status string `json:"status,omitempty"` // status class, e.g. "2xx"
+	Labels string `json:"labels,omitempty"` // built by Labels, e.g. "encoding=gzip"
+}
+
+const (
+	NameRequest         = "request"          // checked requests which succeeded
+	NameBytes           = "bytes"            // response body bytes before decoding
+	NameContentEncoding = "content-encoding" // responses by the label encoding
+	NamePhaseUs         = "phase-us"         // microseconds spent in the label phase
+	NamePhaseN          = "phase-n"          // requests in which the label phase happened
+	NameConn            = "conn"             // connections got by the labels host and reused
+	NameStaticFile      = "staticfile"       // static files by the label status
 )
 
-func init() {
-	cntMap = map[string]int64{}
+type Count struct {
+	Key
+	Value int64 `json:"value"`
+}
+
+// Each counter is split into stripes, and an update adds to one of them picked at random, so that
+// hundreds of workers counting the same key do not contend on a lock or a single cache line.
+// The stripes are summed on read. Keys are added to a sync.Map once and only loaded after that.
+type stripedCounter struct {
+	stripes []paddedInt64
 }
 
-func IncKey(key string) {
-	mtx.Lock()
-	cntMap[key]++
-	mtx.Unlock()
+type paddedInt64 struct {
+	v int64
+	_ [56]byte // a cache line each
+}
+
+var (
+	numStripes = stripesFor(runtime.GOMAXPROCS(0))
+	counters   sync.Map // Key -> *stripedCounter
+)
+
+// Returns the power of two not less than procs
+func stripesFor(procs int) int {
+	n := 1
+	for n < procs {
+		n <<= 1
+	}
+	return n
 }
 
-func AddKey(key string, diff int) {
-	mtx.Lock()
-	cntMap[key] += int64(diff)
-	mtx.Unlock()
+func load(key Key) *stripedCounter {
+	if c, ok := counters.Load(key); ok {
+		return c.(*stripedCounter)
+	}
+	c, _ := counters.LoadOrStore(key, &stripedCounter{stripes: make([]paddedInt64, numStripes)})
+	return c.(*stripedCounter)
 }
 
-func GetKey(key string) int64 {
-	mtx.Lock()
-	v := cntMap[key]
-	mtx.Unlock()
-	return v
+func (c *stripedCounter) add(diff int64) {
+	// rand/v2 has a source per P, so picking the stripe does not contend either
+	atomic.AddInt64(&c.stripes[rand.Uint32()&uint32(len(c.stripes)-1)].v, diff)
 }
 
-func SumMatched(re *regexp.Regexp) int64 {
+func (c *stripedCounter) sum() int64 {
 	var sum int64
-	mtx.Lock()
-	for k, v := range cntMap {
-		if re.MatchString(k) {
-			sum += v
-		}
+	for i := range c.stripes {
+		sum += atomic.LoadInt64(&c.stripes[i].v)
 	}
-	mtx.Unlock()
 	return sum
 }
 
-func SumPrefix(prefix string) int64 {
-	var sum int64
-	mtx.Lock()
-	for k, v := range cntMap {
-		if strings.HasPrefix(k, prefix) {
-			sum += v
+// Returns the key of a request of method to path which got a response of statusCode
+func RequestKey(method, path string, statusCode int) Key {
+	return Key{Name: NameRequest, Method: method, Path: NormalizePath(path), Status: StatusClass(statusCode)}
+}
+
+// Returns the key of the name counted per request, such as NameBytes
+func EndpointKey(name, method, path string) Key {
+	return Key{Name: name, Method: method, Path: NormalizePath(path)}
+}
+
+func StatusClass(statusCode int) string {
+	if statusCode < 100 || 999 < statusCode {
+		return ""
+	}
+	return string('0'+byte(statusCode/100)) + "xx"
+}
+
+// Builds the labels of a key from name and value pairs. The labels are sorted by name,
+// so that the same labels always make the same key.
+func Labels(kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		pairs = append(pairs, kv[i]+"="+kv[i+1])
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Returns the value of the label name, or "" if the key does not have it
+func (k Key) Label(name string) string {
+	for _, pair := range strings.Split(k.Labels, ",") {
+		if i := strings.Index(pair, "="); i >= 0 && pair[:i] == name {
+			return pair[i+1:]
+		}
+	}
+	return ""
+}
+
+// Reports whether k matches q. Empty fields of q match anything, and k has to have every label of q.
+func (k Key) Matches(q Key) bool {
+	if (q.Name != "" && q.Name != k.Name) ||
+		(q.Method != "" && q.Method != k.Method) ||
+		(q.Path != "" && q.Path != k.Path) ||
+		(q.Status != "" && q.Status != k.Status) {
+		return false
+	}
+	if q.Labels != "" {
+		for _, pair := range strings.Split(q.Labels, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || k.Label(kv[0]) != kv[1] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// e.g. "GET|/api/events/*|2xx" for requests and "bytes|GET|/api/events/*" or "staticfile|status=304" for others
+func (k Key) String() string {
+	var fields []string
+	if k.Name != NameRequest {
+		fields = append(fields, k.Name)
+	}
+	for _, f := range []string{k.Method, k.Path, k.Status, k.Labels} {
+		if f != "" {
+			fields = append(fields, f)
 		}
 	}
-	mtx.Unlock()
+	return strings.Join(fields, "|")
+}
+
+func Inc(key Key) {
+	load(key).add(1)
+}
+
+func Add(key Key, diff int) {
+	load(key).add(int64(diff))
+}
+
+func Get(key Key) int64 {
+	c, ok := counters.Load(key)
+	if !ok {
+		return 0
+	}
+	return c.(*stripedCounter).sum()
+}
+
+// Returns the sum of the counters which match q
+func Sum(q Key) int64 {
+	var sum int64
+	counters.Range(func(k, c interface{}) bool {
+		if k.(Key).Matches(q) {
+			sum += c.(*stripedCounter).sum()
+		}
+		return true
+	})
 	return sum
 }
 
-func SumEqual(str string) int64 {
+// Same as Snapshot().GroupBy(q, by)
+func GroupBy(q Key, by func(Key) Key) map[Key]int64 {
+	return Snapshot().GroupBy(q, by)
+}
+
+// A copy of the counters taken by Snapshot. It is not changed by later updates nor by its methods,
+// so that phases and windows of the run can be told apart, e.g. with Snapshot().Sub(atLoadStart).
+type Counts struct {
+	Time time.Time
+	m    map[Key]int64
+}
+
+func Snapshot() Counts {
+	c := Counts{Time: time.Now(), m: map[Key]int64{}}
+	counters.Range(func(k, sc interface{}) bool {
+		c.m[k.(Key)] = sc.(*stripedCounter).sum()
+		return true
+	})
+	return c
+}
+
+func (c Counts) Get(key Key) int64 {
+	return c.m[key]
+}
+
+func (c Counts) Sum(q Key) int64 {
 	var sum int64
-	mtx.Lock()
-	for k, v := range cntMap {
-		if k == str {
+	for k, v := range c.m {
+		if k.Matches(q) {
 			sum += v
 		}
 	}
-	mtx.Unlock()
 	return sum
 }
 
-func GetMap() map[string]int64 {
-	m := map[string]int64{}
-	mtx.Lock()
-	for k, v := range cntMap {
+// Sums the counters which match q by the keys by returns for them, e.g. by endpoint with
+//
+//	GroupBy(Key{Name: NameRequest}, func(k Key) Key { return Key{Name: k.Name, Method: k.Method, Path: k.Path} })
+func (c Counts) GroupBy(q Key, by func(Key) Key) map[Key]int64 {
+	m := map[Key]int64{}
+	for k, v := range c.m {
+		if k.Matches(q) {
+			m[by(k)] += v
+		}
+	}
+	return m
+}
+
+// Returns a copy of the counters as a map
+func (c Counts) Map() map[Key]int64 {
+	m := make(map[Key]int64, len(c.m))
+	for k, v := range c.m {
 		m[k] = v
 	}
-	mtx.Unlock()
 	return m
 }
+
+// Returns the counts since o, which has to be taken earlier without a Reset in between
+func (c Counts) Sub(o Counts) Counts {
+	d := Counts{Time: c.Time, m: map[Key]int64{}}
+	for k, v := range c.m {
+		if v != o.m[k] {
+			d.m[k] = v - o.m[k]
+		}
+	}
+	return d
+}
+
+// Returns the counters sorted by key, e.g. to send them in JSON
+func (c Counts) List() []Count {
+	counts := make([]Count, 0, len(c.m))
+	for k, v := range c.m {
+		counts = append(counts, Count{k, v})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].String() < counts[j].String() })
+	return counts
+}
+
+// Updates racing with Reset may be lost, as they may be added to the counters being deleted
+func Reset() {
+	ResetPrefix("")
+}
+
+// Resets the counters whose name has prefix, e.g. "phase-" for NamePhaseUs and NamePhaseN
+func ResetPrefix(prefix string) {
+	counters.Range(func(k, _ interface{}) bool {
+		if strings.HasPrefix(k.(Key).Name, prefix) {
+			counters.Delete(k)
+		}
+		return true
+	})
+}
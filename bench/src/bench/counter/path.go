@@ -0,0 +1,52 @@
+package counter
+
+import (
+	"strings"
+)
+
+// Routes of Torb with their parameters as "*", in which counters and stats are aggregated
+var routes = [][]string{
+	splitPath("/api/users/*"),
+	splitPath("/api/events/*"),
+	splitPath("/api/events/*/actions/reserve"),
+	splitPath("/api/events/*/sheets/*/*/reservation"),
+	splitPath("/admin/api/events/*"),
+	splitPath("/admin/api/events/*/actions/edit"),
+	splitPath("/admin/api/reports/events/*/sales"),
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// Maps path to its route, e.g. "/api/events/1/actions/reserve" to "/api/events/*/actions/reserve".
+// The query is dropped, and numeric segments of the paths of no route are replaced with "*".
+func NormalizePath(path string) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	segments := splitPath(path)
+
+	for _, route := range routes {
+		if len(route) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, s := range route {
+			if s != "*" && s != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return "/" + strings.Join(route, "/")
+		}
+	}
+
+	for i, s := range segments {
+		if s != "" && strings.Trim(s, "0123456789") == "" {
+			segments[i] = "*"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
@@ -64,6 +64,10 @@ func prepareUserDataSet() {
 			DataSet.NewUsers = append(DataSet.NewUsers, user)
 		}
 	}
+
+	if UsersPath != "" {
+		loadCustomUsers()
+	}
 }
 
 func prepareAdministratorDataSet() {
@@ -276,6 +280,7 @@ func prepareReservationsDataSet() {
 	for _, r := range DataSet.Reservations {
 		r.ID = nextID
 
+		r.ReserveRequestedAt = time.Unix(int64(r.ReservedAt), 0)
 		r.ReserveCompletedAt = time.Unix(int64(r.ReservedAt), 0)
 		if r.CanceledAt != 0 {
 			r.CancelRequestedAt = time.Unix(int64(r.CanceledAt), 0)
@@ -0,0 +1,110 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"bench/parameter"
+)
+
+// Deep validation run at a low frequency during the load. The load scenarios look at a few fields
+// of the responses, and the checks run in random order, so an app which strips everything the
+// fast paths do not look at may go unnoticed for a while. DeepCheck re-validates the complete
+// content (the whole HTML of the pages, every sheet of an event and every row of a report) and
+// all its failures are fatal, except timeouts which are the matter of the load.
+func DeepCheck(ctx context.Context, state *State) error {
+	for _, f := range []func(context.Context, *State) error{
+		CheckTopPage,
+		CheckAdminTopPage,
+		deepCheckEventSheets,
+		CheckEventReport,
+	} {
+		err := f(ctx, state)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return deepCheckError(err)
+		}
+	}
+	return nil
+}
+
+func deepCheckError(err error) error {
+	if IsFatal(err) || IsCheckerTimeout(err) {
+		return err
+	}
+	return fatalErrorf("詳細チェックに失敗しました %v", err)
+}
+
+// Every sheet of a public event must agree with the reservations known to State, not only the counts
+func deepCheckEventSheets(ctx context.Context, state *State) error {
+	event := state.GetRandomPublicEvent()
+	if event == nil {
+		return nil
+	}
+
+	user, checker, push := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer push()
+
+	err := loginAppUser(ctx, checker, user)
+	if err != nil {
+		return err
+	}
+
+	timeBefore := time.Now().Add(-1 * parameter.AllowableDelay)
+	beforeEvent := CopyEvent(event)
+	reservationsBeforeRequest := FilterReservationsToAllowDelay(state.GetCopiedReservationsInEventID(event.ID), timeBefore)
+
+	return checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               fmt.Sprintf("/api/events/%d", event.ID),
+		ExpectedStatusCode: 200,
+		Description:        "公開イベントを取得できること",
+		CheckFunc: checkJsonEventResponse(beforeEvent, func(e JsonEvent) error {
+			err := checkEventList(state, []*Event{beforeEvent}, []JsonEvent{e}, []*Event{state.GetEventByID(event.ID)})
+			if err != nil {
+				return err
+			}
+
+			reservationsAfterResponse := state.GetCopiedReservationsInEventID(event.ID)
+			for id, r := range reservationsBeforeRequest {
+				// the reservation may be canceled concurrently
+				if after := reservationsAfterResponse[id]; after == nil || !after.CancelRequestedAt.IsZero() {
+					continue
+				}
+				if r.SheetNum < 1 || int(r.SheetNum) > len(e.Sheets[r.SheetRank].Details) {
+					continue
+				}
+				sheet := e.Sheets[r.SheetRank].Details[r.SheetNum-1]
+				if !sheet.Reserved {
+					return fatalErrorf("シート(%s-%d)が予約されていません(id:%d)", r.SheetRank, r.SheetNum, event.ID)
+				}
+				if sheet.Mine != (r.UserID == user.ID) {
+					return fatalErrorf("シート(%s-%d)の保有者が正しくありません(id:%d)", r.SheetRank, r.SheetNum, event.ID)
+				}
+				if sheet.ReservedAt == 0 || !isPlausibleTimestamp(time.Unix(int64(sheet.ReservedAt), 0), r.ReserveRequestedAt, r.ReserveCompletedAt) {
+					log.Printf("warn: reserved_at=%d is not between %s and %s (reservationID:%d)\n", sheet.ReservedAt, r.ReserveRequestedAt, r.ReserveCompletedAt, r.ID)
+					return fatalErrorf("シート(%s-%d)の予約時刻が正しくありません(id:%d)", r.SheetRank, r.SheetNum, event.ID)
+				}
+			}
+
+			for rank, sheets := range e.Sheets {
+				for _, sheet := range sheets.Details {
+					if sheet.Reserved {
+						continue
+					}
+					if sheet.Mine || sheet.ReservedAt != 0 {
+						return fatalErrorf("予約されていないシート(%s-%d)に予約情報があります(id:%d)", rank, sheet.Num, event.ID)
+					}
+				}
+			}
+			return nil
+		}),
+	})
+}
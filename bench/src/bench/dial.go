@@ -0,0 +1,41 @@
+package bench
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// Socket paths of the unix:<path> remotes by their host:port in request URLs
+var unixSockets = map[string]string{}
+
+// Returns the unix domain socket of a host:port returned by GetTargetHosts, if any
+func GetUnixSocket(host string) (string, bool) {
+	checkerMtx.Lock()
+	defer checkerMtx.Unlock()
+	path, ok := unixSockets[host]
+	return path, ok
+}
+
+// Dials unix domain socket remotes directly and the others through the HTTP proxy, if any
+func dialTarget(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	if path, ok := GetUnixSocket(addr); ok {
+		return d.DialContext(ctx, "unix", path)
+	}
+	if proxyURL != nil && proxyURL.Scheme == "http" {
+		return dialConnect(ctx, network, addr)
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// Transport for requests sent outside of Checker, such as /initialize and health checks
+func NewTransport() http.RoundTripper {
+	checkerMtx.Lock()
+	direct := proxyURL == nil && len(unixSockets) == 0
+	checkerMtx.Unlock()
+	if direct {
+		return http.DefaultTransport
+	}
+	return &http.Transport{Proxy: proxyFor, DialContext: dialTarget}
+}
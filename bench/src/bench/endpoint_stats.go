@@ -0,0 +1,170 @@
+package bench
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"bench/counter"
+	"bench/parameter"
+)
+
+// Latency and error counts per endpoint, used by the SLA mode and the level up.
+// Latencies are kept in logarithmic buckets (10% wide) so that memory does not grow with the number of requests.
+// The level up looks at the last LoadLevelUpWindow only, which is kept in per second slots.
+
+const (
+	latencyBucketBase = 1.1
+	numLatencyBuckets = 128 // up to about 190s in milliseconds
+)
+
+type EndpointStat struct {
+	Endpoint string
+	Requests int64
+	Errors   int64
+	buckets  [numLatencyBuckets]int64
+}
+
+// Ring of per second stats
+type endpointWindow struct {
+	secs  []int64
+	slots []EndpointStat
+}
+
+var (
+	endpointStatsMtx sync.Mutex
+	endpointStats    = map[string]*EndpointStat{}
+	endpointWindows  = map[string]*endpointWindow{}
+)
+
+func latencyBucketOf(latency time.Duration) int {
+	ms := float64(latency) / float64(time.Millisecond)
+	if ms < 1 {
+		return 0
+	}
+	i := int(math.Log(ms)/math.Log(latencyBucketBase)) + 1
+	if i >= numLatencyBuckets {
+		i = numLatencyBuckets - 1
+	}
+	return i
+}
+
+// Upper bound of the bucket
+func latencyOfBucket(i int) time.Duration {
+	return time.Duration(math.Pow(latencyBucketBase, float64(i)) * float64(time.Millisecond))
+}
+
+func recordEndpointStat(method, path string, latency time.Duration, ok bool) {
+	endpoint := method + "|" + counter.NormalizePath(path)
+
+	endpointStatsMtx.Lock()
+	defer endpointStatsMtx.Unlock()
+
+	stat, found := endpointStats[endpoint]
+	if !found {
+		stat = &EndpointStat{Endpoint: endpoint}
+		endpointStats[endpoint] = stat
+	}
+	stat.add(latency, ok)
+
+	w, found := endpointWindows[endpoint]
+	if !found {
+		n := int(math.Ceil(parameter.LoadLevelUpWindow.Seconds()))
+		if n < 1 {
+			n = 1
+		}
+		w = &endpointWindow{secs: make([]int64, n), slots: make([]EndpointStat, n)}
+		endpointWindows[endpoint] = w
+	}
+	sec := time.Now().Unix()
+	i := int(sec % int64(len(w.secs)))
+	if w.secs[i] != sec {
+		w.secs[i] = sec
+		w.slots[i] = EndpointStat{Endpoint: endpoint}
+	}
+	w.slots[i].add(latency, ok)
+}
+
+func (s *EndpointStat) add(latency time.Duration, ok bool) {
+	s.Requests++
+	if !ok {
+		s.Errors++
+	}
+	s.buckets[latencyBucketOf(latency)]++
+}
+
+func (s *EndpointStat) merge(o *EndpointStat) {
+	s.Requests += o.Requests
+	s.Errors += o.Errors
+	for i, count := range o.buckets {
+		s.buckets[i] += count
+	}
+}
+
+func ResetEndpointStats() {
+	endpointStatsMtx.Lock()
+	defer endpointStatsMtx.Unlock()
+
+	endpointStats = map[string]*EndpointStat{}
+	endpointWindows = map[string]*endpointWindow{}
+}
+
+// Returns copies of the stats sorted by endpoint
+func GetEndpointStats() []EndpointStat {
+	endpointStatsMtx.Lock()
+	defer endpointStatsMtx.Unlock()
+
+	stats := make([]EndpointStat, 0, len(endpointStats))
+	for _, stat := range endpointStats {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Endpoint < stats[j].Endpoint })
+	return stats
+}
+
+// Returns the stats of the last LoadLevelUpWindow sorted by endpoint
+func GetWindowEndpointStats() []EndpointStat {
+	endpointStatsMtx.Lock()
+	defer endpointStatsMtx.Unlock()
+
+	now := time.Now().Unix()
+	stats := make([]EndpointStat, 0, len(endpointWindows))
+	for endpoint, w := range endpointWindows {
+		stat := EndpointStat{Endpoint: endpoint}
+		for i, sec := range w.secs {
+			if now-sec < int64(len(w.secs)) {
+				stat.merge(&w.slots[i])
+			}
+		}
+		if stat.Requests > 0 {
+			stats = append(stats, stat)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Endpoint < stats[j].Endpoint })
+	return stats
+}
+
+// Returns the latency under which p percent of the requests completed, rounded up to the bucket
+func (s *EndpointStat) Percentile(p float64) time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(float64(s.Requests) * p / 100))
+	var n int64
+	for i, count := range s.buckets {
+		n += count
+		if n >= rank {
+			return latencyOfBucket(i)
+		}
+	}
+	return latencyOfBucket(numLatencyBuckets - 1)
+}
+
+// Ratio of successful requests
+func (s *EndpointStat) Availability() float64 {
+	if s.Requests == 0 {
+		return 1
+	}
+	return float64(s.Requests-s.Errors) / float64(s.Requests)
+}
@@ -0,0 +1,82 @@
+package bench
+
+import (
+	"time"
+)
+
+// Kind of a CheckerError, so that the portal can group the failures of a team
+type ErrorCode string
+
+const (
+	ErrorCodeWrongStatus          ErrorCode = "wrong-status"          // unexpected status code
+	ErrorCodeServerError          ErrorCode = "server-error"          // 5xx
+	ErrorCodeWrongBody            ErrorCode = "wrong-body"            // broken or unexpected response body
+	ErrorCodeWrongContentType     ErrorCode = "wrong-content-type"    // the Content-Type or its charset is not the one of the reference
+	ErrorCodeTimeout              ErrorCode = "timeout"               // the request timed out
+	ErrorCodeRequestFailed        ErrorCode = "request-failed"        // no response, e.g. the connection was refused
+	ErrorCodeContractViolation    ErrorCode = "contract-violation"    // error code, schema, headers or redirects differ from the reference
+	ErrorCodeConsistencyViolation ErrorCode = "consistency-violation" // the response contradicts the state known to the bench
+)
+
+// An error returned by a CheckAction with its code and the expected and actual values, which are
+// recorded in the CheckerError. Fatal errors stay fatal when they are wrapped.
+type codedError struct {
+	code     ErrorCode
+	expected string
+	actual   string
+	err      error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func withErrorCode(code ErrorCode, expected, actual string, err error) error {
+	return &codedError{code, expected, actual, err}
+}
+
+// Structured form of a CheckerError in the result
+type ErrorDetail struct {
+	Code      ErrorCode `json:"code"`
+	Fatal     bool      `json:"fatal"`
+	Message   string    `json:"message"` // same as Error() of the CheckerError
+	Reason    string    `json:"reason"`  // Message without the time and the request
+	Method    string    `json:"method,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Expected  string    `json:"expected,omitempty"`
+	Actual    string    `json:"actual,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Agent     string    `json:"agent,omitempty"` // hostname of the agent which recorded the error, if not this bench
+	Time      time.Time `json:"time"`
+}
+
+func (e *CheckerError) Code() ErrorCode {
+	return e.code
+}
+
+func (e *CheckerError) Detail() ErrorDetail {
+	return ErrorDetail{
+		Code:      e.code,
+		Fatal:     e.IsFatal(),
+		Message:   e.Error(),
+		Reason:    e.err.Error(),
+		Method:    e.method,
+		URL:       e.url,
+		Expected:  e.expected,
+		Actual:    e.actual,
+		RequestID: e.requestID,
+		Time:      e.t,
+	}
+}
+
+// Returns the details of the errors recorded so far
+func GetCheckerErrorDetails() []ErrorDetail {
+	checkerMtx.Lock()
+	defer checkerMtx.Unlock()
+
+	details := make([]ErrorDetail, 0, len(checkerErrors))
+	for _, e := range checkerErrors {
+		details = append(details, e.Detail())
+	}
+	return details
+}
@@ -0,0 +1,96 @@
+package bench
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"bench/parameter"
+)
+
+// Directory to dump the request and response of failed checks into. Disabled if empty.
+var FailureDir = ""
+
+var failureCaptureCounter int32
+
+// Scenario functions of this package, e.g. bench.LoadTopPage or bench.CheckReserveSheet.func1
+var scenarioFuncRe = regexp.MustCompile(`^bench\.((?:Load|Check)[A-Z]\w*)`)
+
+// Returns the name of the innermost Load/Check scenario on the call stack, or "" outside of scenarios
+func CallerScenario() string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if m := scenarioFuncRe.FindStringSubmatch(frame.Function); m != nil {
+			return m[1]
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// Writes the request, the response headers and the (truncated) response body of a failed check
+// to FailureDir and returns the path, or "" if nothing was written.
+func captureFailure(a *CheckAction, res *http.Response, body *bytes.Buffer, err error) string {
+	if FailureDir == "" {
+		return ""
+	}
+	n := atomic.AddInt32(&failureCaptureCounter, 1)
+	if int(n) > parameter.FailureCaptureMaxFiles {
+		return ""
+	}
+
+	scenario := CallerScenario()
+	if scenario == "" {
+		scenario = "unknown"
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# %v\n# %v\n\n", time.Now(), err)
+
+	if b, err := httputil.DumpRequest(res.Request, false); err == nil {
+		buf.Write(b)
+	}
+	if a.PostData != nil {
+		fmt.Fprintf(buf, "%+v\n", a.PostData)
+	} else if a.PostJSON != nil {
+		fmt.Fprintf(buf, "%+v\n", a.PostJSON)
+	}
+	buf.WriteString("\n")
+
+	if b, err := httputil.DumpResponse(res, false); err == nil {
+		buf.Write(b)
+	}
+	if body != nil {
+		b := body.Bytes()
+		if len(b) > parameter.FailureCaptureMaxBody {
+			buf.Write(b[:parameter.FailureCaptureMaxBody])
+			fmt.Fprintf(buf, "\n... (truncated, %d bytes in total)\n", len(b))
+		} else {
+			buf.Write(b)
+		}
+	}
+
+	if err := os.MkdirAll(FailureDir, 0755); err != nil {
+		log.Println("warn: failed to capture the failure", err)
+		return ""
+	}
+	path := filepath.Join(FailureDir, fmt.Sprintf("%s-%d.txt", scenario, n))
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		log.Println("warn: failed to capture the failure", err)
+		return ""
+	}
+	return path
+}
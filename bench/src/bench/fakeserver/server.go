@@ -0,0 +1,769 @@
+package fakeserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bench"
+)
+
+// In-memory imitation of the torb webapp used by the benchmarker self checks.
+// It follows the API of webapp/ruby/lib/torb/web.rb closely enough to let every scenario run,
+// but it does not render the real HTML, so DOM digest checks are expected to fail. Static files are
+// served from StaticDir as they are.
+
+const sessionCookieName = "torb_session"
+
+type user struct {
+	ID        uint   `json:"id"`
+	Nickname  string `json:"nickname"`
+	loginName string
+	password  string
+}
+
+type event struct {
+	ID       uint
+	Title    string
+	PublicFg bool
+	ClosedFg bool
+	Price    uint
+}
+
+type reservation struct {
+	ID         uint
+	EventID    uint
+	SheetRank  string
+	SheetNum   uint
+	UserID     uint
+	ReservedAt time.Time
+	CanceledAt time.Time
+}
+
+type Server struct {
+	mtx sync.RWMutex
+
+	// webapp/static served for the static file checks (404 if empty)
+	StaticDir string
+
+	users         map[uint]*user
+	userByLogin   map[string]*user
+	admins        map[uint]*user
+	adminByLogin  map[string]*user
+	events        []*event
+	reservations  []*reservation
+	reservedSheet map[sheetKey]*reservation
+
+	sessions      map[string]uint
+	adminSessions map[string]uint
+}
+
+func New() *Server {
+	s := new(Server)
+	s.Initialize()
+	return s
+}
+
+// Resets the server to the initial data set, like GET /initialize does
+func (s *Server) Initialize() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.initializeLocked()
+}
+
+func (s *Server) initializeLocked() {
+	s.users = map[uint]*user{}
+	s.userByLogin = map[string]*user{}
+	for _, u := range bench.DataSet.Users {
+		fu := &user{u.ID, u.Nickname, u.LoginName, u.Password}
+		s.users[fu.ID] = fu
+		s.userByLogin[fu.loginName] = fu
+	}
+
+	s.admins = map[uint]*user{}
+	s.adminByLogin = map[string]*user{}
+	for _, a := range bench.DataSet.Administrators {
+		fa := &user{a.ID, a.Nickname, a.LoginName, a.Password}
+		s.admins[fa.ID] = fa
+		s.adminByLogin[fa.loginName] = fa
+	}
+
+	s.events = nil
+	for _, e := range append(append([]*bench.Event{}, bench.DataSet.Events...), bench.DataSet.ClosedEvents...) {
+		s.events = append(s.events, &event{e.ID, e.Title, e.PublicFg, e.ClosedFg, e.Price})
+	}
+
+	s.reservations = nil
+	s.reservedSheet = map[sheetKey]*reservation{}
+	for _, r := range bench.DataSet.Reservations {
+		fr := &reservation{
+			ID:         r.ID,
+			EventID:    r.EventID,
+			SheetRank:  r.SheetRank,
+			SheetNum:   r.SheetNum,
+			UserID:     r.UserID,
+			ReservedAt: time.Unix(r.ReservedAt, 0),
+		}
+		if r.CanceledAt != 0 {
+			fr.CanceledAt = time.Unix(r.CanceledAt, 0)
+		} else {
+			s.reservedSheet[sheetKey{fr.EventID, fr.SheetRank, fr.SheetNum}] = fr
+		}
+		s.reservations = append(s.reservations, fr)
+	}
+
+	s.sessions = map[string]uint{}
+	s.adminSessions = map[string]uint{}
+}
+
+// Starts the server on a loopback port. Returns "host:port" and a function to stop it.
+func (s *Server) Start() (string, func()) {
+	ts := httptest.NewServer(s)
+	return ts.Listener.Addr().String(), ts.Close
+}
+
+type sheetKey struct {
+	eventID uint
+	rank    string
+	num     uint
+}
+
+var (
+	reUser        = regexp.MustCompile(`^/api/users/(-?\d+)$`)
+	reEvent       = regexp.MustCompile(`^/api/events/(-?\d+)$`)
+	reReserve     = regexp.MustCompile(`^/api/events/(-?\d+)/actions/reserve$`)
+	reCancel      = regexp.MustCompile(`^/api/events/(-?\d+)/sheets/([^/]+)/(-?\d+)/reservation$`)
+	reAdminEvent  = regexp.MustCompile(`^/admin/api/events/(-?\d+)$`)
+	reAdminEdit   = regexp.MustCompile(`^/admin/api/events/(-?\d+)/actions/edit$`)
+	reEventReport = regexp.MustCompile(`^/admin/api/reports/events/(\d+)/sales$`)
+)
+
+func atoi(s string) uint {
+	n, _ := strconv.Atoi(s)
+	return uint(n)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	if r.Method == "GET" && p != "/initialize" && !isAPIPath(p) {
+		s.serveStatic(w, r)
+		return
+	}
+
+	// Handlers only read and write the state under the lock and leave the encoding of the response
+	// to res.writeTo, so that requests run concurrently as they do against the real app
+	res := newResponse()
+	if r.Method == "GET" && p != "/initialize" {
+		s.mtx.RLock()
+		s.handle(res, r)
+		s.mtx.RUnlock()
+	} else {
+		s.mtx.Lock()
+		s.handle(res, r)
+		s.mtx.Unlock()
+	}
+	res.writeTo(w)
+}
+
+func (s *Server) handle(w *response, r *http.Request) {
+	p := r.URL.Path
+	var m []string
+	switch {
+	case r.Method == "GET" && p == "/initialize":
+		s.initializeLocked()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "GET" && p == "/":
+		s.topPage(w, r)
+	case r.Method == "GET" && p == "/admin/":
+		s.adminPage(w, r)
+	case r.Method == "POST" && p == "/api/users":
+		s.createUser(w, r)
+	case r.Method == "POST" && p == "/api/actions/login":
+		s.login(w, r, false)
+	case r.Method == "POST" && p == "/api/actions/logout":
+		s.logout(w, r, false)
+	case r.Method == "POST" && p == "/admin/api/actions/login":
+		s.login(w, r, true)
+	case r.Method == "POST" && p == "/admin/api/actions/logout":
+		s.logout(w, r, true)
+	case r.Method == "GET" && p == "/api/events":
+		s.writeJSON(w, 200, s.eventList(false))
+	case r.Method == "GET" && p == "/admin/api/events":
+		if s.requireAdmin(w, r) {
+			s.writeJSON(w, 200, s.eventList(true))
+		}
+	case r.Method == "POST" && p == "/admin/api/events":
+		if s.requireAdmin(w, r) {
+			s.createEvent(w, r)
+		}
+	case r.Method == "GET" && p == "/admin/api/reports/sales":
+		if s.requireAdmin(w, r) {
+			s.report(w, 0)
+		}
+	case r.Method == "GET" && reUser.MatchString(p):
+		m = reUser.FindStringSubmatch(p)
+		s.getUser(w, r, atoi(m[1]))
+	case r.Method == "GET" && reEvent.MatchString(p):
+		m = reEvent.FindStringSubmatch(p)
+		s.getEvent(w, r, atoi(m[1]))
+	case r.Method == "POST" && reReserve.MatchString(p):
+		m = reReserve.FindStringSubmatch(p)
+		s.reserve(w, r, atoi(m[1]))
+	case r.Method == "DELETE" && reCancel.MatchString(p):
+		m = reCancel.FindStringSubmatch(p)
+		s.cancel(w, r, atoi(m[1]), m[2], atoi(m[3]))
+	case r.Method == "GET" && reAdminEvent.MatchString(p):
+		m = reAdminEvent.FindStringSubmatch(p)
+		if s.requireAdmin(w, r) {
+			s.adminGetEvent(w, atoi(m[1]))
+		}
+	case r.Method == "POST" && reAdminEdit.MatchString(p):
+		m = reAdminEdit.FindStringSubmatch(p)
+		if s.requireAdmin(w, r) {
+			s.editEvent(w, r, atoi(m[1]))
+		}
+	case r.Method == "GET" && reEventReport.MatchString(p):
+		m = reEventReport.FindStringSubmatch(p)
+		if s.requireAdmin(w, r) {
+			s.report(w, atoi(m[1]))
+		}
+	default:
+		s.writeError(w, 404, "not_found")
+	}
+}
+
+// Response of a handler, which is encoded by render after the lock is released
+type response struct {
+	header http.Header
+	status int
+	render func(io.Writer)
+}
+
+func newResponse() *response {
+	return &response{header: http.Header{}, status: 200}
+}
+
+func (res *response) Header() http.Header {
+	return res.header
+}
+
+func (res *response) WriteHeader(status int) {
+	res.status = status
+}
+
+func (res *response) writeTo(w http.ResponseWriter) {
+	for k, v := range res.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.status)
+	if res.render != nil {
+		res.render(w)
+	}
+}
+
+func isAPIPath(p string) bool {
+	return p == "/" || p == "/admin/" || strings.HasPrefix(p, "/api/") || strings.HasPrefix(p, "/admin/api/")
+}
+
+func (s *Server) serveStatic(w http.ResponseWriter, r *http.Request) {
+	if s.StaticDir == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.FileServer(http.Dir(s.StaticDir)).ServeHTTP(w, r)
+}
+
+func (s *Server) writeJSON(w *response, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.render = func(out io.Writer) {
+		json.NewEncoder(out).Encode(v)
+	}
+}
+
+func (s *Server) writeError(w *response, status int, code string) {
+	s.writeJSON(w, status, map[string]string{"error": code})
+}
+
+func (s *Server) sessionID(r *http.Request) string {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+func (s *Server) setSession(w *response, r *http.Request) string {
+	id := s.sessionID(r)
+	if id == "" {
+		id = bench.RandomAlphabetString(32)
+		cookie := &http.Cookie{Name: sessionCookieName, Value: id, Path: "/", MaxAge: 3600, HttpOnly: true}
+		w.Header().Add("Set-Cookie", cookie.String())
+	}
+	return id
+}
+
+func (s *Server) loginUser(r *http.Request) *user {
+	return s.users[s.sessions[s.sessionID(r)]]
+}
+
+func (s *Server) loginAdmin(r *http.Request) *user {
+	return s.admins[s.adminSessions[s.sessionID(r)]]
+}
+
+func (s *Server) requireAdmin(w *response, r *http.Request) bool {
+	if s.loginAdmin(r) == nil {
+		s.writeError(w, 401, "admin_login_required")
+		return false
+	}
+	return true
+}
+
+func (s *Server) findEvent(id uint) *event {
+	for _, e := range s.events {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *Server) eventJSON(e *event, loginUserID uint, detail bool, full bool) map[string]interface{} {
+	total, remains := 0, 0
+	sheets := map[string]interface{}{}
+	for _, kind := range bench.DataSet.SheetKinds {
+		rankRemains := 0
+		details := []map[string]interface{}{}
+		for num := uint(1); num <= kind.Total; num++ {
+			r, reserved := s.reservedSheet[sheetKey{e.ID, kind.Rank, num}]
+			if !reserved {
+				rankRemains++
+			}
+			if !detail {
+				continue
+			}
+			d := map[string]interface{}{"num": num}
+			if reserved {
+				d["reserved"] = true
+				d["reserved_at"] = r.ReservedAt.Unix()
+				if loginUserID != 0 && r.UserID == loginUserID {
+					d["mine"] = true
+				}
+			}
+			details = append(details, d)
+		}
+		sheet := map[string]interface{}{
+			"price":   e.Price + kind.Price,
+			"total":   kind.Total,
+			"remains": rankRemains,
+		}
+		if detail {
+			sheet["detail"] = details
+		}
+		sheets[kind.Rank] = sheet
+		total += int(kind.Total)
+		remains += rankRemains
+	}
+
+	v := map[string]interface{}{
+		"id":      e.ID,
+		"title":   e.Title,
+		"total":   total,
+		"remains": remains,
+		"sheets":  sheets,
+	}
+	if full {
+		v["price"] = e.Price
+		v["public"] = e.PublicFg
+		v["closed"] = e.ClosedFg
+	}
+	return v
+}
+
+func (s *Server) eventList(all bool) []map[string]interface{} {
+	events := []map[string]interface{}{}
+	for _, e := range s.events {
+		if all || e.PublicFg {
+			events = append(events, s.eventJSON(e, 0, false, all))
+		}
+	}
+	return events
+}
+
+// Decodes the JSON object of the request body, or writes 400 and returns false if it is not
+func (s *Server) decodeBody(w *response, r *http.Request) (map[string]interface{}, bool) {
+	v := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		s.writeError(w, 400, "invalid_json")
+		return nil, false
+	}
+	return v, true
+}
+
+func (s *Server) renderPage(w *response, attrs map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(200)
+	w.render = func(out io.Writer) {
+		buf := new(bytes.Buffer)
+		buf.WriteString(`<!DOCTYPE html><html><head><title>torb</title></head><body><div id="app-wrapper"`)
+		keys := make([]string, 0, len(attrs))
+		for k := range attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b, _ := json.Marshal(attrs[k])
+			fmt.Fprintf(buf, ` %s="%s"`, k, html.EscapeString(string(b)))
+		}
+		buf.WriteString(`></div></body></html>`)
+		out.Write(buf.Bytes())
+	}
+}
+
+func (s *Server) topPage(w *response, r *http.Request) {
+	var loginUser interface{}
+	if u := s.loginUser(r); u != nil {
+		loginUser = u
+	}
+	s.renderPage(w, map[string]interface{}{
+		"data-events":     s.eventList(false),
+		"data-login-user": loginUser,
+	})
+}
+
+func (s *Server) adminPage(w *response, r *http.Request) {
+	var admin interface{}
+	events := []map[string]interface{}{}
+	if a := s.loginAdmin(r); a != nil {
+		admin = a
+		events = s.eventList(true)
+	}
+	s.renderPage(w, map[string]interface{}{
+		"data-events":        events,
+		"data-administrator": admin,
+	})
+}
+
+func (s *Server) createUser(w *response, r *http.Request) {
+	body, ok := s.decodeBody(w, r)
+	if !ok {
+		return
+	}
+	nickname, _ := body["nickname"].(string)
+	loginName, _ := body["login_name"].(string)
+	password, _ := body["password"].(string)
+
+	if _, ok := s.userByLogin[loginName]; ok {
+		s.writeError(w, 409, "duplicated")
+		return
+	}
+
+	u := &user{uint(len(s.users) + 1), nickname, loginName, password}
+	for s.users[u.ID] != nil {
+		u.ID++
+	}
+	s.users[u.ID] = u
+	s.userByLogin[loginName] = u
+	s.writeJSON(w, 201, u)
+}
+
+func (s *Server) login(w *response, r *http.Request, admin bool) {
+	body, ok := s.decodeBody(w, r)
+	if !ok {
+		return
+	}
+	loginName, _ := body["login_name"].(string)
+	password, _ := body["password"].(string)
+
+	byLogin, sessions := s.userByLogin, s.sessions
+	if admin {
+		byLogin, sessions = s.adminByLogin, s.adminSessions
+	}
+
+	u, ok := byLogin[loginName]
+	if !ok || u.password != password {
+		s.writeError(w, 401, "authentication_failed")
+		return
+	}
+
+	sessions[s.setSession(w, r)] = u.ID
+	s.writeJSON(w, 200, u)
+}
+
+func (s *Server) logout(w *response, r *http.Request, admin bool) {
+	sessions, code := s.sessions, "login_required"
+	if admin {
+		sessions, code = s.adminSessions, "admin_login_required"
+	}
+
+	id := s.sessionID(r)
+	if _, ok := sessions[id]; !ok {
+		s.writeError(w, 401, code)
+		return
+	}
+	delete(sessions, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getUser(w *response, r *http.Request, id uint) {
+	u := s.loginUser(r)
+	if u == nil {
+		s.writeError(w, 401, "login_required")
+		return
+	}
+	if u.ID != id {
+		s.writeError(w, 403, "forbidden")
+		return
+	}
+
+	var mine []*reservation
+	var totalPrice uint
+	for _, rv := range s.reservations {
+		if rv.UserID != u.ID {
+			continue
+		}
+		mine = append(mine, rv)
+		if rv.CanceledAt.IsZero() {
+			totalPrice += s.findEvent(rv.EventID).Price + bench.DataSet.SheetKindMap[rv.SheetRank].Price
+		}
+	}
+	updatedAt := func(rv *reservation) time.Time {
+		if rv.CanceledAt.IsZero() {
+			return rv.ReservedAt
+		}
+		return rv.CanceledAt
+	}
+	sort.SliceStable(mine, func(i, j int) bool { return updatedAt(mine[i]).After(updatedAt(mine[j])) })
+
+	recentReservations := []map[string]interface{}{}
+	recentEvents := []map[string]interface{}{}
+	seen := map[uint]bool{}
+	for _, rv := range mine {
+		e := s.findEvent(rv.EventID)
+		if len(recentReservations) < 5 {
+			var canceledAt int64
+			if !rv.CanceledAt.IsZero() {
+				canceledAt = rv.CanceledAt.Unix()
+			}
+			recentReservations = append(recentReservations, map[string]interface{}{
+				"id":          rv.ID,
+				"event":       map[string]interface{}{"id": e.ID, "title": e.Title, "public": e.PublicFg, "closed": e.ClosedFg, "price": e.Price},
+				"sheet_rank":  rv.SheetRank,
+				"sheet_num":   rv.SheetNum,
+				"price":       e.Price + bench.DataSet.SheetKindMap[rv.SheetRank].Price,
+				"reserved_at": rv.ReservedAt.Unix(),
+				"canceled_at": canceledAt,
+			})
+		}
+		if len(recentEvents) < 5 && !seen[e.ID] {
+			seen[e.ID] = true
+			recentEvents = append(recentEvents, s.eventJSON(e, 0, false, true))
+		}
+	}
+
+	s.writeJSON(w, 200, map[string]interface{}{
+		"id":                  u.ID,
+		"nickname":            u.Nickname,
+		"total_price":         totalPrice,
+		"recent_reservations": recentReservations,
+		"recent_events":       recentEvents,
+	})
+}
+
+func (s *Server) getEvent(w *response, r *http.Request, id uint) {
+	e := s.findEvent(id)
+	if e == nil || !e.PublicFg {
+		s.writeError(w, 404, "not_found")
+		return
+	}
+
+	var loginUserID uint
+	if u := s.loginUser(r); u != nil {
+		loginUserID = u.ID
+	}
+	s.writeJSON(w, 200, s.eventJSON(e, loginUserID, true, false))
+}
+
+func (s *Server) reserve(w *response, r *http.Request, id uint) {
+	u := s.loginUser(r)
+	if u == nil {
+		s.writeError(w, 401, "login_required")
+		return
+	}
+
+	body, ok := s.decodeBody(w, r)
+	if !ok {
+		return
+	}
+	rank, _ := body["sheet_rank"].(string)
+	e := s.findEvent(id)
+	if e == nil || !e.PublicFg {
+		s.writeError(w, 404, "invalid_event")
+		return
+	}
+	kind, ok := bench.DataSet.SheetKindMap[rank]
+	if !ok {
+		s.writeError(w, 400, "invalid_rank")
+		return
+	}
+
+	var free []uint
+	for num := uint(1); num <= kind.Total; num++ {
+		if _, ok := s.reservedSheet[sheetKey{e.ID, rank, num}]; !ok {
+			free = append(free, num)
+		}
+	}
+	if len(free) == 0 {
+		s.writeError(w, 409, "sold_out")
+		return
+	}
+
+	rv := &reservation{
+		ID:         uint(len(s.reservations) + 1),
+		EventID:    e.ID,
+		SheetRank:  rank,
+		SheetNum:   free[rand.Intn(len(free))],
+		UserID:     u.ID,
+		ReservedAt: time.Now(),
+	}
+	s.reservations = append(s.reservations, rv)
+	s.reservedSheet[sheetKey{e.ID, rank, rv.SheetNum}] = rv
+
+	s.writeJSON(w, 202, map[string]interface{}{"id": rv.ID, "sheet_rank": rank, "sheet_num": rv.SheetNum})
+}
+
+func (s *Server) cancel(w *response, r *http.Request, id uint, rank string, num uint) {
+	u := s.loginUser(r)
+	if u == nil {
+		s.writeError(w, 401, "login_required")
+		return
+	}
+
+	e := s.findEvent(id)
+	if e == nil || !e.PublicFg {
+		s.writeError(w, 404, "invalid_event")
+		return
+	}
+	kind, ok := bench.DataSet.SheetKindMap[rank]
+	if !ok {
+		s.writeError(w, 404, "invalid_rank")
+		return
+	}
+	if num < 1 || kind.Total < num {
+		s.writeError(w, 404, "invalid_sheet")
+		return
+	}
+
+	key := sheetKey{e.ID, rank, num}
+	rv, ok := s.reservedSheet[key]
+	if !ok {
+		s.writeError(w, 400, "not_reserved")
+		return
+	}
+	if rv.UserID != u.ID {
+		s.writeError(w, 403, "not_permitted")
+		return
+	}
+
+	rv.CanceledAt = time.Now()
+	delete(s.reservedSheet, key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) createEvent(w *response, r *http.Request) {
+	body, ok := s.decodeBody(w, r)
+	if !ok {
+		return
+	}
+	title, _ := body["title"].(string)
+	public, _ := body["public"].(bool)
+	price, _ := body["price"].(float64)
+
+	e := &event{uint(len(s.events) + 1), title, public, false, uint(price)}
+	s.events = append(s.events, e)
+	s.writeJSON(w, 200, s.eventJSON(e, 0, true, true))
+}
+
+func (s *Server) adminGetEvent(w *response, id uint) {
+	e := s.findEvent(id)
+	if e == nil {
+		s.writeError(w, 404, "not_found")
+		return
+	}
+	s.writeJSON(w, 200, s.eventJSON(e, 0, true, true))
+}
+
+func (s *Server) editEvent(w *response, r *http.Request, id uint) {
+	body, ok := s.decodeBody(w, r)
+	if !ok {
+		return
+	}
+	public, _ := body["public"].(bool)
+	closed, _ := body["closed"].(bool)
+	if closed {
+		public = false
+	}
+
+	e := s.findEvent(id)
+	if e == nil {
+		s.writeError(w, 404, "not_found")
+		return
+	}
+	if e.ClosedFg {
+		s.writeError(w, 400, "cannot_edit_closed_event")
+		return
+	} else if e.PublicFg && closed {
+		s.writeError(w, 400, "cannot_close_public_event")
+		return
+	}
+
+	e.PublicFg = public
+	e.ClosedFg = closed
+	s.writeJSON(w, 200, s.eventJSON(e, 0, true, true))
+}
+
+// Writes the sales report of the event, or of all events if eventID is 0.
+// The reservations are copied under the lock and formatted after it is released.
+func (s *Server) report(w *response, eventID uint) {
+	type row struct {
+		reservation
+		price uint
+	}
+	var rows []row
+	for _, rv := range s.reservations {
+		if eventID != 0 && rv.EventID != eventID {
+			continue
+		}
+		price := s.findEvent(rv.EventID).Price + bench.DataSet.SheetKindMap[rv.SheetRank].Price
+		rows = append(rows, row{*rv, price})
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="report.csv"`)
+	w.WriteHeader(200)
+	w.render = func(out io.Writer) {
+		buf := bufio.NewWriter(out)
+		buf.WriteString("reservation_id,event_id,rank,num,price,user_id,sold_at,canceled_at\n")
+		for _, rv := range rows {
+			canceledAt := ""
+			if !rv.CanceledAt.IsZero() {
+				canceledAt = rv.CanceledAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(buf, "%d,%d,%s,%d,%d,%d,%s,%s\n", rv.ID, rv.EventID, rv.SheetRank, rv.SheetNum, rv.price, rv.UserID, rv.ReservedAt.UTC().Format(time.RFC3339), canceledAt)
+		}
+		buf.Flush()
+	}
+}
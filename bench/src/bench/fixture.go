@@ -0,0 +1,53 @@
+package bench
+
+import (
+	"context"
+	"sync"
+)
+
+// Checks pass what they create to the checks which depend on them through Fixtures in the context,
+// e.g. CheckLogin logs in as the user CheckCreateUser created. The benchmarker gives the preTest and
+// each round of the checks during the load their own Fixtures. A check without a fixture, such as
+// when it runs alone, falls back to picking from the state.
+type Fixtures struct {
+	mu sync.Mutex
+	m  map[string]interface{}
+}
+
+type fixturesKey struct{}
+
+const (
+	fixtureCreatedUserID  = "CheckCreateUser.UserID"
+	fixtureCreatedEventID = "CheckCreateEvent.EventID"
+)
+
+func NewFixtures() *Fixtures {
+	return &Fixtures{m: map[string]interface{}{}}
+}
+
+func WithFixtures(ctx context.Context, f *Fixtures) context.Context {
+	return context.WithValue(ctx, fixturesKey{}, f)
+}
+
+func putFixture(ctx context.Context, key string, v interface{}) {
+	f, ok := ctx.Value(fixturesKey{}).(*Fixtures)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.m[key] = v
+}
+
+// Returns the fixture of key, and deletes it so that only one check uses it
+func takeFixture(ctx context.Context, key string) (interface{}, bool) {
+	f, ok := ctx.Value(fixturesKey{}).(*Fixtures)
+	if !ok {
+		return nil, false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.m[key]
+	delete(f.m, key)
+	return v, ok
+}
@@ -0,0 +1,149 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"bench/parameter"
+)
+
+// FuzzAllowReferenceErrors accepts the 500s which the reference app (webapp/ruby) answers to some
+// inputs of CheckFuzzInput: malformed or non-object JSON and form bodies (JSON.parse raises),
+// registrations with multibyte strings, /api/users/<id> of unknown users (nil user) and a numeric
+// sheet_rank. Off by default, so these have to be 4xx.
+var FuzzAllowReferenceErrors = false
+
+// An input which the app must reject with a 4xx rather than fail with a 5xx.
+// If allowSuccess, the input is odd but valid and the app may accept it. If referenceError, the
+// reference app fails on it with 500, which is accepted only with FuzzAllowReferenceErrors.
+type fuzzCase struct {
+	checker        *Checker
+	method         string
+	path           string
+	contentType    string
+	body           string
+	allowSuccess   bool
+	referenceError bool
+	description    string
+}
+
+const (
+	fuzzOverflowID    = "99999999999999999999"
+	fuzzMultibyte     = "🎫チケット🍣𠮷"
+	fuzzMalformedJSON = `{"login_name": "`
+)
+
+func fuzzJSON(kv ...string) string {
+	var fields []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields = append(fields, fmt.Sprintf("%q:%q", kv[i], kv[i+1]))
+	}
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+func checkControlledError(allowSuccess, allowServerError bool) func(res *http.Response, body *bytes.Buffer) error {
+	return func(res *http.Response, body *bytes.Buffer) error {
+		switch {
+		case allowServerError && 500 <= res.StatusCode:
+			return nil
+		case 500 <= res.StatusCode:
+			return withErrorCode(ErrorCodeServerError, "", res.Status, errorf("不正な入力に対してサーバエラーが発生しました。%s", res.Status))
+		case 400 <= res.StatusCode:
+			return nil
+		case allowSuccess && 200 <= res.StatusCode && res.StatusCode < 300:
+			return nil
+		default:
+			return withErrorCode(ErrorCodeWrongStatus, "4xx", res.Status, errorf("不正な入力が受け付けられました。%s", res.Status))
+		}
+	}
+}
+
+// 壊れたJSON、誤ったContent-Type、巨大なリクエスト、範囲外のID、マルチバイト文字に対して5xxではなく4xxを返すこと
+// NOTE: Registrations with multibyte strings may succeed. They use random login names and the
+// users are unknown to State, so they do not affect other checks.
+func CheckFuzzInput(ctx context.Context, state *State) error {
+	user, userChecker, userPush := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer userPush()
+
+	admin, adminChecker, adminPush := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer adminPush()
+
+	err := loginAppUser(ctx, userChecker, user)
+	if err != nil {
+		return err
+	}
+	err = loginAdministrator(ctx, adminChecker, admin)
+	if err != nil {
+		return err
+	}
+
+	anonymous := NewChecker()
+	rank := GetRandomSheetRank()
+	oversized := strings.Repeat("a", parameter.FuzzOversizedBodySize)
+	unknownLogin := RandomAlphabetString(32)
+
+	cases := []fuzzCase{
+		{anonymous, "POST", "/api/users", "application/json", fuzzMalformedJSON, false, true, "壊れたJSONでユーザを作成しようとするとエラーになること"},
+		{anonymous, "POST", "/api/users", "application/json", `["nickname", "login_name", "password"]`, false, true, "オブジェクトでないJSONでユーザを作成しようとするとエラーになること"},
+		{anonymous, "POST", "/api/users", "application/x-www-form-urlencoded", "nickname=" + RandomAlphabetString(16) + "&login_name=" + RandomAlphabetString(32) + "&password=" + RandomAlphabetString(16), true, true, "フォーム形式でユーザを作成しようとしても応答が返ること"},
+		{anonymous, "POST", "/api/users", "application/json", fuzzJSON("nickname", fuzzMultibyte, "login_name", RandomAlphabetString(16)+fuzzMultibyte, "password", fuzzMultibyte), true, true, "マルチバイト文字でユーザを作成しても応答が返ること"},
+		{anonymous, "POST", "/api/actions/login", "application/json", fuzzMalformedJSON, false, true, "壊れたJSONでログインしようとするとエラーになること"},
+		{anonymous, "POST", "/api/actions/login", "text/plain", fuzzJSON("login_name", unknownLogin, "password", unknownLogin), false, false, "誤ったContent-Typeで存在しないユーザとしてログインしようとするとエラーになること"},
+		{anonymous, "POST", "/api/actions/login", "application/json", fuzzJSON("login_name", fuzzMultibyte, "password", fuzzMultibyte), false, false, "マルチバイト文字の存在しないユーザとしてログインしようとするとエラーになること"},
+		{anonymous, "POST", "/api/actions/login", "application/json", fuzzJSON("login_name", oversized, "password", oversized), false, false, "巨大なリクエストでログインしようとするとエラーになること"},
+		{anonymous, "POST", "/admin/api/actions/login", "application/json", fuzzMalformedJSON, false, true, "壊れたJSONで管理者としてログインしようとするとエラーになること"},
+		{anonymous, "POST", "/admin/api/actions/login", "application/json", fuzzJSON("login_name", admin.LoginName, "password", oversized), false, false, "巨大なパスワードで管理者としてログインしようとするとエラーになること"},
+		{anonymous, "GET", "/api/events/-1", "", "", false, false, "負のIDのイベントを取得しようとするとエラーになること"},
+		{anonymous, "GET", "/api/events/" + fuzzOverflowID, "", "", false, false, "範囲外のIDのイベントを取得しようとするとエラーになること"},
+		{userChecker, "GET", "/api/users/-1", "", "", false, true, "負のIDのユーザ情報を取得しようとするとエラーになること"},
+		{userChecker, "GET", "/api/users/" + fuzzOverflowID, "", "", false, true, "範囲外のIDのユーザ情報を取得しようとするとエラーになること"},
+		{userChecker, "POST", "/api/events/-1/actions/reserve", "application/json", fuzzJSON("sheet_rank", rank), false, false, "負のIDのイベントのシートを予約しようとするとエラーになること"},
+		{userChecker, "POST", "/api/events/" + fuzzOverflowID + "/actions/reserve", "application/json", fuzzJSON("sheet_rank", rank), false, false, "範囲外のIDのイベントのシートを予約しようとするとエラーになること"},
+		{adminChecker, "GET", "/admin/api/events/-1", "", "", false, false, "負のIDのイベントを管理者が取得しようとするとエラーになること"},
+		{adminChecker, "GET", "/admin/api/events/" + fuzzOverflowID, "", "", false, false, "範囲外のIDのイベントを管理者が取得しようとするとエラーになること"},
+		{adminChecker, "POST", "/admin/api/events/-1/actions/edit", "application/json", `{"public":false,"closed":true}`, false, false, "負のIDのイベントを編集しようとするとエラーになること"},
+		{adminChecker, "POST", "/admin/api/events", "application/json", fuzzMalformedJSON, false, true, "壊れたJSONでイベントを作成しようとするとエラーになること"},
+	}
+
+	// Invalid reservations of an existing event, which have no side effect unless the app wrongly accepts them
+	if event := state.GetRandomPublicEvent(); event != nil {
+		reservePath := fmt.Sprintf("/api/events/%d/actions/reserve", event.ID)
+		cases = append(cases,
+			fuzzCase{userChecker, "POST", reservePath, "application/json", fuzzMalformedJSON, false, true, "壊れたJSONでシートを予約しようとするとエラーになること"},
+			fuzzCase{userChecker, "POST", reservePath, "application/x-www-form-urlencoded", "sheet_rank=" + fuzzMultibyte, false, true, "誤ったContent-Typeで存在しないランクのシートを予約しようとするとエラーになること"},
+			fuzzCase{userChecker, "POST", reservePath, "application/json", fuzzJSON("sheet_rank", fuzzMultibyte), false, false, "マルチバイト文字のランクのシートを予約しようとするとエラーになること"},
+			fuzzCase{userChecker, "POST", reservePath, "application/json", `{"sheet_rank":` + fuzzOverflowID + `}`, false, true, "数値のランクのシートを予約しようとするとエラーになること"},
+			fuzzCase{userChecker, "POST", reservePath, "application/json", fuzzJSON("sheet_rank", oversized), false, false, "巨大なランクのシートを予約しようとするとエラーになること"},
+			fuzzCase{userChecker, "DELETE", fmt.Sprintf("/api/events/%d/sheets/%s/-1/reservation", event.ID, rank), "", "", false, false, "負の番号のシートをキャンセルしようとするとエラーになること"},
+		)
+	}
+
+	for _, c := range cases {
+		a := &CheckAction{
+			Method:           c.method,
+			Path:             c.path,
+			AllowServerError: true,
+			Description:      c.description,
+			CheckFunc:        checkControlledError(c.allowSuccess, c.referenceError && FuzzAllowReferenceErrors),
+		}
+		if c.method == "POST" {
+			a.PostBody = strings.NewReader(c.body)
+			a.ContentType = c.contentType
+		}
+		err := c.checker.Play(ctx, a)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"bench/parameter"
+)
+
+// Fraction of requests recorded in HTTP Archive format. Disabled if 0.
+var HARSampleRate = 0.0
+
+var (
+	harMtx     sync.Mutex
+	harEntries []*harEntry
+)
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Scenario        string      `json:"_scenario,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			headers = append(headers, harNameValue{name, v})
+		}
+	}
+	return headers
+}
+
+func harQueryString(u *url.URL) []harNameValue {
+	qs := []harNameValue{}
+	for name, values := range u.Query() {
+		for _, v := range values {
+			qs = append(qs, harNameValue{name, v})
+		}
+	}
+	return qs
+}
+
+func harRequestBody(a *CheckAction) []byte {
+	if a.PostData != nil {
+		formData := url.Values{}
+		for key, val := range a.PostData {
+			formData.Set(key, val)
+		}
+		return []byte(formData.Encode())
+	}
+	if a.PostJSON != nil {
+		b, _ := json.Marshal(a.PostJSON)
+		return b
+	}
+	if seeker, ok := a.PostBody.(io.Seeker); ok {
+		seeker.Seek(0, 0)
+		b, _ := ioutil.ReadAll(a.PostBody)
+		return b
+	}
+	return nil
+}
+
+// Records a sampled request and its response. body is the response body as received.
+func recordHAR(a *CheckAction, res *http.Response, body *bytes.Buffer, startedAt time.Time, latency time.Duration) {
+	if HARSampleRate <= 0 || rand.Float64() >= HARSampleRate {
+		return
+	}
+
+	harMtx.Lock()
+	full := len(harEntries) >= parameter.HARMaxEntries
+	harMtx.Unlock()
+	if full {
+		return
+	}
+
+	req := res.Request
+	ms := float64(latency) / float64(time.Millisecond)
+	entry := &harEntry{
+		StartedDateTime: startedAt,
+		Time:            ms,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.Header),
+			QueryString: harQueryString(req.URL),
+			HeadersSize: -1,
+			BodySize:    0,
+		},
+		Response: harResponse{
+			Status:      res.StatusCode,
+			StatusText:  http.StatusText(res.StatusCode),
+			HTTPVersion: res.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(res.Header),
+			RedirectURL: res.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    body.Len(),
+		},
+		Timings:  harTimings{Send: 0, Wait: ms, Receive: 0},
+		Scenario: CallerScenario(),
+	}
+
+	if b := harRequestBody(a); b != nil {
+		entry.Request.BodySize = len(b)
+		entry.Request.PostData = &harPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     string(b),
+		}
+	}
+
+	content := body.Bytes()
+	if strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") && body.Len() > 0 {
+		if decoded, err := gunzipBuffer(body); err == nil {
+			content = append([]byte(nil), decoded.Bytes()...)
+			PutBuffer(decoded)
+		}
+	}
+	entry.Response.Content = harContent{
+		Size:     len(content),
+		MimeType: res.Header.Get("Content-Type"),
+	}
+	if utf8.Valid(content) {
+		entry.Response.Content.Text = string(content)
+	} else {
+		entry.Response.Content.Text = base64.StdEncoding.EncodeToString(content)
+		entry.Response.Content.Encoding = "base64"
+	}
+
+	harMtx.Lock()
+	harEntries = append(harEntries, entry)
+	harMtx.Unlock()
+}
+
+// Writes the recorded requests as an HTTP Archive
+func WriteHAR(w io.Writer) error {
+	harMtx.Lock()
+	defer harMtx.Unlock()
+
+	entries := harEntries
+	if entries == nil {
+		entries = []*harEntry{}
+	}
+	return json.NewEncoder(w).Encode(map[string]*harLog{
+		"log": &harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: UserAgent, Version: "1.0"},
+			Entries: entries,
+		},
+	})
+}
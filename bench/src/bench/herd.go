@@ -0,0 +1,236 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bench/parameter"
+)
+
+// Contention of the reservations on a single hot event, which the random load spread over many events
+// does not cause. The latencies of the bursts are kept apart from the endpoint stats, so that they do
+// not hide in (or block the level up of) the reserve API as a whole.
+type ThunderingHerdResult struct {
+	Bursts   int64   `json:"bursts"`
+	Requests int64   `json:"requests"`
+	Winners  int64   `json:"winners"`
+	Losers   int64   `json:"losers"` // got 409 sold_out
+	P50Ms    float64 `json:"p50_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+}
+
+var (
+	herdRunning int32
+
+	herdMtx     sync.Mutex
+	herdBursts  int64
+	herdWinners int64
+	herdLosers  int64
+	herdStat    = EndpointStat{Endpoint: "POST|/api/events/*/actions/reserve"}
+)
+
+func recordHerdBurst(latencies []time.Duration, winners, losers int) {
+	herdMtx.Lock()
+	defer herdMtx.Unlock()
+
+	herdBursts++
+	herdWinners += int64(winners)
+	herdLosers += int64(losers)
+	for _, latency := range latencies {
+		herdStat.add(latency, true)
+	}
+}
+
+// Returns nil if no burst has finished
+func GetThunderingHerdResult() *ThunderingHerdResult {
+	herdMtx.Lock()
+	defer herdMtx.Unlock()
+
+	if herdBursts == 0 {
+		return nil
+	}
+	ms := func(p float64) float64 {
+		return float64(herdStat.Percentile(p)) / float64(time.Millisecond)
+	}
+	return &ThunderingHerdResult{
+		Bursts:   herdBursts,
+		Requests: herdStat.Requests,
+		Winners:  herdWinners,
+		Losers:   herdLosers,
+		P50Ms:    ms(50),
+		P95Ms:    ms(95),
+		P99Ms:    ms(99),
+	}
+}
+
+// 作成されたばかりのイベントの同じランクの席を、席数より多いユーザが一斉に予約しようとする
+// 席数ちょうどのユーザだけが別々の席を予約でき、残りのユーザは売り切れになること
+func LoadThunderingHerd(ctx context.Context, state *State) error {
+	// one burst at a time, each of them takes many users
+	if !atomic.CompareAndSwapInt32(&herdRunning, 0, 1) {
+		return nil
+	}
+	defer atomic.StoreInt32(&herdRunning, 0)
+
+	// The rank which has the fewest sheets
+	sheetKind := DataSet.SheetKinds[0]
+	for _, sk := range DataSet.SheetKinds {
+		if sk.Total < sheetKind.Total {
+			sheetKind = sk
+		}
+	}
+	rank := sheetKind.Rank
+
+	admin, adminChecker, adminPush := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer adminPush()
+
+	var users []*AppUser
+	var checkers []*Checker
+	for i := 0; i < parameter.ThunderingHerdUsers; i++ {
+		user, checker, userPush := state.PopRandomUser()
+		if user == nil {
+			break
+		}
+		defer userPush()
+		users = append(users, user)
+		checkers = append(checkers, checker)
+	}
+	if len(users) < 2 {
+		return nil
+	}
+
+	err := loginAdministrator(ctx, adminChecker, admin)
+	if err != nil {
+		return err
+	}
+
+	event, _ := state.CreateNewEvent()
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/admin/api/events",
+		ExpectedStatusCode: 200,
+		Description:        "管理者がイベントを作成できること",
+		PostJSON:           eventPostJSON(event),
+		CheckFunc:          checkJsonFullEventCreateResponse(event),
+	})
+	if err != nil {
+		return err
+	}
+	// nobody else reserves the rank, so that the winners are known
+	state.PushNewEventWithoutRank(event, time.Now(), "LoadThunderingHerd", rank)
+
+	errs := make([]error, len(users))
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = loginAppUser(ctx, checkers[i], users[i])
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	eventSheets := make([]*EventSheet, len(users))
+	reservations := make([]*Reservation, len(users))
+	latencies := make([]time.Duration, len(users))
+	start := make(chan struct{})
+	for i := range users {
+		eventSheets[i] = &EventSheet{event.ID, rank, NonReservedNum, event.Price + sheetKind.Price}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			t := time.Now()
+			reservations[i], _, errs[i] = tryReserveSheet(ctx, state, checkers[i], users[i], eventSheets[i])
+			latencies[i] = time.Since(t)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// NOTE: push after the validation, otherwise the sheets may be canceled by other scenarios
+	winners := 0
+	for i, reservation := range reservations {
+		if reservation != nil {
+			winners++
+			eventSheets[i].Num = reservation.SheetNum
+			defer state.PushEventSheet(eventSheets[i])
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	recordHerdBurst(latencies, winners, len(users)-winners)
+
+	// Record the errors as the reserve API's ones since they are not detected in a single response
+	action := &CheckAction{Method: "POST", Path: fmt.Sprintf("/api/events/%d/actions/reserve", event.ID)}
+	expected := len(users)
+	if uint(expected) > sheetKind.Total {
+		expected = int(sheetKind.Total)
+	}
+	if winners != expected {
+		err := fatalErrorf("イベント(id:%d)の%s席に一斉に予約した%d件のうち%d件が成功しました (expected %d)", event.ID, rank, len(users), winners, expected)
+		return checkers[0].OnError(action, nil, withErrorCode(ErrorCodeConsistencyViolation, fmt.Sprint(expected), fmt.Sprint(winners), err))
+	}
+	owners := map[uint]uint{}
+	for _, reservation := range reservations {
+		if reservation == nil {
+			continue
+		}
+		if userID, ok := owners[reservation.SheetNum]; ok {
+			err := fatalErrorf("同じ席(event:%d %s)が複数のユーザ(%d, %d)に予約されました", event.ID, fmt.Sprintf("%s-%d", rank, reservation.SheetNum), userID, reservation.UserID)
+			return checkers[0].OnError(action, nil, withErrorCode(ErrorCodeConsistencyViolation, "", "", err))
+		}
+		owners[reservation.SheetNum] = reservation.UserID
+	}
+
+	// A winner sees their own sheet as mine and the others' as reserved but not mine
+	for i, reservation := range reservations {
+		if reservation == nil {
+			continue
+		}
+		return checkers[i].Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               fmt.Sprintf("/api/events/%d", event.ID),
+			ExpectedStatusCode: 200,
+			Description:        "一斉に予約した席がそれぞれ予約済みになっていること",
+			CheckFunc: checkJsonEventResponse(event, func(jsonEvent JsonEvent) error {
+				sheets := jsonEvent.Sheets[rank]
+				if sheets.Remains != sheetKind.Total-uint(winners) {
+					return fatalErrorf("イベント(id:%d)の%s席の残座席数が正しくありません", event.ID, rank)
+				}
+				for _, r := range reservations {
+					if r == nil {
+						continue
+					}
+					if r.SheetNum < 1 || int(r.SheetNum) > len(sheets.Details) {
+						return fatalErrorf("イベント(id:%d)の予約した席(%s-%d)が見つかりません", event.ID, rank, r.SheetNum)
+					}
+					detail := sheets.Details[r.SheetNum-1]
+					if !detail.Reserved {
+						return fatalErrorf("イベント(id:%d)の予約した席(%s-%d)が予約済みになっていません", event.ID, rank, r.SheetNum)
+					}
+					if detail.Mine != (r.UserID == reservation.UserID) {
+						return fatalErrorf("イベント(id:%d)の席(%s-%d)の予約者が正しくありません", event.ID, rank, r.SheetNum)
+					}
+				}
+				return nil
+			}),
+		})
+	}
+	return nil
+}
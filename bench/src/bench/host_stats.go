@@ -0,0 +1,88 @@
+package bench
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Requests, errors and latencies per target host, so that one of several -remotes which drags
+// the others down can be told. The latencies are kept in the buckets of EndpointStat.
+type HostStat struct {
+	Host     string  `json:"host"`
+	Requests int64   `json:"requests"`
+	Errors   int64   `json:"errors"` // failed requests including the failed checks of their responses
+	MeanMs   float64 `json:"mean_ms"`
+	P50Ms    float64 `json:"p50_ms"`
+	P95Ms    float64 `json:"p95_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+}
+
+type hostStat struct {
+	EndpointStat
+	total time.Duration
+}
+
+var (
+	hostStatsMtx sync.Mutex
+	hostStats    = map[string]*hostStat{}
+)
+
+// The target host a request is sent to is set by CheckerTransport into the *string in the context
+type targetHostKey struct{}
+
+func withTargetHost(ctx context.Context, host *string) context.Context {
+	return context.WithValue(ctx, targetHostKey{}, host)
+}
+
+func setTargetHost(ctx context.Context, host string) {
+	if p, ok := ctx.Value(targetHostKey{}).(*string); ok {
+		*p = host
+	}
+}
+
+func recordHostStat(host string, latency time.Duration, ok bool) {
+	hostStatsMtx.Lock()
+	defer hostStatsMtx.Unlock()
+
+	stat, found := hostStats[host]
+	if !found {
+		stat = &hostStat{EndpointStat: EndpointStat{Endpoint: host}}
+		hostStats[host] = stat
+	}
+	stat.add(latency, ok)
+	stat.total += latency
+}
+
+func ResetHostStats() {
+	hostStatsMtx.Lock()
+	defer hostStatsMtx.Unlock()
+
+	hostStats = map[string]*hostStat{}
+}
+
+// Returns the stats of the hosts in the order of GetTargetHosts, including the hosts with no requests
+func GetHostStats() []HostStat {
+	hosts := GetTargetHosts()
+
+	hostStatsMtx.Lock()
+	defer hostStatsMtx.Unlock()
+
+	stats := make([]HostStat, 0, len(hosts))
+	for _, host := range hosts {
+		s := HostStat{Host: host}
+		if stat, found := hostStats[host]; found && stat.Requests > 0 {
+			ms := func(d time.Duration) float64 {
+				return float64(d) / float64(time.Millisecond)
+			}
+			s.Requests = stat.Requests
+			s.Errors = stat.Errors
+			s.MeanMs = ms(stat.total) / float64(stat.Requests)
+			s.P50Ms = ms(stat.Percentile(50))
+			s.P95Ms = ms(stat.Percentile(95))
+			s.P99Ms = ms(stat.Percentile(99))
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
@@ -0,0 +1,208 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// StrictHTML validates the full structure of the top page and the admin page
+// against the reference markup instead of only the handful of parts read by the checkers.
+var StrictHTML = false
+
+type htmlPageSpec struct {
+	Name        string
+	IDs         []string
+	Scripts     []string
+	Stylesheets []string
+	DataAttrs   []string
+	EventKeys   []string
+}
+
+var (
+	indexPageSpec = htmlPageSpec{
+		Name: "トップページ",
+		IDs: []string{
+			"app-wrapper", "container", "menu-bar",
+			"confirm-modal", "event-modal", "my-page-modal", "login-modal", "register-modal",
+			"login-form-login-name", "login-form-password",
+			"register-form-login-name", "register-form-nickname", "register-form-password",
+		},
+		Scripts: []string{
+			"/js/jquery-3.3.1.slim.min.js", "/js/bootstrap.bundle.min.js", "/js/bootstrap-waitingfor.min.js",
+			"/js/vue.min.js", "/js/fetch.min.js", "/js/app.js",
+		},
+		Stylesheets: []string{"/css/bootstrap.min.css", "/css/layout.css"},
+		DataAttrs:   []string{"data-events", "data-login-user"},
+		EventKeys:   []string{"id", "title", "total", "remains", "sheets"},
+	}
+	adminPageSpec = htmlPageSpec{
+		Name: "管理画面",
+		IDs: []string{
+			"app-wrapper", "container", "menu-bar", "header-navbar-content",
+			"confirm-modal", "event-modal", "login-modal", "event-registration-modal",
+			"login-form-login-name", "login-form-password",
+			"event-registration-form-title", "event-registration-form-price",
+			"event-registration-form-public", "event-registration-form-private",
+		},
+		Scripts: []string{
+			"/js/jquery-3.3.1.slim.min.js", "/js/bootstrap.bundle.min.js", "/js/bootstrap-waitingfor.min.js",
+			"/js/vue.min.js", "/js/fetch.min.js", "/js/admin.js",
+		},
+		Stylesheets: []string{"/css/bootstrap.min.css", "/css/admin.css"},
+		DataAttrs:   []string{"data-administrator", "data-events"},
+		EventKeys:   []string{"id", "title", "price", "public", "closed", "total", "remains", "sheets"},
+	}
+
+	eventSheetsKeys = []string{"total", "remains", "price"}
+	// the reference implementation leaves the (empty or filled) detail in the event list, others drop it
+	eventSheetsOptionalKeys = []string{"detail"}
+	loginUserKeys           = []string{"id", "nickname"}
+)
+
+func checkStrictIndexHTML(doc *goquery.Document) error {
+	return checkStrictHTML(doc, &indexPageSpec)
+}
+
+func checkStrictAdminHTML(doc *goquery.Document) error {
+	return checkStrictHTML(doc, &adminPageSpec)
+}
+
+func checkStrictHTML(doc *goquery.Document, spec *htmlPageSpec) error {
+	for _, id := range spec.IDs {
+		if doc.Find("#"+id).Length() != 1 {
+			return fatalErrorf("%sの#%sが見つかりません", Msg(spec.Name), id)
+		}
+	}
+
+	scripts := map[string]bool{}
+	doc.Find("script").Each(func(_ int, s *goquery.Selection) {
+		if src, ok := s.Attr("src"); ok {
+			scripts[pathOfURL(src)] = true
+		}
+	})
+	for _, src := range spec.Scripts {
+		if !scripts[src] {
+			return fatalErrorf("%sに%sが読み込まれていません", Msg(spec.Name), src)
+		}
+	}
+
+	stylesheets := map[string]bool{}
+	doc.Find("link").Each(func(_ int, s *goquery.Selection) {
+		rel, _ := s.Attr("rel")
+		href, ok := s.Attr("href")
+		if ok && strings.EqualFold(rel, "stylesheet") {
+			stylesheets[pathOfURL(href)] = true
+		}
+	})
+	for _, href := range spec.Stylesheets {
+		if !stylesheets[href] {
+			return fatalErrorf("%sに%sが読み込まれていません", Msg(spec.Name), href)
+		}
+	}
+
+	wrapper := doc.Find("#app-wrapper")
+	for _, name := range spec.DataAttrs {
+		val, ok := wrapper.Attr(name)
+		if !ok {
+			return fatalErrorf("%sのapp-wrapperに%sがありません", Msg(spec.Name), name)
+		}
+
+		var err error
+		if name == "data-events" {
+			err = checkStrictEventsJSON(val, spec.EventKeys)
+		} else {
+			err = checkStrictUserJSON(val)
+		}
+		if err != nil {
+			return fatalErrorf("%sの%sの形式が正しくありません: %v", Msg(spec.Name), name, err)
+		}
+	}
+
+	return nil
+}
+
+func checkStrictEventsJSON(val string, eventKeys []string) error {
+	var events []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(val), &events); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if err := checkJSONKeys(event, eventKeys, nil); err != nil {
+			return fmt.Errorf("event: %v", err)
+		}
+
+		var sheets map[string]map[string]json.RawMessage
+		if err := json.Unmarshal(event["sheets"], &sheets); err != nil {
+			return fmt.Errorf("sheets: %v", err)
+		}
+		if len(sheets) != len(DataSet.SheetKinds) {
+			return errorf("sheets: ランクの数が正しくありません")
+		}
+		for _, sheetKind := range DataSet.SheetKinds {
+			sheet, ok := sheets[sheetKind.Rank]
+			if !ok {
+				return errorf("sheets: ランク%sがありません", sheetKind.Rank)
+			}
+			if err := checkJSONKeys(sheet, eventSheetsKeys, eventSheetsOptionalKeys); err != nil {
+				return fmt.Errorf("sheets.%s: %v", sheetKind.Rank, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkStrictUserJSON(val string) error {
+	var user map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(val), &user); err != nil {
+		return err
+	}
+	if user == nil {
+		// not logged in
+		return nil
+	}
+	return checkJSONKeys(user, loginUserKeys, nil)
+}
+
+func checkJSONKeys(obj map[string]json.RawMessage, keys []string, optionalKeys []string) error {
+	for _, key := range keys {
+		if _, ok := obj[key]; !ok {
+			return errorf("%sがありません", key)
+		}
+	}
+
+	var unknown []string
+	for key := range obj {
+		if !containsString(keys, key) && !containsString(optionalKeys, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errorf("不明なキーがあります %v", unknown)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func pathOfURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Path
+}
@@ -0,0 +1,132 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bench/counter"
+)
+
+// Emulates remote users by delaying requests of a part of virtual users on the client side.
+// Each Checker (i.e. a virtual user) is assigned to a class when it is created.
+
+type LatencyClass struct {
+	Name  string
+	Ratio float64 // ratio of virtual users which belong to the class
+	Delay time.Duration
+
+	mtx      sync.Mutex
+	requests int64
+	latency  time.Duration
+	counts   map[counter.Key]int64 // same keys as counter
+}
+
+type LatencyClassStat struct {
+	Name     string
+	Delay    time.Duration
+	Requests int64
+	Latency  time.Duration // average
+	Counts   map[counter.Key]int64
+}
+
+var latencyClasses []*LatencyClass
+
+// Parses "name:ratio:delay,..." e.g. "remote:0.1:100ms,far:0.05:300ms".
+// Users which do not belong to any class are put into the "local" class.
+func SetLatencyClasses(spec string) error {
+	latencyClasses = nil
+	if spec == "" {
+		return nil
+	}
+
+	var total float64
+	for _, s := range strings.Split(spec, ",") {
+		fields := strings.Split(s, ":")
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid latency class %q", s)
+		}
+		ratio, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || ratio <= 0 {
+			return fmt.Errorf("invalid latency class ratio %q", s)
+		}
+		delay, err := time.ParseDuration(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid latency class delay %q", s)
+		}
+		total += ratio
+		latencyClasses = append(latencyClasses, &LatencyClass{Name: fields[0], Ratio: ratio, Delay: delay, counts: map[counter.Key]int64{}})
+	}
+	if total > 1 {
+		return fmt.Errorf("sum of latency class ratios exceeds 1")
+	}
+	latencyClasses = append(latencyClasses, &LatencyClass{Name: "local", Ratio: 1 - total, counts: map[counter.Key]int64{}})
+
+	return nil
+}
+
+func pickLatencyClass() *LatencyClass {
+	if len(latencyClasses) == 0 {
+		return nil
+	}
+
+	r := rand.Float64()
+	for _, lc := range latencyClasses {
+		if r < lc.Ratio {
+			return lc
+		}
+		r -= lc.Ratio
+	}
+	return latencyClasses[len(latencyClasses)-1]
+}
+
+func (lc *LatencyClass) record(key counter.Key, latency time.Duration) {
+	lc.mtx.Lock()
+	defer lc.mtx.Unlock()
+
+	lc.requests++
+	lc.latency += latency
+	lc.counts[key]++
+}
+
+func (lc *LatencyClass) inc(key counter.Key) {
+	lc.mtx.Lock()
+	defer lc.mtx.Unlock()
+
+	lc.counts[key]++
+}
+
+func GetLatencyClassStats() []LatencyClassStat {
+	var stats []LatencyClassStat
+	for _, lc := range latencyClasses {
+		lc.mtx.Lock()
+		stat := LatencyClassStat{Name: lc.Name, Delay: lc.Delay, Requests: lc.requests, Counts: map[counter.Key]int64{}}
+		if lc.requests > 0 {
+			stat.Latency = lc.latency / time.Duration(lc.requests)
+		}
+		for k, v := range lc.counts {
+			stat.Counts[k] = v
+		}
+		lc.mtx.Unlock()
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+type delayTransport struct {
+	delay time.Duration
+	t     http.RoundTripper
+}
+
+func (dt *delayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-time.After(dt.delay):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return dt.t.RoundTrip(req)
+}
@@ -0,0 +1,244 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"bench/parameter"
+)
+
+// Ledger of reservations and cancelations which the benchmarker has successfully performed.
+// After the load phase it is reconciled against the final state of the app to detect apps
+// which drop writes under load.
+
+const (
+	LedgerReserve = "reserve"
+	LedgerCancel  = "cancel"
+)
+
+type LedgerEntry struct {
+	Op            string // LedgerReserve or LedgerCancel
+	ReservationID uint
+	EventID       uint
+	UserID        uint
+	SheetRank     string
+	SheetNum      uint
+	At            time.Time
+}
+
+type ledger struct {
+	mtx     sync.Mutex
+	entries []LedgerEntry
+}
+
+func (l *ledger) append(op string, reservation *Reservation, at time.Time) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	l.entries = append(l.entries, LedgerEntry{
+		Op:            op,
+		ReservationID: reservation.ID,
+		EventID:       reservation.EventID,
+		UserID:        reservation.UserID,
+		SheetRank:     reservation.SheetRank,
+		SheetNum:      reservation.SheetNum,
+		At:            at,
+	})
+}
+
+// Returns a reservation made by the benchmarker during the run which is not canceled yet, picked
+// at random from the ledger, or nil if none is found in a few tries
+func (s *State) GetRandomLedgerReservation() *Reservation {
+	for i := 0; i < 10; i++ {
+		entry, ok := s.ledger.random()
+		if !ok {
+			return nil
+		}
+		if entry.Op != LedgerReserve {
+			continue
+		}
+		if reservation := s.FindReservationByID(entry.ReservationID); reservation != nil && !s.IsCancelRequested(reservation) {
+			return reservation
+		}
+	}
+	return nil
+}
+
+func (l *ledger) random() (LedgerEntry, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if len(l.entries) == 0 {
+		return LedgerEntry{}, false
+	}
+	return l.entries[rand.Intn(len(l.entries))], true
+}
+
+func (s *State) GetLedger() []LedgerEntry {
+	s.ledger.mtx.Lock()
+	defer s.ledger.mtx.Unlock()
+
+	entries := make([]LedgerEntry, len(s.ledger.entries))
+	copy(entries, s.ledger.entries)
+	return entries
+}
+
+// Expected final state of a reservation replayed from the ledger
+type ledgerReservation struct {
+	LedgerEntry
+	Canceled bool
+	// A cancel request was sent but its result is unknown (timeout etc.), so it may be canceled or not
+	MaybeCanceled bool
+}
+
+func (s *State) replayLedger() map[uint]*ledgerReservation {
+	reservations := map[uint]*ledgerReservation{}
+	for _, entry := range s.GetLedger() {
+		switch entry.Op {
+		case LedgerReserve:
+			reservations[entry.ReservationID] = &ledgerReservation{LedgerEntry: entry}
+		case LedgerCancel:
+			if r, ok := reservations[entry.ReservationID]; ok {
+				r.Canceled = true
+			}
+		}
+	}
+
+	for id, r := range reservations {
+		if r.Canceled {
+			continue
+		}
+		if reservation := s.FindReservationByID(id); reservation != nil && !reservation.CancelRequestedAt.IsZero() {
+			r.MaybeCanceled = true
+		}
+	}
+	return reservations
+}
+
+// 負荷走行中に成功した予約とキャンセルがすべてアプリケーションの最終状態に反映されていること
+func CheckLedger(ctx context.Context, state *State) error {
+	admin, checker, push := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer push()
+
+	err := loginAdministratorWithTimeout(ctx, checker, admin, parameter.PostTestLoginTimeout)
+	if err != nil {
+		return err
+	}
+
+	reservations := state.replayLedger()
+	log.Println("debug: CheckLedger: reservations in ledger:", len(reservations))
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               "/admin/api/reports/sales",
+		ExpectedStatusCode: 200,
+		Description:        "レポートを正しく取得できること",
+		CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+			reader := csv.NewReader(body)
+			err := checkReportHeader(reader)
+			if err != nil {
+				return err
+			}
+			records, err := getReportRecords(state, reader)
+			if err != nil {
+				return err
+			}
+			return reconcileLedgerWithReport(reservations, records)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Sheets which must be reserved at the end, grouped by event
+	reservedSheets := map[uint][]*ledgerReservation{}
+	for _, r := range reservations {
+		if !r.Canceled && !r.MaybeCanceled {
+			reservedSheets[r.EventID] = append(reservedSheets[r.EventID], r)
+		}
+	}
+
+	eventIDs := make([]uint, 0, len(reservedSheets))
+	for eventID := range reservedSheets {
+		eventIDs = append(eventIDs, eventID)
+	}
+	sort.Slice(eventIDs, func(i, j int) bool { return eventIDs[i] < eventIDs[j] })
+
+	for _, eventID := range eventIDs {
+		sheets := reservedSheets[eventID]
+		err := checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               fmt.Sprintf("/admin/api/events/%d", eventID),
+			ExpectedStatusCode: 200,
+			Description:        "管理者がイベントを取得できること",
+			CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+				var event JsonFullEvent
+				err := json.NewDecoder(body).Decode(&event)
+				if err != nil {
+					return fatalErrorf("Jsonのデコードに失敗 %v", err)
+				}
+				return reconcileLedgerWithEvent(sheets, &event)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reconcileLedgerWithReport(reservations map[uint]*ledgerReservation, records map[uint]*ReportRecord) error {
+	for id, r := range reservations {
+		record, ok := records[id]
+		if !ok {
+			log.Printf("warn: CheckLedger: reservation(id:%d) is not found in the report\n", id)
+			return fatalErrorf("成功した予約(id:%d)がレポートに存在しません", id)
+		}
+		if record.EventID != r.EventID || record.UserID != r.UserID || record.SheetRank != r.SheetRank || record.SheetNum != r.SheetNum {
+			log.Printf("warn: CheckLedger: reservation(id:%d) expected:%+v got:%+v\n", id, r.LedgerEntry, record)
+			return fatalErrorf("成功した予約(id:%d)の内容がレポートと一致しません", id)
+		}
+		if r.Canceled && record.CanceledAt.IsZero() {
+			return fatalErrorf("成功したキャンセル(予約id:%d)がレポートに反映されていません", id)
+		}
+		if !r.Canceled && !r.MaybeCanceled && !record.CanceledAt.IsZero() {
+			return fatalErrorf("キャンセルしていない予約(id:%d)がレポートでキャンセルされています", id)
+		}
+	}
+	return nil
+}
+
+func reconcileLedgerWithEvent(sheets []*ledgerReservation, event *JsonFullEvent) error {
+	for _, r := range sheets {
+		jsonSheets, ok := event.Sheets[r.SheetRank]
+		if !ok {
+			return fatalErrorf("イベント(id:%d)の%s席の詳細情報が取得できません", r.EventID, r.SheetRank)
+		}
+
+		reserved := false
+		for _, detail := range jsonSheets.Details {
+			if detail.Num == r.SheetNum {
+				reserved = detail.Reserved
+				break
+			}
+		}
+		if !reserved {
+			log.Printf("warn: CheckLedger: sheet %s-%d of event(id:%d) reserved by reservation(id:%d) is not reserved\n", r.SheetRank, r.SheetNum, r.EventID, r.ReservationID)
+			return fatalErrorf("成功した予約(id:%d)のシート(%s-%d)がイベント(id:%d)で予約済みになっていません", r.ReservationID, r.SheetRank, r.SheetNum, r.EventID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package bench
+
+import (
+	"fmt"
+)
+
+// Language of the messages in the result, the load logs and the checker errors, set by SetLang.
+// The messages are written in Japanese in the code and the catalog below has their translations,
+// so a message missing from the catalog is shown in Japanese.
+var Lang = "ja"
+
+func SetLang(lang string) error {
+	switch lang {
+	case "ja", "en":
+		Lang = lang
+		return nil
+	}
+	return fmt.Errorf("invalid lang %q: ja or en", lang)
+}
+
+// Returns the message (or the format of a message) in Lang
+func Msg(ja string) string {
+	if Lang == "en" {
+		if en, ok := messagesEn[ja]; ok {
+			return en
+		}
+	}
+	return ja
+}
+
+func Msgf(format string, a ...interface{}) string {
+	return fmt.Sprintf(Msg(format), a...)
+}
+
+func errorf(format string, a ...interface{}) error {
+	return fmt.Errorf(Msg(format), a...)
+}
+
+// An error with a fixed message, translated when it is shown so that it can be defined before SetLang
+type messageError string
+
+func (e messageError) Error() string {
+	return Msg(string(e))
+}
+
+var messagesEn = map[string]string{
+	// result and load logs
+	"ベンチマークが中断されました。":                                 "The benchmark was aborted.",
+	"/initialize へのリクエストに失敗しました。":                     "The request to /initialize failed. ",
+	"負荷走行前のバリデーションに失敗しました。":                           "The validation before the load failed. ",
+	"負荷走行中のバリデーションに失敗しました。":                           "The validation during the load failed. ",
+	"負荷走行後のバリデーションに失敗しました。":                           "The validation after the load failed. ",
+	"SLAを満たしていないエンドポイントがあります。":                        "Some endpoints do not meet the SLA. ",
+	"先行するチェックが失敗したため実行されませんでした。":                      "Not run because a preceding check failed.",
+	"%v /initialize に成功しました。(%d回目, %v)":               "%v /initialize succeeded. (attempt %d, %v)",
+	"%v /initialize に失敗しました。(%d回目, %v) %v":            "%v /initialize failed. (attempt %d, %v) %v",
+	"%v ウォームアップが終了しました。":                              "%v The warm-up finished.",
+	"%v エラーまたは遅いレスポンスが%v秒以上続いたため負荷レベルを下げました。":         "%v The load level was lowered because errors or slow responses lasted for %v seconds or more.",
+	"%v エラーが発生したため負荷レベルを上げられませんでした。%v":                "%v The load level could not be raised because of an error. %v",
+	"%v レスポンスが遅いため負荷レベルを上げられませんでした。%v":                "%v The load level could not be raised because of slow responses. %v",
+	"%v ベンチマーカーのリソースが不足しているため負荷レベルを上げられませんでした。%v":     "%v The load level could not be raised because the benchmarker is short of resources. %v",
+	"%v 負荷レベルが上昇しました。":                                "%v The load level was raised.",
+	"%v エージェント %s の負荷走行結果を合算しました。(負荷レベル %d, エラー %d件)": "%v Merged the load result of the agent %s. (load level %d, %d errors)",
+	"最後の%v秒間のエラー率が%.2f%%を超えたため、その間のリクエストはスコアに含まれません。": "The error rate of the last %v seconds exceeded %.2f%%, so the requests in that period are not scored.",
+	"%v %sが復旧したため負荷走行の対象に戻しました。":                      "%v %s recovered and was put back into the load.",
+	"%v %sが応答しないため負荷走行の対象から一時的に外しました。%v":              "%v %s was temporarily removed from the load because it does not respond. %v",
+	"エラーが%d件発生したため、スコアから%.1f%%(%d)を減点しました。":           "%d errors occurred, so %.1f%% (%d) was deducted from the score.",
+	"CPU使用率 %.0f%%":   "CPU usage %.0f%%",
+	"空きメモリ %dMB/%dMB": "free memory %dMB/%dMB",
+	"goroutine数 %d":   "goroutines %d",
+	"ポート使用数 %d/%d":    "ports in use %d/%d",
+	"%v ベンチマーカーのリソースが不足しています。スコアはベンチマーカーの性能で頭打ちになっている可能性があります。(%s)": "%v The benchmarker is short of resources. The score may be capped by the performance of the benchmarker. (%s)",
+	"%v 負荷走行の並列数が上限(%d)に達しました。":  "%v The concurrency of the load reached its limit (%d).",
+	"%s システム時刻が %v ずれました":        "%s The system clock shifted by %v",
+	"エラーが%d件に達したため負荷走行を打ち切りました。": "The load was stopped because the errors reached %d.",
+	"%v 負荷走行時間(%v秒)が標準の%v秒ではありません。スコアは1分あたりに換算した値(score_per_minute)で比べてください。": "%v The load duration (%v seconds) is not the standard %v seconds. Compare the scores normalized to a minute (score_per_minute).",
+
+	// names used in the checker errors
+	"トップページ":       "the top page",
+	"管理画面":         "the admin page",
+	"ログインしていないユーザ": "an anonymous user",
+	"一般ユーザ":        "a non-admin user",
+
+	// requests and responses
+	"リクエストがタイムアウトしました":                                 "The request timed out",
+	"リクエストに失敗しました %v":                                  "The request failed %v",
+	"リクエストに失敗しました (主催者に連絡してください)":                      "The request failed (contact the organizers)",
+	"レスポンスが不正です":                                       "The response is invalid",
+	"サーバエラーが発生しました。%s":                                 "A server error occurred. %s",
+	"gzipレスポンスの展開に失敗しました %v":                           "Failed to decompress the gzip response %v",
+	"期待していないステータスコード %d":                               "Unexpected status code %d",
+	"期待していないステータスコード %d Expected 302 or 303":           "Unexpected status code %d Expected 302 or 303",
+	"リダイレクトURLが適切に設定されていません":                           "The redirect URL is not set properly",
+	"リダイレクト先URLが正しくありません: expected '%s', got '%s'":     "The redirect URL is wrong: expected '%s', got '%s'",
+	"304レスポンスにボディが含まれています":                             "The 304 response has a body",
+	"304レスポンスのETagが一致しません":                             "The ETag of the 304 response does not match",
+	"正しいエラーコードを取得できません %s":                             "Cannot get the correct error code %s",
+	"不正な入力が受け付けられました。%s":                               "An invalid input was accepted. %s",
+	"不正な入力に対してサーバエラーが発生しました。%s":                        "A server error occurred for an invalid input. %s",
+	"チェックサムの生成に失敗しました (主催者に連絡してください)":                  "Failed to generate the checksum (contact the organizers)",
+	"詳細チェックに失敗しました %v":                                 "The deep check failed %v",
+	"Jsonのデコードに失敗 %s %v":                               "Failed to decode the JSON %s %v",
+	"Jsonのデコードに失敗 %v":                                  "Failed to decode the JSON %v",
+	"レスポンスのJsonの形式が正しくありません %v":                        "The JSON of the response is malformed %v",
+	"レスポンスのJsonデコードに失敗 %v":                             "Failed to decode the JSON of the response %v",
+	"不明なキーがあります %v":                                    "There are unknown keys %v",
+	"%s.%s: フィールドがありません":                               "%s.%s: the field is missing",
+	"%s: nullです (%s expected)":                         "%s: null (%s expected)",
+	"%s: 不明なフィールドがあります %v":                             "%s: there are unknown fields %v",
+	"%s: 型が正しくありません (array expected)":                  "%s: wrong type (array expected)",
+	"%s: 型が正しくありません (boolean expected)":                "%s: wrong type (boolean expected)",
+	"%s: 型が正しくありません (number expected)":                 "%s: wrong type (number expected)",
+	"%s: 型が正しくありません (object expected)":                 "%s: wrong type (object expected)",
+	"%s: 型が正しくありません (string expected)":                 "%s: wrong type (string expected)",
+	"%sがありません":                                         "%s is missing",
+	"%sが管理者用API %s %s にアクセスできます (status %d)":           "%s can access the admin API %s %s (status %d)",
+	"予期しないCookie(%s)が設定されました":                          "An unexpected cookie (%s) was set",
+	"セッションCookieが複数回設定されました":                           "The session cookie was set more than once",
+	"セッションCookieのPathが正しくありません expected '/', got '%s'": "The Path of the session cookie is wrong expected '/', got '%s'",
+	"セッションCookieにHttpOnlyがありません":                       "The session cookie is not HttpOnly",
+	"セッションCookieの有効期限が正しくありません %s":                     "The expiry of the session cookie is wrong %s",
+	"静的ファイルのサイズが正しくありません expected %d, got %d":          "The size of the static file is wrong expected %d, got %d",
+	"静的ファイルの内容が正しくありません":                               "The content of the static file is wrong",
+	"静的ファイルの部分コンテンツが正しくありません":                          "The partial content of the static file is wrong",
+	"Content-Typeが正しくありません expected '%s', got '%s'":    "The Content-Type is wrong expected '%s', got '%s'",
+	"Content-Rangeが正しくありません expected '%s', got '%s'":   "The Content-Range is wrong expected '%s', got '%s'",
+
+	// HTML
+	"ページのHTMLがパースできませんでした":                               "Cannot parse the HTML of the page",
+	"DOM構造が初期状態と一致しません":                                  "The DOM structure does not match the initial state",
+	"app-wrapperが見つかりません":                                "app-wrapper is not found",
+	"app-wrapperにdata-eventsまたはdata-administratorがありません": "app-wrapper has no data-events or data-administrator",
+	"app-wrapperにdata-eventsまたはdata-login-userがありません":    "app-wrapper has no data-events or data-login-user",
+	"%sの#%sが見つかりません":                                     "#%[2]s is not found in %[1]s",
+	"%sに%sが読み込まれていません":                                   "%[2]s is not loaded in %[1]s",
+	"%sのapp-wrapperに%sがありません":                            "app-wrapper of %s has no %s",
+	"%sの%sの形式が正しくありません: %v":                              "%s: %s is malformed: %v",
+	"%sの管理画面に管理者情報が表示されています":                             "The administrator is shown to %s on the admin page",
+	"%sの管理画面にイベント一覧が表示されています":                            "The events are shown to %s on the admin page",
+	"トップページにイベント(id:%d)が見つかりません":                         "The event (id:%d) is not found on the top page",
+	"トップページに終了したイベント(id:%d)が表示されています":                    "The closed event (id:%d) is shown on the top page",
+	"トップページに非公開のイベント(id:%d)が表示されています":                    "The private event (id:%d) is shown on the top page",
+	"トップページのイベント(id:%d)の%s席の残席数が正しくありません":                "The remains of the %[2]s sheets of the event (id:%[1]d) on the top page are wrong",
+	"トップページのイベントの数が正しくありません":                             "The number of the events on the top page is wrong",
+	"トップページのイベントの順番が正しくありません":                            "The order of the events on the top page is wrong",
+	"トップページのイベント一覧: %s":                                  "The events on the top page: %s",
+	"トップページのイベント一覧が見つかりません":                              "The events are not found on the top page",
+	"トップページのイベント一覧のJsonデコードに失敗 %s %v":                    "Failed to decode the JSON of the events on the top page %s %v",
+	"管理画面のイベントの数が正しくありません":                               "The number of the events on the admin page is wrong",
+	"管理画面のイベントの順番が正しくありません":                              "The order of the events on the admin page is wrong",
+	"管理画面のイベント一覧: %s":                                    "The events on the admin page: %s",
+	"管理画面のイベント一覧のJsonデコードに失敗 %s %v":                      "Failed to decode the JSON of the events on the admin page %s %v",
+	"%sにモバイル端末向けのviewportが指定されていません":                     "%s has no viewport for mobile devices",
+
+	// users and administrators
+	"ログインユーザーがnull":                   "The login user is null",
+	"ログインユーザーが違います":                   "The login user is wrong",
+	"ログインユーザーが非null":                  "The login user is not null",
+	"ログインユーザーのJsonデコードに失敗 %s %v":      "Failed to decode the JSON of the login user %s %v",
+	"管理者情報がnull":                      "The administrator is null",
+	"管理者情報が違います":                      "The administrator is wrong",
+	"管理者情報のJsonデコードに失敗 %s %v":         "Failed to decode the JSON of the administrator %s %v",
+	"正しいユーザーを取得できません":                 "Cannot get the correct user",
+	"正しいユーザ情報を取得できません":                "Cannot get the correct user information",
+	"正しい管理者情報を取得できません":                "Cannot get the correct administrator",
+	"同じログイン名で同時に登録した場合にいずれも成功しませんでした": "None of the concurrent registrations with the same login name succeeded",
+	"同じログイン名のユーザが複数登録されました":           "Multiple users were registered with the same login name",
+
+	// events
+	"正しいイベントを取得できません":                                   "Cannot get the correct event",
+	"正しいイベント(id:%d)を取得できません":                            "Cannot get the correct event (id:%d)",
+	"正しいイベント一覧を取得できません":                                 "Cannot get the correct events",
+	"イベント一覧のJsonデコードに失敗 %v":                             "Failed to decode the JSON of the events %v",
+	"イベント一覧にイベント(id:%d)の公開状態が反映されていません":                 "The public state of the event (id:%d) is not reflected in the events",
+	"sheets: ランク%sがありません":                               "sheets: the rank %s is missing",
+	"sheets: ランクの数が正しくありません":                            "sheets: the number of the ranks is wrong",
+	"イベント(id:%d)に存在しないランク(%s)のシートがあります":                 "The event (id:%d) has sheets of an unknown rank (%s)",
+	"イベント(id:%d)の%s席が取得できません":                           "Cannot get the %[2]s sheets of the event (id:%[1]d)",
+	"イベント(id:%d)の%s席の価格が正しくありません":                       "The price of the %[2]s sheets of the event (id:%[1]d) is wrong",
+	"イベント(id:%d)の%s席の残座席数が正しくありません":                     "The remains of the %[2]s sheets of the event (id:%[1]d) are wrong",
+	"イベント(id:%d)の%s席の残座席数が総座席数を超えています":                  "The remains of the %[2]s sheets of the event (id:%[1]d) exceed the total",
+	"イベント(id:%d)の%s席の総座席数が正しくありません":                     "The total of the %[2]s sheets of the event (id:%[1]d) is wrong",
+	"イベント(id:%d)の%s席の詳細情報が取得できません":                      "Cannot get the details of the %[2]s sheets of the event (id:%[1]d)",
+	"イベント(id:%d)のシートの予約状況が矛盾しています":                      "The reservation states of the sheets of the event (id:%d) are inconsistent",
+	"イベント(id:%d)のシートの詳細情報が取得できません":                      "Cannot get the details of the sheets of the event (id:%d)",
+	"イベント(id:%d)のシートの順番が違います":                           "The order of the sheets of the event (id:%d) is wrong",
+	"イベント(id:%d)のシート定義が取得できません":                         "Cannot get the sheet definitions of the event (id:%d)",
+	"イベント(id:%d)のタイトルが正しくありません":                         "The title of the event (id:%d) is wrong",
+	"イベント(id:%d)の予約した席(%s-%d)が予約済みになっていません":             "The reserved sheet (%[2]s-%[3]d) of the event (id:%[1]d) is not reserved",
+	"イベント(id:%d)の予約した席(%s-%d)が見つかりません":                  "The reserved sheet (%[2]s-%[3]d) of the event (id:%[1]d) is not found",
+	"イベント(id:%d)の公開状態が正しくありません":                         "The public state of the event (id:%d) is wrong",
+	"イベント(id:%d)の席(%s-%d)の予約者が正しくありません":                 "The reserver of the sheet (%[2]s-%[3]d) of the event (id:%[1]d) is wrong",
+	"イベント(id:%d)でキャンセルした席(%s-%d)が空席に戻りません":              "The canceled sheet (%[2]s-%[3]d) of the event (id:%[1]d) does not become free",
+	"イベント(id:%d)でキャンセルされた席(%s-%d)を別のユーザが予約できません":        "Another user cannot reserve the canceled sheet (%[2]s-%[3]d) of the event (id:%[1]d)",
+	"イベント(id:%d)でキャンセルされた席(%s-%d)ではない席(%s-%d)が予約されました":  "The sheet (%[4]s-%[5]d) was reserved instead of the canceled sheet (%[2]s-%[3]d) of the event (id:%[1]d)",
+	"イベント(id:%d)の総座席数が各席の合計と一致しません":                     "The total of the event (id:%d) does not match the sum of the sheets",
+	"イベント(id:%d)の総座席数が正しくありません":                         "The total of the event (id:%d) is wrong",
+	"イベント(id:%d)の総残座席数が各席の合計と一致しません":                    "The remains of the event (id:%d) do not match the sum of the sheets",
+	"イベント(id:%d)の総残座席数が正しくありません":                        "The remains of the event (id:%d) are wrong",
+	"売り切れたイベント(id:%d)の%s席の予約状況が正しくありません":                "The reservation state of the %[2]s sheets of the sold out event (id:%[1]d) is wrong",
+	"売り切れたイベント(id:%d)の%s席の残席数が正しくありません":                 "The remains of the %[2]s sheets of the sold out event (id:%[1]d) are wrong",
+	"売り切れのイベント(id:%d)の%s席で、キャンセルされた1席に対して%d件の予約が成功しました": "%[3]d reservations succeeded for one canceled %[2]s sheet of the sold out event (id:%[1]d)",
+
+	// sheets and reservations
+	"正しい予約情報を取得できません":                                       "Cannot get the correct reservation",
+	"予約IDが重複しています":                                          "The reservation IDs are duplicated",
+	"予約される席の分布がランダムではありません":                                 "The distribution of the reserved sheets is not random",
+	"予約順がランダムではありません: event_id:%d":                          "The order of the reservations is not random: event_id:%d",
+	"予約した%s席のシート番号(%d)が正しくありません":                            "The number (%[2]d) of the reserved %[1]s sheet is wrong",
+	"イベント(id:%d)の%s席に一斉に予約した%d件のうち%d件が成功しました (expected %d)": "%[4]d of %[3]d simultaneous reservations of the %[2]s sheets of the event (id:%[1]d) succeeded (expected %[5]d)",
+	"同じ席(event:%d %s)が複数のユーザ(%d, %d)に予約されました":               "The same sheet (event:%d %s) was reserved by multiple users (%d, %d)",
+	"キャンセルされた席(event:%d %s-%d)を予約できません":                     "Cannot reserve the canceled sheet (event:%d %s-%d)",
+	"シート(%s-%d)が予約されていません(id:%d)":                           "The sheet (%s-%d) is not reserved (id:%d)",
+	"シート(%s-%d)の予約時刻が正しくありません(id:%d)":                       "The reserved time of the sheet (%s-%d) is wrong (id:%d)",
+	"シート(%s-%d)の保有者がユーザー(id:%d)ではありません(id:%d)":              "The owner of the sheet (%s-%d) is not the user (id:%d) (id:%d)",
+	"シート(%s-%d)の保有者が正しくありません(id:%d)":                        "The owner of the sheet (%s-%d) is wrong (id:%d)",
+	"予約されていないシート(%s-%d)に予約情報があります(id:%d)":                   "The unreserved sheet (%s-%d) has reservation data (id:%d)",
+	"未ログインのユーザーがキャンセルできるシートが存在します(id:%d)":                   "An anonymous user can cancel a sheet (id:%d)",
+	"成功した予約(id:%d)のシート(%s-%d)がイベント(id:%d)で予約済みになっていません":     "The sheet (%[2]s-%[3]d) of the successful reservation (id:%[1]d) is not reserved in the event (id:%[4]d)",
+
+	// recent reservations and events of a user
+	"予約総額が最新の状態ではありません userID=%d":                         "The total price of the reservations is not up to date userID=%d",
+	"予約総額が正しくありません userID=%d":                             "The total price of the reservations is wrong userID=%d",
+	"予約していないイベントが最近予約したイベントに含まれています userID=%d eventID=%d": "An event which the user has not reserved is in the recent events userID=%d eventID=%d",
+	"予約していない席が最近予約した席に含まれています userID=%d reservationID=%d": "A sheet which the user has not reserved is in the recent reservations userID=%d reservationID=%d",
+	"最近予約したイベントがnullです":                                   "The recent events are null",
+	"最近予約したイベントが多すぎます":                                    "Too many recent events",
+	"最近予約したイベントが最新の状態ではありません":                             "The recent events are not up to date",
+	"最近予約したイベントが重複しています userID=%d":                        "The recent events are duplicated userID=%d",
+	"最近予約したイベントのイベント情報(closed)が正しくありません":                  "The event (closed) of the recent events is wrong",
+	"最近予約したイベントのイベント情報(id)が正しくありません":                      "The event (id) of the recent events is wrong",
+	"最近予約したイベントのイベント情報(public)が正しくありません":                  "The event (public) of the recent events is wrong",
+	"最近予約したイベントの数が正しくありません userID=%d":                     "The number of the recent events is wrong userID=%d",
+	"最近予約したイベントの順番が正しくありません userID=%d":                    "The order of the recent events is wrong userID=%d",
+	"最近予約したイベントを取得できません":                                  "Cannot get the recent events",
+	"最近予約したイベント一覧(userID=%d): %s":                         "The recent events (userID=%d): %s",
+	"最近予約した席がnullです":                                      "The recent reservations are null",
+	"最近予約した席が多すぎます":                                       "Too many recent reservations",
+	"最近予約した席が最新の状態ではありません userID=%d":                      "The recent reservations are not up to date userID=%d",
+	"最近予約した席が重複しています userID=%d":                           "The recent reservations are duplicated userID=%d",
+	"最近予約した席のイベントがnullです":                                 "The event of a recent reservation is null",
+	"最近予約した席のイベントが正しくありません userID=%d reservationID=%d":    "The event of a recent reservation is wrong userID=%d reservationID=%d",
+	"最近予約した席のイベント情報(closed)が正しくありません userID=%d":           "The event (closed) of a recent reservation is wrong userID=%d",
+	"最近予約した席のイベント情報(id)が正しくありません userID=%d":               "The event (id) of a recent reservation is wrong userID=%d",
+	"最近予約した席のイベント情報(public)が正しくありません userID=%d":           "The event (public) of a recent reservation is wrong userID=%d",
+	"最近予約した席のイベント情報(title)が正しくありません userID=%d":            "The event (title) of a recent reservation is wrong userID=%d",
+	"最近予約した席のキャンセル時刻が正しくありません userID=%d reservationID=%d": "The canceled time of a recent reservation is wrong userID=%d reservationID=%d",
+	"最近予約した席のキャンセル状態が正しくありません userID=%d reservationID=%d": "The cancel state of a recent reservation is wrong userID=%d reservationID=%d",
+	"最近予約した席のランクが正しくありません userID=%d reservationID=%d":     "The rank of a recent reservation is wrong userID=%d reservationID=%d",
+	"最近予約した席の予約時刻が正しくありません userID=%d reservationID=%d":    "The reserved time of a recent reservation is wrong userID=%d reservationID=%d",
+	"最近予約した席の価格が正しくありません userID=%d reservationID=%d":      "The price of a recent reservation is wrong userID=%d reservationID=%d",
+	"最近予約した席の内容が正しくありません userID=%d reservationID=%d":      "The content of a recent reservation is wrong userID=%d reservationID=%d",
+	"最近予約した席の席番号が正しくありません userID=%d reservationID=%d":     "The sheet number of a recent reservation is wrong userID=%d reservationID=%d",
+	"最近予約した席の数が正しくありません userID=%d":                        "The number of the recent reservations is wrong userID=%d",
+	"最近予約した席の順番が正しくありません userID=%d":                       "The order of the recent reservations is wrong userID=%d",
+	"最近予約した席の順番が正しくありません":                                 "The order of the recent reservations is wrong",
+	"最近予約した席を取得できません":                                     "Cannot get the recent reservations",
+
+	// reports
+	"正しいレポートを取得できません":                      "Cannot get the correct report",
+	"正しいCSVレポートを取得できません":                   "Cannot get the correct CSV report",
+	"正しいCSVヘッダを取得できません":                    "Cannot get the correct CSV header",
+	"レポート(予約id:%d)のイベントidが正しくありません":        "The event id of the report (reservation id:%d) is wrong",
+	"レポート(予約id:%d)のキャンセル時刻が正しくありません":       "The canceled time of the report (reservation id:%d) is wrong",
+	"レポート(予約id:%d)のシートランクが正しくありません":        "The sheet rank of the report (reservation id:%d) is wrong",
+	"レポート(予約id:%d)のシート価格が正しくありません":         "The sheet price of the report (reservation id:%d) is wrong",
+	"レポート(予約id:%d)のシート番号が正しくありません":         "The sheet number of the report (reservation id:%d) is wrong",
+	"レポート(予約id:%d)のユーザidが正しくありません":         "The user id of the report (reservation id:%d) is wrong",
+	"レポート(予約id:%d)の予約時刻が正しくありません":          "The reserved time of the report (reservation id:%d) is wrong",
+	"レポートに予約id:%dの行が存在しません":                "The report has no row of the reservation id:%d",
+	"レポートに予約id:%dの行が重複しています":               "The report has duplicated rows of the reservation id:%d",
+	"レポートの数が正しくありません":                      "The number of the rows of the report is wrong",
+	"レポートの行が販売時刻の順に並んでいません (予約id:%d)":      "The rows of the report are not sorted by the sold time (reservation id:%d)",
+	"キャンセルしていない予約(id:%d)がレポートでキャンセルされています": "The reservation (id:%d) which is not canceled is canceled in the report",
+	"成功したキャンセル(予約id:%d)がレポートに反映されていません":    "The successful cancel (reservation id:%d) is not reflected in the report",
+	"成功した予約(id:%d)がレポートに存在しません":            "The successful reservation (id:%d) is not in the report",
+	"成功した予約(id:%d)の内容がレポートと一致しません":         "The successful reservation (id:%d) does not match the report",
+}
@@ -16,20 +16,106 @@ var (
 	PostTimeout           = 3 * time.Second
 	DeleteTimeout         = 3 * time.Second
 	InitializeTimeout     = 10 * time.Second
+	InitializeAttempts    = 1
+	InitializeBackoff     = 2 * time.Second  // doubled on every retry
+	InitializeDeadline    = 60 * time.Second // overall deadline of all attempts
 	SlowThreshold         = 1000 * time.Millisecond
 	MaxCheckerRequest     = 6
 	PostTestLoginTimeout  = 20 * time.Second // postTest takes time because of remained requests. This value was tuned to pass initial app
 	PostTestReportTimeout = 60 * time.Second
+	RemoteResolveTimeout  = 5 * time.Second
 
-	LoadInitialNumGoroutines = 5.0
-	LoadLevelUpRatio         = 1.5
-	LoadLevelUpInterval      = time.Second
-	LoadStartupTotalWait     = float64(100000) // Microsecond
-	CheckEventReportInterval = 5 * time.Second
-	CheckReportInterval      = 31 * time.Second
-	EveryCheckerInterval     = 3 * time.Second
-	AllowableDelay           = time.Second
-	WaitOnError              = 500 * time.Millisecond
+	// connection pool of the shared transport (0 for unlimited)
+	MaxIdleConns        = 0
+	MaxIdleConnsPerHost = 65536
+	MaxConnsPerHost     = 0
+	IdleConnTimeout     = time.Duration(0)
+
+	// client timeouts of static files and reports (-timeouts). The other requests have the ones of their method
+	StaticTimeout = 10 * time.Second
+	ReportTimeout = PostTestReportTimeout // the reports take long also during the load
+
+	LoadInitialNumGoroutines   = 5.0
+	LoadLevelUpRatio           = 1.5
+	LoadLevelUpInterval        = time.Second
+	LoadLevelUpLookback        = 5 * time.Second // slow requests in flight and the saturation of the bench within this window block the level up
+	LoadShedAfter              = 10 * time.Second
+	LoadStartupTotalWait       = float64(100000) // Microsecond
+	CheckEventReportInterval   = 5 * time.Second
+	CheckReportInterval        = 31 * time.Second
+	DeepCheckInterval          = 17 * time.Second
+	EveryCheckerInterval       = 3 * time.Second
+	AllowableDelay             = time.Second
+	WaitOnError                = 500 * time.Millisecond
+	CancelReserveRatio         = -1.0 // target cancel:reserve ratio of load scenarios. negative lets scenario weights decide
+	ChurnReserveRatio          = 0.7  // share of reservations among the reservations and cancellations of LoadReserveCancelChurn
+	DoubleBookingConcurrency   = 10   // # of concurrent reservations for the same event in CheckDoubleBooking
+	CancelReserveRaceUsers     = 5    // # of users who try to reserve a canceled sheet at the same time in LoadCancelReserveRace
+	UserDetailReservations     = 4    // # of reservations made by a new user in CheckUserDetail (must be <= 5 to see all of them)
+	DuplicateSignupConcurrency = 2    // # of simultaneous signups with the same login name in CheckDuplicateRegistration
+	ThunderingHerdUsers        = 70   // # of users who reserve the rank of the fewest sheets of a new event at once in LoadThunderingHerd
+	RemainsInvariantEvents     = 3    // # of events fetched on every CheckRemainsInvariant
+	SheetRandomnessMinSamples  = 100  // # of sheet numbers assigned by the app needed for CheckSheetRandomness
+	AdminSessionPageViews      = 3    // # of reloads of the admin page in a session of LoadAdminSession
+	ClockJumpCheckInterval     = time.Second
+	ClockJumpThreshold         = 500 * time.Millisecond
+	// allowed clock difference between the bench and the app for reserved_at, canceled_at and report timestamps
+	ClockSkewTolerance = 0 * time.Second
+	// health check of remotes, which are evicted after HealthCheckFailures consecutive failures
+	HealthCheckPath     = "/css/layout.css"
+	HealthCheckInterval = time.Second
+	HealthCheckTimeout  = 2 * time.Second
+	HealthCheckFailures = 3
+	// slow path thresholds per path prefix, which override SlowThreshold. The longest prefix wins
+	SlowThresholds = map[string]time.Duration{
+		"/admin/api/reports/": 5 * time.Second,
+	}
+	// slow requests in flight within LoadLevelUpLookback which block the level up, and the slowest requests kept for the result
+	LoadLevelUpSlowRequests = 3
+	SlowPathTopK            = 10
+	// the load level is raised only if every endpoint with LoadLevelUpMinRequests or more requests in the last
+	// LoadLevelUpWindow has its LoadLevelUpPercentile latency under the slow threshold and its error rate
+	// under LoadLevelUpMaxErrorRate, and the error rate of all requests is also under LoadLevelUpMaxErrorRate
+	LoadLevelUpWindow       = 10 * time.Second
+	LoadLevelUpPercentile   = 95.0
+	LoadLevelUpMinRequests  = int64(20)
+	LoadLevelUpMaxErrorRate = 0.01
+	// failed checks dumped to -tempdir/failures, and the response body bytes kept in each dump
+	FailureCaptureMaxFiles = 100
+	FailureCaptureMaxBody  = 16 * 1024
+	// lifetime of the session cookie if it has an expiry (the reference sets an hour)
+	SessionCookieMinAge = time.Minute
+	SessionCookieMaxAge = 30 * 24 * time.Hour
+	// unique errors reported in the result at most, the most frequent first
+	ResultErrorTopN = 30
+	// requests recorded by -har at most
+	HARMaxEntries = 10000
+	// misbehaving clients of -chaos
+	ChaosTimeout          = 10 * time.Second
+	ChaosSlowBodyDuration = 5 * time.Second
+	ChaosSlowBodyInterval = 500 * time.Millisecond
+	// size of the oversized request bodies of CheckFuzzInput
+	FuzzOversizedBodySize = 1024 * 1024
+	// times CheckCancelFreesSheet fetches the event or reserves again until the canceled sheet is seen free
+	CancelFreesSheetRetries       = 3
+	CancelFreesSheetRetryInterval = 500 * time.Millisecond
+	// -duration of the official runs. Scores of other durations are normalized to it in the result
+	StandardDuration = time.Minute
+	// how often the checker errors are compared with -max-errors and -fail-fast
+	StopConditionInterval = 100 * time.Millisecond
+	// checks run in parallel during the load, each of which waits for its dependencies in the round
+	CheckWorkers = 4
+	// the bench host is saturated when any of these is reached, and then the load level is not raised
+	BenchSaturationInterval    = time.Second
+	BenchCPUThreshold          = 0.9
+	BenchMemAvailableThreshold = 0.1
+	BenchMaxGoroutines         = 200000
+	BenchPortUsageThreshold    = 0.8
+	// OTLP span export of -otlp-endpoint
+	TraceQueueSize      = 8192
+	TraceBatchSize      = 512
+	TraceExportInterval = time.Second
+	TraceExportTimeout  = 5 * time.Second
 
 	Score = func(getCount int64, postCount int64, deleteCount int64, staticCount int64, reserveCount int64, cancelCount int64, topCount int64, getEventCount int64) int64 {
 		return 1*(getCount-staticCount-topCount-getEventCount) + 1*(postCount-reserveCount) + 5*(topCount+getEventCount) + 10*(reserveCount+cancelCount) + staticCount/100
@@ -0,0 +1,106 @@
+package bench
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+
+	"bench/counter"
+)
+
+// Phases of a request measured with httptrace, so that a slow app can be told apart from
+// a bench host waiting for connections. Summed per endpoint into the counters NamePhaseUs
+// (microseconds) and NamePhaseN (count) labeled with the phase. Whether the connection was
+// reused is counted per host into NameConn labeled with the host and reused.
+//
+//	conn:    waiting for a connection, including dns, connect and tls of a new one
+//	dns, connect, tls: establishing a new connection
+//	ttfb:    from the request written to the first response byte
+//	body:    reading the response body
+var RequestPhases = []string{"conn", "dns", "connect", "tls", "ttfb", "body"}
+
+type requestPhases struct {
+	mu                        sync.Mutex
+	connHost                  string
+	connReused                bool
+	onConn                    func() // called when the connection is ready, if set
+	getConn, gotConn          time.Time
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+}
+
+func (p *requestPhases) set(t *time.Time) {
+	p.mu.Lock()
+	*t = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *requestPhases) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn:              p.onGetConn,
+		GotConn:              p.onGotConn,
+		DNSStart:             func(httptrace.DNSStartInfo) { p.set(&p.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { p.set(&p.dnsDone) },
+		ConnectStart:         func(string, string) { p.set(&p.connectStart) },
+		ConnectDone:          func(string, string, error) { p.set(&p.connectDone) },
+		TLSHandshakeStart:    func() { p.set(&p.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.set(&p.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.set(&p.wroteRequest) },
+		GotFirstResponseByte: func() { p.set(&p.firstByte) },
+	}
+}
+
+func (p *requestPhases) onGetConn(hostPort string) {
+	p.mu.Lock()
+	p.getConn = time.Now()
+	p.connHost = hostPort
+	p.mu.Unlock()
+}
+
+func (p *requestPhases) onGotConn(info httptrace.GotConnInfo) {
+	p.mu.Lock()
+	p.gotConn = time.Now()
+	p.connReused = info.Reused
+	p.mu.Unlock()
+
+	if p.onConn != nil {
+		p.onConn()
+	}
+}
+
+func (p *requestPhases) record(method, path string, bodyRead time.Duration) {
+	p.mu.Lock()
+	durations := map[string]time.Duration{"body": bodyRead}
+	add := func(phase string, start, end time.Time) {
+		if !start.IsZero() && !end.IsZero() && !end.Before(start) {
+			durations[phase] = end.Sub(start)
+		}
+	}
+	add("conn", p.getConn, p.gotConn)
+	add("dns", p.dnsStart, p.dnsDone)
+	add("connect", p.connectStart, p.connectDone)
+	add("tls", p.tlsStart, p.tlsDone)
+	add("ttfb", p.wroteRequest, p.firstByte)
+	var connKey *counter.Key
+	if !p.gotConn.IsZero() {
+		connKey = &counter.Key{Name: counter.NameConn, Labels: counter.Labels("host", p.connHost, "reused", strconv.FormatBool(p.connReused))}
+	}
+	p.mu.Unlock()
+
+	if connKey != nil {
+		counter.Inc(*connKey)
+	}
+
+	for phase, d := range durations {
+		usKey := counter.EndpointKey(counter.NamePhaseUs, method, path)
+		usKey.Labels = counter.Labels("phase", phase)
+		nKey := usKey
+		nKey.Name = counter.NamePhaseN
+		counter.Add(usKey, int(d/time.Microsecond))
+		counter.Inc(nKey)
+	}
+}
@@ -0,0 +1,105 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// Outbound proxy of the benchmark traffic set by SetProxy. nil for direct connections.
+var proxyURL *url.URL
+
+// Sends all benchmark traffic through an HTTP or SOCKS5 proxy, e.g. http://proxy:3128 or
+// socks5://proxy:1080. Call before any request.
+//
+// HTTP proxies tunnel every connection with CONNECT, also for http remotes. Otherwise the proxy
+// would route plain requests by their Host header (TorbAppHost) instead of the remote.
+func SetProxy(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("invalid proxy %q: %v", spec, err)
+	}
+	switch u.Scheme {
+	case "http", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("invalid proxy %q: scheme must be http or socks5", spec)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid proxy %q: host is missing", spec)
+	}
+
+	proxyURL = u
+	return nil
+}
+
+// Proxy of the transports. HTTP proxies are dialed by dialTarget instead.
+func proxyFor(req *http.Request) (*url.URL, error) {
+	if proxyURL == nil || proxyURL.Scheme == "http" || isUnixSocket(req.URL.Host) {
+		return nil, nil
+	}
+	return proxyURL, nil
+}
+
+func isUnixSocket(host string) bool {
+	_, ok := GetUnixSocket(host)
+	return ok
+}
+
+// Dials addr through a CONNECT tunnel of the HTTP proxy
+func dialConnect(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.Username()+":"+password)))
+	}
+
+	// Unblocks the handshake below when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: %s", addr, res.Status)
+	}
+	if br.Buffered() > 0 {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: unexpected data after the response", addr)
+	}
+	return conn, nil
+}
@@ -0,0 +1,251 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every request sent through the shared transport can be recorded with StartRecording into a gob
+// stream of a RecordingHeader followed by RecordedRequests, and re-issued later by Replay with the
+// same timing, headers (including cookies) and bodies, so that a failure depending on the order of
+// concurrent requests can be reproduced.
+type RecordingHeader struct {
+	Version   int
+	Seed      int64
+	StartedAt time.Time
+	AppHost   string
+}
+
+type RecordedRequest struct {
+	Offset    time.Duration // since StartedAt
+	Method    string
+	URI       string
+	Header    http.Header
+	Body      []byte
+	Scenario  string
+	Status    int // 0 if the request failed
+	Latency   time.Duration
+	RequestID string
+}
+
+const recordingVersion = 1
+
+var (
+	recordMtx     sync.Mutex
+	recordFile    *os.File
+	recordWriter  *bufio.Writer
+	recordEncoder *gob.Encoder
+	recordStart   time.Time
+)
+
+// Starts recording the requests into path. seed is stored so that the run can be related to its seed.
+func StartRecording(path string, seed int64) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	recordMtx.Lock()
+	defer recordMtx.Unlock()
+
+	recordFile = f
+	recordWriter = bufio.NewWriter(f)
+	recordEncoder = gob.NewEncoder(recordWriter)
+	recordStart = time.Now()
+	return recordEncoder.Encode(&RecordingHeader{
+		Version:   recordingVersion,
+		Seed:      seed,
+		StartedAt: recordStart,
+		AppHost:   TorbAppHost,
+	})
+}
+
+// Stops recording and closes the file
+func StopRecording() error {
+	recordMtx.Lock()
+	defer recordMtx.Unlock()
+
+	if recordFile == nil {
+		return nil
+	}
+	err := recordWriter.Flush()
+	if cerr := recordFile.Close(); err == nil {
+		err = cerr
+	}
+	recordFile, recordWriter, recordEncoder = nil, nil, nil
+	return err
+}
+
+func isRecording() bool {
+	recordMtx.Lock()
+	defer recordMtx.Unlock()
+	return recordEncoder != nil
+}
+
+// Returns a copy of the request body without consuming it, or nil if it can not be copied
+func copyRequestBody(req *http.Request) []byte {
+	if req.Body == nil || req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+	b, _ := ioutil.ReadAll(body)
+	return b
+}
+
+func recordRequest(req *http.Request, body []byte, startedAt time.Time, res *http.Response) {
+	r := &RecordedRequest{
+		Method:    req.Method,
+		URI:       req.URL.RequestURI(),
+		Header:    req.Header.Clone(),
+		Body:      body,
+		Scenario:  CallerScenario(),
+		Latency:   time.Since(startedAt),
+		RequestID: req.Header.Get(RequestIDHeader),
+	}
+	if res != nil {
+		r.Status = res.StatusCode
+	}
+
+	recordMtx.Lock()
+	defer recordMtx.Unlock()
+	if recordEncoder == nil {
+		return
+	}
+	r.Offset = startedAt.Sub(recordStart)
+	if err := recordEncoder.Encode(r); err != nil {
+		log.Println("warn: failed to record a request", err)
+	}
+}
+
+// Reads a recording made by StartRecording. The requests are sorted by Offset.
+func ReadRecording(path string) (*RecordingHeader, []*RecordedRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(f))
+	header := new(RecordingHeader)
+	if err := dec.Decode(header); err != nil {
+		return nil, nil, fmt.Errorf("invalid recording %s: %v", path, err)
+	}
+	if header.Version != recordingVersion {
+		return nil, nil, fmt.Errorf("unsupported recording version %d", header.Version)
+	}
+
+	var requests []*RecordedRequest
+	for {
+		r := new(RecordedRequest)
+		err := dec.Decode(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a recording cut by a crash is replayed as far as it goes
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid recording %s: %v", path, err)
+		}
+		requests = append(requests, r)
+	}
+	sort.SliceStable(requests, func(i, j int) bool { return requests[i].Offset < requests[j].Offset })
+	return header, requests, nil
+}
+
+// Result of a replayed request which did not get the recorded status code
+type ReplayMismatch struct {
+	Request *RecordedRequest
+	Status  int // 0 if the request failed
+	Err     error
+}
+
+func (m ReplayMismatch) String() string {
+	r := m.Request
+	got := fmt.Sprint(m.Status)
+	if m.Err != nil {
+		got = m.Err.Error()
+	}
+	return fmt.Sprintf("%v %s %s (%s %s) recorded=%d replayed=%s", r.Offset, r.Method, r.URI, r.Scenario, r.RequestID, r.Status, got)
+}
+
+// Re-issues the requests against the target hosts at their recorded offsets, and returns the ones
+// whose status code differs from the recording
+func Replay(ctx context.Context, requests []*RecordedRequest) []ReplayMismatch {
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var (
+		mu         sync.Mutex
+		mismatches []ReplayMismatch
+		wg         sync.WaitGroup
+	)
+	start := time.Now()
+	for _, r := range requests {
+		if d := time.Until(start.Add(r.Offset)); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(r *RecordedRequest) {
+			defer wg.Done()
+			status, err := replayRequest(ctx, client, r)
+			if status != r.Status {
+				mu.Lock()
+				mismatches = append(mismatches, ReplayMismatch{r, status, err})
+				mu.Unlock()
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Request.Offset < mismatches[j].Request.Offset })
+	return mismatches
+}
+
+func replayRequest(ctx context.Context, client *http.Client, r *RecordedRequest) (int, error) {
+	var body io.Reader
+	if r.Body != nil {
+		body = strings.NewReader(string(r.Body))
+	}
+	req, err := http.NewRequest(r.Method, "http://"+TorbAppHost+r.URI, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header = r.Header.Clone()
+	req.Host = TorbAppHost
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutOf(r.Method, r.URI))
+	defer cancel()
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	return res.StatusCode, nil
+}
@@ -0,0 +1,159 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Scenarios register themselves from init functions with the Register* functions below, and the
+// benchmarker picks up all of them on start. A new scenario needs only its own file.
+//
+//	func init() {
+//		RegisterCheck(CheckSomething)
+//		RegisterLoad(10, LoadSomething)
+//	}
+//
+// The scenario name used in logs, traces and results is the name of the function.
+type ScenarioFunc func(ctx context.Context, state *State) error
+
+type ScenarioKind int
+
+const (
+	ScenarioCheck          ScenarioKind = iota // runs in preTest and at random during the load
+	ScenarioEveryCheck                         // runs in preTest and every EveryCheckerInterval
+	ScenarioLoad                               // load scenario picked in proportion to Weight
+	ScenarioLoadAndLevelUp                     // load scenario also started on every level up
+	ScenarioPostTest                           // runs after the load, in the registered order
+)
+
+type Scenario struct {
+	Name   string
+	Kind   ScenarioKind
+	Weight int      // only for load scenarios
+	After  []string // only for checks, see RegisterCheckAfter
+	Func   ScenarioFunc
+}
+
+var (
+	scenarioMtx sync.Mutex
+	scenarios   []Scenario
+)
+
+func register(kind ScenarioKind, weight int, f ScenarioFunc) {
+	registerNamed(scenarioName(f), kind, weight, f)
+}
+
+func registerNamed(name string, kind ScenarioKind, weight int, f ScenarioFunc) {
+	scenarioMtx.Lock()
+	defer scenarioMtx.Unlock()
+
+	for _, s := range scenarios {
+		if s.Name == name && s.Kind == kind {
+			panic(fmt.Sprintf("bench: scenario %s is registered twice", name))
+		}
+	}
+	scenarios = append(scenarios, Scenario{Name: name, Kind: kind, Weight: weight, Func: f})
+}
+
+func scenarioName(f ScenarioFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+func RegisterCheck(f ScenarioFunc) {
+	register(ScenarioCheck, 0, f)
+}
+
+// Registers a check which depends on the checks after, e.g. because it uses the fixtures they put or
+// reads what they change. The checks form a graph sorted by SortedChecks. During the load, a check runs
+// only after its dependencies have finished in the same round, and is skipped if any of them failed.
+// The checks run in parallel otherwise.
+func RegisterCheckAfter(f ScenarioFunc, after ...ScenarioFunc) {
+	register(ScenarioCheck, 0, f)
+
+	scenarioMtx.Lock()
+	defer scenarioMtx.Unlock()
+	s := &scenarios[len(scenarios)-1]
+	for _, a := range after {
+		s.After = append(s.After, scenarioName(a))
+	}
+}
+
+func RegisterEveryCheck(f ScenarioFunc) {
+	register(ScenarioEveryCheck, 0, f)
+}
+
+func RegisterLoad(weight int, f ScenarioFunc) {
+	register(ScenarioLoad, weight, f)
+}
+
+func RegisterLoadAndLevelUp(weight int, f ScenarioFunc) {
+	register(ScenarioLoadAndLevelUp, weight, f)
+}
+
+func RegisterPostTest(f ScenarioFunc) {
+	register(ScenarioPostTest, 0, f)
+}
+
+// Returns the registered scenarios in the registered order
+func RegisteredScenarios() []Scenario {
+	scenarioMtx.Lock()
+	defer scenarioMtx.Unlock()
+	return append([]Scenario(nil), scenarios...)
+}
+
+// Returns the checks sorted so that every check comes after its dependencies, in the registered order
+// otherwise. Returns an error if a dependency is not a check or the dependencies have a cycle.
+func SortedChecks() ([]Scenario, error) {
+	var checks []Scenario
+	for _, s := range RegisteredScenarios() {
+		if s.Kind == ScenarioCheck {
+			checks = append(checks, s)
+		}
+	}
+
+	isCheck := map[string]bool{}
+	for _, s := range checks {
+		isCheck[s.Name] = true
+	}
+	for _, s := range checks {
+		for _, dep := range s.After {
+			if !isCheck[dep] {
+				return nil, fmt.Errorf("bench: %s depends on %s which is not a check", s.Name, dep)
+			}
+		}
+	}
+
+	sorted := make([]Scenario, 0, len(checks))
+	added := map[string]bool{}
+	for len(sorted) < len(checks) {
+		n := len(sorted)
+		for _, s := range checks {
+			if added[s.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range s.After {
+				ready = ready && added[dep]
+			}
+			if ready {
+				sorted = append(sorted, s)
+				added[s.Name] = true
+			}
+		}
+		if len(sorted) == n {
+			var cycle []string
+			for _, s := range checks {
+				if !added[s.Name] {
+					cycle = append(cycle, s.Name)
+				}
+			}
+			return nil, fmt.Errorf("bench: dependencies of the checks have a cycle in %s", strings.Join(cycle, ", "))
+		}
+	}
+	return sorted, nil
+}
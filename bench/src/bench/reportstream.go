@@ -0,0 +1,113 @@
+package bench
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Checks the rows of a report while it is read, without the reservations known to the bench since
+// they are changing during the load. Only the rows of eventID are expected unless it is 0.
+func checkReportStream(s *State, eventID uint) func(res *http.Response, r io.Reader) error {
+	return func(res *http.Response, r io.Reader) error {
+		reader := csv.NewReader(r)
+		reader.ReuseRecord = true
+		if err := checkReportHeader(reader); err != nil {
+			return err
+		}
+
+		events := map[uint]*Event{}
+		seen := map[uint]struct{}{}
+		var prev *ReportRecord
+		line := 0
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			line++
+
+			record, err := parseReportRow(row, line)
+			if err != nil {
+				return err
+			}
+
+			if eventID != 0 && record.EventID != eventID {
+				log.Printf("debug: event id=%d is not expected:%d (reservationID:%d)\n", record.EventID, eventID, record.ReservationID)
+				return fatalErrorf("レポート(予約id:%d)のイベントidが正しくありません", record.ReservationID)
+			}
+
+			// events being created may not be known yet
+			event, ok := events[record.EventID]
+			if !ok {
+				event = s.FindEventByID(record.EventID)
+				events[record.EventID] = event
+			}
+			if event != nil {
+				if expected := event.Price + GetSheetKindByRank(record.SheetRank).Price; record.SheetPrice != expected {
+					log.Printf("debug: price:%d is not expected:%d (reservationID:%d)\n", record.SheetPrice, expected, record.ReservationID)
+					return fatalErrorf("レポート(予約id:%d)のシート価格が正しくありません", record.ReservationID)
+				}
+			}
+
+			if _, ok := seen[record.ReservationID]; ok {
+				log.Printf("debug: duplicated reservationID:%d (line:%d)\n", record.ReservationID, line)
+				return fatalErrorf("レポートに予約id:%dの行が重複しています", record.ReservationID)
+			}
+			seen[record.ReservationID] = struct{}{}
+
+			// the rows are sorted by sold_at
+			if prev != nil && record.SoldAt.Before(prev.SoldAt) {
+				log.Printf("debug: sold_at:%s is before the previous row's %s (line:%d)\n", record.SoldAt, prev.SoldAt, line)
+				return fatalErrorf("レポートの行が販売時刻の順に並んでいません (予約id:%d)", record.ReservationID)
+			}
+			prev = record
+		}
+		return nil
+	}
+}
+
+// Reads the reports while the reservations are happening, which the reports have to lock.
+// They are checked row by row as they are streamed, since the full report grows with the load.
+func LoadReportStream(ctx context.Context, state *State) error {
+	admin, checker, push := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer push()
+
+	err := loginAdministrator(ctx, checker, admin)
+	if err != nil {
+		return err
+	}
+
+	// Since no reserve/cancel occurs for closed events, we ignore closed events.
+	if event := state.GetRandomPublicEvent(); event != nil {
+		err = checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               fmt.Sprintf("/admin/api/reports/events/%d/sales", event.ID),
+			ExpectedStatusCode: 200,
+			Description:        "予約中のイベントのレポートを取得できること",
+			StreamFunc:         checkReportStream(state, event.ID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               "/admin/api/reports/sales",
+		ExpectedStatusCode: 200,
+		Description:        "予約中に全体のレポートを取得できること",
+		StreamFunc:         checkReportStream(state, 0),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -5,7 +5,7 @@ import (
 	"bench/parameter"
 	"bytes"
 	"context"
-	"crypto/md5"
+	"crypto/sha256"
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
@@ -20,6 +20,7 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -27,11 +28,54 @@ import (
 	"golang.org/x/net/html"
 )
 
+func init() {
+	RegisterLoad(10, LoadCreateUser)
+	RegisterLoad(10, LoadMyPage)
+	RegisterLoad(10, LoadEventReport)
+	RegisterLoad(10, LoadAdminTopPage)
+	RegisterLoad(1, LoadReport)
+	RegisterLoadAndLevelUp(30, LoadTopPage)
+	RegisterLoadAndLevelUp(10, LoadReserveCancelSheet)
+	RegisterLoadAndLevelUp(20, LoadReserveSheet)
+	RegisterLoadAndLevelUp(30, LoadGetEvent)
+
+	RegisterCheck(CheckStaticFiles)
+	RegisterCheck(CheckConditionalGet)
+	RegisterCheck(CheckCreateUser)
+	RegisterCheckAfter(CheckLogin, CheckCreateUser)
+	RegisterCheck(CheckTopPage)
+	RegisterCheck(CheckAdminTopPage)
+	RegisterCheck(CheckReserveSheet)
+	RegisterCheck(CheckAdminLogin)
+	RegisterCheck(CheckCreateEvent)
+	RegisterCheckAfter(CheckAdminEventLifecycle, CheckAdminLogin)
+	RegisterCheckAfter(CheckMyPage, CheckReserveSheet)
+	RegisterCheck(CheckUserDetail)
+	RegisterCheck(CheckDuplicateRegistration)
+	RegisterCheckAfter(CheckCancelReserveSheet, CheckReserveSheet)
+	RegisterCheckAfter(CheckGetEvent, CheckCreateEvent)
+	RegisterCheck(CheckDoubleBooking)
+	RegisterCheck(CheckSheetRankAndPrice)
+	RegisterCheck(CheckSoldOutRank)
+	RegisterCheck(CheckCancelFreesSheet)
+	RegisterCheck(CheckErrorResponses)
+	RegisterCheck(CheckSessionExpiry)
+	RegisterCheck(CheckAdminAccessControl)
+	RegisterCheck(CheckFuzzInput)
+
+	RegisterEveryCheck(CheckSheetReservationEntropy)
+	RegisterEveryCheck(CheckRemainsInvariant)
+
+	RegisterPostTest(CheckReport)
+	RegisterPostTest(CheckLedger)
+	RegisterPostTest(CheckSheetRandomness)
+}
+
 func checkHTML(f func(*http.Response, *goquery.Document) error) func(*http.Response, *bytes.Buffer) error {
 	return func(res *http.Response, body *bytes.Buffer) error {
 		doc, err := goquery.NewDocumentFromReader(body)
 		if err != nil {
-			return fatalErrorf("ページのHTMLがパースできませんでした")
+			return withErrorCode(ErrorCodeWrongBody, "", "", fatalErrorf("ページのHTMLがパースできませんでした"))
 		}
 		return f(res, doc)
 	}
@@ -41,7 +85,7 @@ func checkRedirectStatusCode(res *http.Response, body *bytes.Buffer) error {
 	if res.StatusCode == 302 || res.StatusCode == 303 {
 		return nil
 	}
-	return fmt.Errorf("期待していないステータスコード %d Expected 302 or 303", res.StatusCode)
+	return errorf("期待していないステータスコード %d Expected 302 or 303", res.StatusCode)
 }
 
 func checkJsonErrorResponse(errorCode string) func(res *http.Response, body *bytes.Buffer) error {
@@ -54,12 +98,24 @@ func checkJsonErrorResponse(errorCode string) func(res *http.Response, body *byt
 			return fatalErrorf("Jsonのデコードに失敗 %s %v", string(bytes), err)
 		}
 		if jsonError.Error != errorCode {
-			return fatalErrorf("正しいエラーコードを取得できません %s", jsonError.Error)
+			return withErrorCode(ErrorCodeContractViolation, errorCode, jsonError.Error, fatalErrorf("正しいエラーコードを取得できません %s", jsonError.Error))
 		}
 		return nil
 	}
 }
 
+// Timestamps returned by the app must be between the time the request was sent and the time the response was received.
+// The app returns them in seconds, so the lower bound is truncated. A zero completedAt means the response is not received yet.
+func isPlausibleTimestamp(at time.Time, requestedAt time.Time, completedAt time.Time) bool {
+	if !requestedAt.IsZero() && at.Before(requestedAt.Add(-parameter.ClockSkewTolerance).Truncate(time.Second)) {
+		return false
+	}
+	if !completedAt.IsZero() && at.After(completedAt.Add(parameter.ClockSkewTolerance)) {
+		return false
+	}
+	return true
+}
+
 func checkEventList(state *State, eventsBeforeRequest []*Event, events []JsonEvent, eventsAfterResponse []*Event) error {
 	eventsMap := map[uint]JsonEvent{}
 	for _, e := range events {
@@ -171,6 +227,35 @@ func checkEventList(state *State, eventsBeforeRequest []*Event, events []JsonEve
 	return nil
 }
 
+// Public event list must be ordered by id and must not contain events which are known to be private or closed.
+// Events in the state never change their flags after they are pushed, so there is no race with the admin.
+func checkPublicEventList(state *State, events []JsonEvent) error {
+	for i := 1; i < len(events); i++ {
+		if events[i-1].ID >= events[i].ID {
+			log.Printf("warn: checkPublicEventList: events[%d].ID:%d >= events[%d].ID:%d\n", i-1, events[i-1].ID, i, events[i].ID)
+			return fatalErrorf("トップページのイベントの順番が正しくありません")
+		}
+	}
+
+	nonPublicEvents := map[uint]*Event{}
+	for _, e := range state.GetEvents() {
+		if !e.PublicFg {
+			nonPublicEvents[e.ID] = e
+		}
+	}
+	for _, e := range events {
+		if event, ok := nonPublicEvents[e.ID]; ok {
+			log.Printf("warn: checkPublicEventList: event(id:%d) public:%t closed:%t is listed\n", event.ID, event.PublicFg, event.ClosedFg)
+			if event.ClosedFg {
+				return fatalErrorf("トップページに終了したイベント(id:%d)が表示されています", e.ID)
+			}
+			return fatalErrorf("トップページに非公開のイベント(id:%d)が表示されています", e.ID)
+		}
+	}
+
+	return nil
+}
+
 func checkJsonFullUserResponse(user *AppUser, check func(*JsonFullUser) error) func(res *http.Response, body *bytes.Buffer) error {
 	return func(res *http.Response, body *bytes.Buffer) error {
 		bytes := body.Bytes()
@@ -222,6 +307,14 @@ func checkJsonFullUserResponse(user *AppUser, check func(*JsonFullUser) error) f
 	}
 }
 
+var staticFileByPath = func() map[string]*StaticFile {
+	m := map[string]*StaticFile{}
+	for _, sf := range StaticFiles {
+		m[sf.Path] = sf
+	}
+	return m
+}()
+
 func loadStaticFile(ctx context.Context, checker *Checker, path string) error {
 	return checker.Play(ctx, &CheckAction{
 		EnableCache: true,
@@ -231,11 +324,17 @@ func loadStaticFile(ctx context.Context, checker *Checker, path string) error {
 		CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
 			// Note. EnableCache時はPlay時に自動でReponseは最後まで読まれる
 			if res.StatusCode == http.StatusOK {
-				counter.IncKey("staticfile-200")
+				// served content is verified also during the load, not only by CheckStaticFiles
+				if sf := staticFileByPath[path]; sf != nil {
+					if err := checkStaticFileBody(sf, body); err != nil {
+						return err
+					}
+				}
+				counter.Inc(counter.Key{Name: counter.NameStaticFile, Labels: counter.Labels("status", "200", "device", checker.userAgent.device)})
 			} else if res.StatusCode == http.StatusNotModified {
-				counter.IncKey("staticfile-304")
+				counter.Inc(counter.Key{Name: counter.NameStaticFile, Labels: counter.Labels("status", "304", "device", checker.userAgent.device)})
 			} else {
-				return fmt.Errorf("期待していないステータスコード %d", res.StatusCode)
+				return errorf("期待していないステータスコード %d", res.StatusCode)
 			}
 			return nil
 		},
@@ -403,6 +502,10 @@ func LoadReserveCancelSheet(ctx context.Context, state *State) error {
 	}
 	defer eventSheetPush() // NOTE: push only after reserve succeeds
 
+	if parameter.CancelReserveRatio >= 0 && !state.ShouldCancel() {
+		return nil
+	}
+
 	already_locked, err := cancelSheet(ctx, state, userChecker, user, eventSheet, reservation)
 	if err != nil {
 		return err
@@ -443,6 +546,13 @@ func LoadReserveSheet(ctx context.Context, state *State) error {
 	}
 	defer eventSheetPush() // NOTE: push only after reserve succeeds
 
+	if parameter.CancelReserveRatio >= 0 && state.ShouldCancel() {
+		_, err := cancelSheet(ctx, state, userChecker, user, eventSheet, reservation)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -503,7 +613,15 @@ func CheckGetEvent(ctx context.Context, state *State) error {
 
 	var beforeEvent *Event
 	if reservation == nil {
-		beforeEvent = CopyEvent(state.GetRandomPublicEvent())
+		// the event CheckCreateEvent has just published, if any
+		if id, ok := takeFixture(ctx, fixtureCreatedEventID); ok {
+			if event := state.GetEventByID(id.(uint)); event != nil && event.PublicFg {
+				beforeEvent = CopyEvent(event)
+			}
+		}
+		if beforeEvent == nil {
+			beforeEvent = CopyEvent(state.GetRandomPublicEvent())
+		}
 	} else {
 		beforeEvent = CopyEvent(state.GetEventByID(reservation.EventID))
 		if !beforeEvent.PublicFg {
@@ -559,7 +677,8 @@ func CheckGetEvent(ctx context.Context, state *State) error {
 				}
 			}
 
-			if sheet.ReservedAt == 0 || !(reservation.ReserveCompletedAt.Unix() == int64(sheet.ReservedAt) || time.Unix(int64(sheet.ReservedAt), 0).Before(reservation.ReserveCompletedAt)) {
+			if sheet.ReservedAt == 0 || !isPlausibleTimestamp(time.Unix(int64(sheet.ReservedAt), 0), reservation.ReserveRequestedAt, reservation.ReserveCompletedAt) {
+				log.Printf("warn: reserved_at=%d is not between %s and %s (reservationID:%d)\n", sheet.ReservedAt, reservation.ReserveRequestedAt, reservation.ReserveCompletedAt, reservation.ID)
 				return fatalErrorf("シート(%s-%d)の予約時刻が正しくありません(id:%d)", reservation.SheetRank, reservation.SheetNum, event.ID)
 			}
 
@@ -591,7 +710,6 @@ func LoadReport(ctx context.Context, state *State) error {
 		Path:               "/admin/api/reports/sales",
 		ExpectedStatusCode: 200,
 		Description:        "レポートを取得できること",
-		Timeout:            parameter.PostTestReportTimeout,
 	})
 	if err != nil {
 		return err
@@ -644,27 +762,191 @@ func CheckStaticFiles(ctx context.Context, state *State) error {
 
 	for _, staticFile := range StaticFiles {
 		sf := staticFile
+		var content []byte
 		err := checker.Play(ctx, &CheckAction{
 			Method:             "GET",
 			Path:               sf.Path,
 			ExpectedStatusCode: 200,
 			Description:        "静的ファイルが取得できること",
 			CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
-				hasher := md5.New()
-				_, err := io.Copy(hasher, body)
-				if err != nil {
-					return fatalErrorf("レスポンスボディの取得に失敗 %v", err)
+				if err := checkStaticFileBody(sf, body); err != nil {
+					return err
+				}
+				content = append([]byte(nil), body.Bytes()...)
+				return nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		err = checkStaticFileRange(ctx, checker, sf, content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Requests a random byte range of the static file, and then a range beyond its end. The app may
+// serve the partial content or refuse the range with the whole file (or 416 for the latter), but
+// must not serve anything else. content is the whole file already verified.
+func checkStaticFileRange(ctx context.Context, checker *Checker, sf *StaticFile, content []byte) error {
+	start := rand.Int63n(sf.Size)
+	end := start + rand.Int63n(sf.Size-start)
+	err := checker.Play(ctx, &CheckAction{
+		Method:      "GET",
+		Path:        sf.Path,
+		Headers:     map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", start, end)},
+		Description: "Rangeリクエストに対して静的ファイルの一部または全体が返却されること",
+		CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+			switch res.StatusCode {
+			case http.StatusOK:
+				if err := checkStaticFileBody(sf, body); err != nil {
+					return err
+				}
+				counter.Inc(counter.Key{Name: "anticheat", Labels: counter.Labels("check", "staticfile-range-refused")})
+				return nil
+			case http.StatusPartialContent:
+				if got, expected := res.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-%d/%d", start, end, sf.Size); got != expected {
+					return fatalErrorf("Content-Rangeが正しくありません expected '%s', got '%s'", expected, got)
 				}
-				hash := hex.EncodeToString(hasher.Sum(nil))
-				if hash != sf.Hash {
-					return fatalErrorf("静的ファイルの内容が正しくありません")
+				if !bytes.Equal(body.Bytes(), content[start:end+1]) {
+					return fatalErrorf("静的ファイルの部分コンテンツが正しくありません")
 				}
+				counter.Inc(counter.Key{Name: "anticheat", Labels: counter.Labels("check", "staticfile-range-partial")})
+				return nil
+			default:
+				return errorf("期待していないステータスコード %d", res.StatusCode)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return checker.Play(ctx, &CheckAction{
+		Method:      "GET",
+		Path:        sf.Path,
+		Headers:     map[string]string{"Range": fmt.Sprintf("bytes=%d-", sf.Size)},
+		Description: "範囲外のRangeリクエストに対して416または静的ファイル全体が返却されること",
+		CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+			switch res.StatusCode {
+			case http.StatusOK:
+				return checkStaticFileBody(sf, body)
+			case http.StatusRequestedRangeNotSatisfiable:
+				counter.Inc(counter.Key{Name: "anticheat", Labels: counter.Labels("check", "staticfile-range-unsatisfiable")})
 				return nil
+			default:
+				return errorf("期待していないステータスコード %d", res.StatusCode)
+			}
+		},
+	})
+}
+
+// Stale validators which must never produce 304 Not Modified
+const (
+	staleETag         = `"isucon8q-stale-etag"`
+	staleLastModified = "Mon, 01 Jan 2001 00:00:00 GMT"
+)
+
+// Compares the static file with its golden SHA-256, counted as anticheat|check=staticfile-checksum
+func checkStaticFileBody(sf *StaticFile, body *bytes.Buffer) error {
+	if int64(body.Len()) != sf.Size {
+		err := fatalErrorf("静的ファイルのサイズが正しくありません expected %d, got %d", sf.Size, body.Len())
+		return withErrorCode(ErrorCodeWrongBody, strconv.FormatInt(sf.Size, 10), strconv.Itoa(body.Len()), err)
+	}
+	sum := sha256.Sum256(body.Bytes())
+	if actual := hex.EncodeToString(sum[:]); actual != sf.SHA256 {
+		return withErrorCode(ErrorCodeWrongBody, sf.SHA256, actual, fatalErrorf("静的ファイルの内容が正しくありません"))
+	}
+	counter.Inc(counter.Key{Name: "anticheat", Labels: counter.Labels("check", "staticfile-checksum")})
+	return nil
+}
+
+// Checks that conditional GETs of static files follow the 304 semantics so that
+// the staticfile-304 score can not be gained by returning 304 unconditionally.
+func CheckConditionalGet(ctx context.Context, state *State) error {
+	user, checker, push := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer push()
+
+	for _, staticFile := range StaticFiles {
+		sf := staticFile
+
+		var etag, lastModified string
+		err := checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               sf.Path,
+			ExpectedStatusCode: 200,
+			Description:        "条件付きでないリクエストには静的ファイルが返却されること",
+			CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+				etag = res.Header.Get("ETag")
+				lastModified = res.Header.Get("Last-Modified")
+				return checkStaticFileBody(sf, body)
 			},
 		})
 		if err != nil {
 			return err
 		}
+
+		if etag != "" || lastModified != "" {
+			headers := map[string]string{}
+			if etag != "" {
+				headers["If-None-Match"] = etag
+			}
+			if lastModified != "" {
+				headers["If-Modified-Since"] = lastModified
+			}
+			err = checker.Play(ctx, &CheckAction{
+				Method:      "GET",
+				Path:        sf.Path,
+				Headers:     headers,
+				Description: "最新のバリデータを送ると304または静的ファイルが返却されること",
+				CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+					switch res.StatusCode {
+					case http.StatusOK:
+						return checkStaticFileBody(sf, body)
+					case http.StatusNotModified:
+						if body.Len() != 0 {
+							return fatalErrorf("304レスポンスにボディが含まれています")
+						}
+						if got := res.Header.Get("ETag"); etag != "" && got != "" && got != etag {
+							return fatalErrorf("304レスポンスのETagが一致しません")
+						}
+						return nil
+					default:
+						return errorf("期待していないステータスコード %d", res.StatusCode)
+					}
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, headers := range []map[string]string{
+			{"If-None-Match": staleETag, "If-Modified-Since": staleLastModified},
+			{"If-None-Match": staleETag},
+			{"If-Modified-Since": staleLastModified},
+		} {
+			err = checker.Play(ctx, &CheckAction{
+				Method:             "GET",
+				Path:               sf.Path,
+				Headers:            headers,
+				ExpectedStatusCode: 200,
+				Description:        "古いバリデータを送ると静的ファイルが返却されること",
+				CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+					return checkStaticFileBody(sf, body)
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -765,12 +1047,21 @@ func CheckCreateUser(ctx context.Context, state *State) error {
 	}
 
 	newUserPush()
+	putFixture(ctx, fixtureCreatedUserID, user.ID)
 
 	return nil
 }
 
 func CheckLogin(ctx context.Context, state *State) error {
-	user, checker, push := state.PopRandomUser()
+	var user *AppUser
+	var checker *Checker
+	var push func()
+	if id, ok := takeFixture(ctx, fixtureCreatedUserID); ok {
+		user, checker, push = state.PopUserByID(id.(uint))
+	}
+	if user == nil {
+		user, checker, push = state.PopRandomUser()
+	}
 	if user == nil {
 		return nil
 	}
@@ -887,6 +1178,12 @@ func CheckTopPage(ctx context.Context, state *State) error {
 				return fatalErrorf("app-wrapperが見つかりません")
 			}
 
+			if StrictHTML {
+				if err := checkStrictIndexHTML(doc); err != nil {
+					return err
+				}
+			}
+
 			var found int
 			node := selection.Nodes[0]
 			for _, attr := range node.Attr {
@@ -906,11 +1203,9 @@ func CheckTopPage(ctx context.Context, state *State) error {
 						return fatalErrorf("トップページのイベントの数が正しくありません")
 					}
 
-					ok := sort.SliceIsSorted(events, func(i, j int) bool {
-						return events[i].ID < events[j].ID
-					})
-					if !ok {
-						return fatalErrorf("トップページのイベントの順番が正しくありません")
+					err = checkPublicEventList(state, events)
+					if err != nil {
+						return err
 					}
 
 					eventsAfterResponse := FilterPublicEvents(state.GetEvents())
@@ -1007,6 +1302,12 @@ func CheckAdminTopPage(ctx context.Context, state *State) error {
 				return fatalErrorf("app-wrapperが見つかりません")
 			}
 
+			if StrictHTML {
+				if err := checkStrictAdminHTML(doc); err != nil {
+					return err
+				}
+			}
+
 			var found int
 			node := selection.Nodes[0]
 			for _, attr := range node.Attr {
@@ -1205,8 +1506,8 @@ func CheckMyPage(ctx context.Context, state *State) error {
 				if reservation.ReserveCompletedAt.IsZero() {
 					log.Printf("warn: invalid reservation object is got=%#v\n", reservation)
 					return nil
-				} else if reservedAt := time.Unix(int64(r.ReservedAt), 0); reservation.ReserveCompletedAt.Before(reservedAt) {
-					log.Printf("warn: reserved at should be (reservationID:%d) %s < %s\n", reservation.ID, reservedAt, reservation.ReserveCompletedAt)
+				} else if reservedAt := time.Unix(int64(r.ReservedAt), 0); !isPlausibleTimestamp(reservedAt, reservation.ReserveRequestedAt, reservation.ReserveCompletedAt) {
+					log.Printf("warn: reserved at should be (reservationID:%d) %s <= %s <= %s\n", reservation.ID, reservation.ReserveRequestedAt, reservedAt, reservation.ReserveCompletedAt)
 					return fatalErrorf("最近予約した席の予約時刻が正しくありません userID=%d reservationID=%d", fullUser.ID, reservation.ID)
 				}
 
@@ -1224,18 +1525,10 @@ func CheckMyPage(ctx context.Context, state *State) error {
 						return fatalErrorf("最近予約した席のキャンセル時刻が正しくありません userID=%d reservationID=%d", fullUser.ID, reservation.ID)
 					}
 
-					cancelRequestedAt := reservation.CancelRequestedAt.Unix()
-					if reservation.CancelCompletedAt.IsZero() {
-						if !(cancelRequestedAt <= canceledAt) {
-							log.Printf("warn: miss match reservation cancellation status expected=not-canceled userID=%d reservationID=%d\n", fullUser.ID, reservation.ID)
-							return fatalErrorf("最近予約した席のキャンセル時刻が正しくありません userID=%d reservationID=%d", fullUser.ID, reservation.ID)
-						}
-					} else {
-						cancelCompletedAt := reservation.CancelCompletedAt.Unix()
-						if !(cancelRequestedAt <= canceledAt && canceledAt <= cancelCompletedAt) {
-							log.Printf("warn: miss match reservation cancellation status expected=not-canceled userID=%d reservationID=%d\n", fullUser.ID, reservation.ID)
-							return fatalErrorf("最近予約した席のキャンセル時刻が正しくありません userID=%d reservationID=%d", fullUser.ID, reservation.ID)
-						}
+					// CancelCompletedAt is zero while the cancelation is in flight
+					if !isPlausibleTimestamp(time.Unix(canceledAt, 0), reservation.CancelRequestedAt, reservation.CancelCompletedAt) {
+						log.Printf("warn: miss match reservation cancellation status expected=not-canceled userID=%d reservationID=%d\n", fullUser.ID, reservation.ID)
+						return fatalErrorf("最近予約した席のキャンセル時刻が正しくありません userID=%d reservationID=%d", fullUser.ID, reservation.ID)
 					}
 				}
 
@@ -1727,10 +2020,19 @@ func checkJsonEventResponse(event *Event, cb func(JsonEvent) error) func(res *ht
 			return fatalErrorf("イベント(id:%d)のシート定義が取得できません", event.ID)
 		}
 		for rank, sheets := range jsonEvent.Sheets {
-			sheetKind := DataSet.SheetKindMap[rank]
+			sheetKind, ok := DataSet.SheetKindMap[rank]
+			if !ok {
+				return fatalErrorf("イベント(id:%d)に存在しないランク(%s)のシートがあります", event.ID, rank)
+			}
 			if sheets.Details == nil || int(sheetKind.Total) != len(sheets.Details) {
 				return fatalErrorf("イベント(id:%d)のシートの詳細情報が取得できません", event.ID)
 			}
+			if sheets.Total != sheetKind.Total {
+				return fatalErrorf("イベント(id:%d)の%s席の総座席数が正しくありません", event.ID, rank)
+			}
+			if expected := event.Price + sheetKind.Price; sheets.Price != expected {
+				return fatalErrorf("イベント(id:%d)の%s席の価格が正しくありません", event.ID, rank)
+			}
 
 			reservedCount := 0
 			for i, sheet := range sheets.Details {
@@ -1939,123 +2241,433 @@ func CheckCreateEvent(ctx context.Context, state *State) error {
 		return err
 	}
 
-	return nil
-}
+	putFixture(ctx, fixtureCreatedEventID, event.ID)
 
-func checkReportHeader(reader *csv.Reader) error {
-	// reservation_id,event_id,rank,num,price,user_id,sold_at,canceled_at
-	row, err := reader.Read()
-	if err == io.EOF ||
-		len(row) != 8 ||
-		row[0] != "reservation_id" ||
-		row[1] != "event_id" ||
-		row[2] != "rank" ||
-		row[3] != "num" ||
-		row[4] != "price" ||
-		row[5] != "user_id" ||
-		row[6] != "sold_at" ||
-		row[7] != "canceled_at" {
-		return fatalErrorf("正しいCSVヘッダを取得できません")
-	}
 	return nil
 }
 
-func getReportRecords(s *State, reader *csv.Reader) (map[uint]*ReportRecord, error) {
-	// reservation_id,event_id,rank,num,price,user_id,sold_at,canceled_at
-	// 1,1,S,36,8000,1002,2018-08-17T04:55:30Z,2018-08-17T04:58:31Z
-	// 2,1,S,36,8000,1002,2018-08-17T04:55:32Z,
-	// 3,1,B,149,4000,1002,2018-08-17T04:55:33Z,
-	// 4,1,C,317,3000,1002,2018-08-17T04:55:34Z,
-	// 5,1,B,27,4000,1002,2018-08-17T04:55:36Z,
-	// 6,3,A,15,6000,1002,2018-08-17T04:55:38Z,
-	// 7,3,S,10,8000,1002,2018-08-17T04:55:41Z,2018-08-17T04:58:29Z
-
-	records := map[uint]*ReportRecord{}
-
-	line := 0
-	for {
-		row, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		line++
-
-		msg := "正しいCSVレポートを取得できません"
-
-		if len(row) != 8 {
-			return nil, fatalErrorf(msg)
-		}
-
-		reservationID, err := strconv.Atoi(row[0])
-		if err != nil {
-			log.Printf("debug: invalid reservationID (line:%d) error:%v\n", line, err)
-			return nil, fatalErrorf(msg)
-		}
-		eventID, err := strconv.Atoi(row[1])
-		if err != nil {
-			log.Printf("debug: invalid eventID (line:%d) error:%v\n", line, err)
-			return nil, fatalErrorf(msg)
-		}
-		sheetRank := row[2]
-
-		sheetNum, err := strconv.Atoi(row[3])
+func checkJsonFullEventStateResponse(event *Event) func(res *http.Response, body *bytes.Buffer) error {
+	return func(res *http.Response, body *bytes.Buffer) error {
+		bytes := body.Bytes()
+		dec := json.NewDecoder(body)
+		jsonEvent := JsonFullEvent{}
+		err := dec.Decode(&jsonEvent)
 		if err != nil {
-			log.Printf("debug: invalid sheetNum (line:%d) error:%v\n", line, err)
-			return nil, fatalErrorf(msg)
+			return fatalErrorf("Jsonのデコードに失敗 %s %v", string(bytes), err)
 		}
-
-		sheetPrice, err := strconv.Atoi(row[4])
-		if err != nil {
-			log.Printf("debug: invalid price (line:%d) error:%v\n", line, err)
-			return nil, fatalErrorf(msg)
+		if jsonEvent.ID != event.ID || jsonEvent.Title != event.Title || jsonEvent.Price != event.Price {
+			return fatalErrorf("正しいイベントを取得できません")
 		}
-
-		userID, err := strconv.Atoi(row[5])
-		if err != nil {
-			log.Printf("debug: invalid userID (line:%d) error:%v\n", line, err)
-			return nil, fatalErrorf(msg)
+		if jsonEvent.Public != event.PublicFg || jsonEvent.Closed != event.ClosedFg {
+			return fatalErrorf("イベント(id:%d)の公開状態が正しくありません", event.ID)
 		}
+		return nil
+	}
+}
 
-		_, err = time.Parse(time.RFC3339, row[6])
-		if err != nil {
-			log.Printf("debug: invalid soldAt (line:%d) error:%v\n", line, err)
-			return nil, fatalErrorf(msg)
-		}
+// イベントを作成してから締め切るまでの各状態で、イベントの公開状態と予約可否が参照実装と一致すること
+// NOTE: The event is pushed into the state only after it is closed so that no other scenario
+// expects it on the top page or reserves its sheets while its state is changing.
+// The reservation in this check is made by a new user who is not pushed back to the state either.
+func CheckAdminEventLifecycle(ctx context.Context, state *State) error {
+	admin, adminChecker, adminPush := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer adminPush()
 
-		var canceledAt time.Time
-		if row[7] != "" {
-			canceledAt, err = time.Parse(time.RFC3339, row[7])
-			if err != nil {
-				log.Printf("debug: invalid canceledAt (line:%d) error:%v\n", line, err)
-				return nil, fatalErrorf(msg)
-			}
-		}
+	user, userChecker, _ := state.PopNewUser()
+	if user == nil {
+		return nil
+	}
+	userChecker.ResetCookie()
 
-		record := &ReportRecord{
-			ReservationID: uint(reservationID),
-			EventID:       uint(eventID),
-			SheetRank:     sheetRank,
-			SheetNum:      uint(sheetNum),
-			SheetPrice:    uint(sheetPrice),
-			UserID:        uint(userID),
-			CanceledAt:    canceledAt,
-		}
+	err := loginAdministrator(ctx, adminChecker, admin)
+	if err != nil {
+		return err
+	}
 
-		records[record.ReservationID] = record
+	err = userChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/users",
+		ExpectedStatusCode: 201,
+		PostJSON: map[string]interface{}{
+			"nickname":   user.Nickname,
+			"login_name": user.LoginName,
+			"password":   user.Password,
+		},
+		Description: "新規ユーザが作成できること",
+		CheckFunc:   checkJsonUserCreateResponse(user),
+	})
+	if err != nil {
+		return err
 	}
 
-	return records, nil
-}
+	err = userChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/actions/login",
+		ExpectedStatusCode: 200,
+		PostJSON: map[string]interface{}{
+			"login_name": user.LoginName,
+			"password":   user.Password,
+		},
+		Description: "作成したユーザでログインできること",
+	})
+	if err != nil {
+		return err
+	}
 
-func checkReportRecord(s *State, records map[uint]*ReportRecord, timeBefore time.Time,
-	reservationsBeforeRequest map[uint]*Reservation) error {
+	event, newEventPush := state.CreateNewEvent()
+	event.PublicFg = false
 
-	for reservationID, reservationBeforeRequest := range reservationsBeforeRequest {
-		// All elements in reservationsBeforeRequest must exist in records
-		record, ok := records[reservationID]
-		if !ok {
-			log.Printf("debug: should exist (reservationID:%d)\n", reservationID)
-			return fatalErrorf("レポートに予約id:%dの行が存在しません", reservationID)
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/admin/api/events",
+		ExpectedStatusCode: 200,
+		Description:        "管理者が非公開イベントを作成できること",
+		PostJSON:           eventPostJSON(event),
+		CheckFunc:          checkJsonFullEventCreateResponse(event),
+	})
+	if err != nil {
+		return err
+	}
+
+	rank := GetRandomSheetRank()
+
+	checkVisibility := func(visible bool) error {
+		if visible {
+			err := userChecker.Play(ctx, &CheckAction{
+				Method:             "GET",
+				Path:               fmt.Sprintf("/api/events/%d", event.ID),
+				ExpectedStatusCode: 200,
+				Description:        "公開イベントを取得できること",
+				CheckFunc:          checkJsonEventResponse(event, nil),
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			err := userChecker.Play(ctx, &CheckAction{
+				Method:             "GET",
+				Path:               fmt.Sprintf("/api/events/%d", event.ID),
+				ExpectedStatusCode: 404,
+				Description:        "非公開イベントを取得できないこと",
+				CheckFunc:          checkJsonErrorResponse("not_found"),
+			})
+			if err != nil {
+				return err
+			}
+
+			err = userChecker.Play(ctx, &CheckAction{
+				Method:             "POST",
+				Path:               fmt.Sprintf("/api/events/%d/actions/reserve", event.ID),
+				ExpectedStatusCode: 404,
+				Description:        "非公開イベントのシートを予約できないこと",
+				PostJSON: map[string]interface{}{
+					"sheet_rank": rank,
+				},
+				CheckFunc: checkJsonErrorResponse("invalid_event"),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return userChecker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               "/api/events",
+			ExpectedStatusCode: 200,
+			Description:        "イベント一覧が取得できること",
+			CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+				var events []JsonEvent
+				err := json.NewDecoder(body).Decode(&events)
+				if err != nil {
+					return fatalErrorf("イベント一覧のJsonデコードに失敗 %v", err)
+				}
+				found := false
+				for _, e := range events {
+					if e.ID == event.ID {
+						found = true
+						break
+					}
+				}
+				if found != visible {
+					log.Printf("warn: CheckAdminEventLifecycle: event(id:%d) public:%t closed:%t found:%t\n", event.ID, event.PublicFg, event.ClosedFg, found)
+					return fatalErrorf("イベント一覧にイベント(id:%d)の公開状態が反映されていません", event.ID)
+				}
+				return nil
+			},
+		})
+	}
+
+	editEvent := func(description string) error {
+		return adminChecker.Play(ctx, &CheckAction{
+			Method:             "POST",
+			Path:               fmt.Sprintf("/admin/api/events/%d/actions/edit", event.ID),
+			ExpectedStatusCode: 200,
+			Description:        description,
+			PostJSON:           eventEditJSON(event),
+			CheckFunc:          checkJsonFullEventStateResponse(event),
+		})
+	}
+
+	// private
+	err = checkVisibility(false)
+	if err != nil {
+		return err
+	}
+
+	// private -> public
+	event.PublicFg = true
+	err = editEvent("管理者がイベントを公開できること")
+	if err != nil {
+		return err
+	}
+	err = checkVisibility(true)
+	if err != nil {
+		return err
+	}
+
+	reserved := JsonReservation{ReservationID: 0, SheetRank: rank, SheetNum: 0}
+	err = userChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               fmt.Sprintf("/api/events/%d/actions/reserve", event.ID),
+		ExpectedStatusCode: 202,
+		Description:        "公開イベントのシートを予約できること",
+		PostJSON: map[string]interface{}{
+			"sheet_rank": rank,
+		},
+		CheckFunc: checkJsonReservationResponse(&reserved),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = userChecker.Play(ctx, &CheckAction{
+		Method:             "DELETE",
+		Path:               fmt.Sprintf("/api/events/%d/sheets/%s/%d/reservation", event.ID, reserved.SheetRank, reserved.SheetNum),
+		ExpectedStatusCode: 204,
+		Description:        "公開イベントの予約をキャンセルできること",
+	})
+	if err != nil {
+		return err
+	}
+
+	// public -> closed is not allowed
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               fmt.Sprintf("/admin/api/events/%d/actions/edit", event.ID),
+		ExpectedStatusCode: 400,
+		Description:        "公開中のイベントを締め切れないこと",
+		PostJSON: map[string]bool{
+			"public": true,
+			"closed": true,
+		},
+		CheckFunc: checkJsonErrorResponse("cannot_close_public_event"),
+	})
+	if err != nil {
+		return err
+	}
+	err = checkVisibility(true)
+	if err != nil {
+		return err
+	}
+
+	// public -> private
+	event.PublicFg = false
+	err = editEvent("管理者がイベントを非公開にできること")
+	if err != nil {
+		return err
+	}
+	err = checkVisibility(false)
+	if err != nil {
+		return err
+	}
+
+	// private -> closed
+	event.ClosedFg = true
+	err = editEvent("管理者が非公開のイベントを締め切れること")
+	if err != nil {
+		return err
+	}
+	err = checkVisibility(false)
+	if err != nil {
+		return err
+	}
+
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               fmt.Sprintf("/admin/api/events/%d", event.ID),
+		ExpectedStatusCode: 200,
+		Description:        "管理者が締め切ったイベントを取得できること",
+		CheckFunc:          checkJsonFullEventStateResponse(event),
+	})
+	if err != nil {
+		return err
+	}
+
+	// closed events can not be edited any more
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               fmt.Sprintf("/admin/api/events/%d/actions/edit", event.ID),
+		ExpectedStatusCode: 400,
+		Description:        "締め切ったイベントを編集できないこと",
+		PostJSON: map[string]bool{
+			"public": true,
+			"closed": false,
+		},
+		CheckFunc: checkJsonErrorResponse("cannot_edit_closed_event"),
+	})
+	if err != nil {
+		return err
+	}
+
+	newEventPush("CheckAdminEventLifecycle")
+
+	return nil
+}
+
+func checkReportHeader(reader *csv.Reader) error {
+	// reservation_id,event_id,rank,num,price,user_id,sold_at,canceled_at
+	row, err := reader.Read()
+	if err == io.EOF ||
+		len(row) != 8 ||
+		row[0] != "reservation_id" ||
+		row[1] != "event_id" ||
+		row[2] != "rank" ||
+		row[3] != "num" ||
+		row[4] != "price" ||
+		row[5] != "user_id" ||
+		row[6] != "sold_at" ||
+		row[7] != "canceled_at" {
+		return fatalErrorf("正しいCSVヘッダを取得できません")
+	}
+	return nil
+}
+
+func getReportRecords(s *State, reader *csv.Reader) (map[uint]*ReportRecord, error) {
+	// reservation_id,event_id,rank,num,price,user_id,sold_at,canceled_at
+	// 1,1,S,36,8000,1002,2018-08-17T04:55:30Z,2018-08-17T04:58:31Z
+	// 2,1,S,36,8000,1002,2018-08-17T04:55:32Z,
+	// 3,1,B,149,4000,1002,2018-08-17T04:55:33Z,
+	// 4,1,C,317,3000,1002,2018-08-17T04:55:34Z,
+	// 5,1,B,27,4000,1002,2018-08-17T04:55:36Z,
+	// 6,3,A,15,6000,1002,2018-08-17T04:55:38Z,
+	// 7,3,S,10,8000,1002,2018-08-17T04:55:41Z,2018-08-17T04:58:29Z
+
+	records := map[uint]*ReportRecord{}
+
+	line := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+
+		record, err := parseReportRow(row, line)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := records[record.ReservationID]; ok {
+			log.Printf("debug: duplicated reservationID:%d (line:%d)\n", record.ReservationID, line)
+			return nil, fatalErrorf("レポートに予約id:%dの行が重複しています", record.ReservationID)
+		}
+
+		records[record.ReservationID] = record
+	}
+
+	return records, nil
+}
+
+// Parses a row of a report and checks it by itself
+func parseReportRow(row []string, line int) (*ReportRecord, error) {
+	msg := "正しいCSVレポートを取得できません"
+
+	if len(row) != 8 {
+		return nil, fatalErrorf(msg)
+	}
+
+	reservationID, err := strconv.Atoi(row[0])
+	if err != nil {
+		log.Printf("debug: invalid reservationID (line:%d) error:%v\n", line, err)
+		return nil, fatalErrorf(msg)
+	}
+	eventID, err := strconv.Atoi(row[1])
+	if err != nil {
+		log.Printf("debug: invalid eventID (line:%d) error:%v\n", line, err)
+		return nil, fatalErrorf(msg)
+	}
+	sheetRank := row[2]
+	sheetKind := GetSheetKindByRank(sheetRank)
+	if sheetKind == nil {
+		log.Printf("debug: invalid sheetRank:%s (line:%d)\n", sheetRank, line)
+		return nil, fatalErrorf(msg)
+	}
+
+	sheetNum, err := strconv.Atoi(row[3])
+	if err != nil {
+		log.Printf("debug: invalid sheetNum (line:%d) error:%v\n", line, err)
+		return nil, fatalErrorf(msg)
+	}
+	if sheetNum < 1 || uint(sheetNum) > sheetKind.Total {
+		log.Printf("debug: sheetNum:%d is out of range of rank %s (line:%d)\n", sheetNum, sheetRank, line)
+		return nil, fatalErrorf(msg)
+	}
+
+	sheetPrice, err := strconv.Atoi(row[4])
+	if err != nil {
+		log.Printf("debug: invalid price (line:%d) error:%v\n", line, err)
+		return nil, fatalErrorf(msg)
+	}
+
+	userID, err := strconv.Atoi(row[5])
+	if err != nil {
+		log.Printf("debug: invalid userID (line:%d) error:%v\n", line, err)
+		return nil, fatalErrorf(msg)
+	}
+
+	soldAt, err := time.Parse(time.RFC3339, row[6])
+	if err != nil {
+		log.Printf("debug: invalid soldAt (line:%d) error:%v\n", line, err)
+		return nil, fatalErrorf(msg)
+	}
+
+	var canceledAt time.Time
+	if row[7] != "" {
+		canceledAt, err = time.Parse(time.RFC3339, row[7])
+		if err != nil {
+			log.Printf("debug: invalid canceledAt (line:%d) error:%v\n", line, err)
+			return nil, fatalErrorf(msg)
+		}
+		if canceledAt.Before(soldAt) {
+			log.Printf("debug: canceledAt:%v is before soldAt:%v (line:%d)\n", canceledAt, soldAt, line)
+			return nil, fatalErrorf(msg)
+		}
+	}
+
+	return &ReportRecord{
+		ReservationID: uint(reservationID),
+		EventID:       uint(eventID),
+		SheetRank:     sheetRank,
+		SheetNum:      uint(sheetNum),
+		SheetPrice:    uint(sheetPrice),
+		UserID:        uint(userID),
+		SoldAt:        soldAt,
+		CanceledAt:    canceledAt,
+	}, nil
+}
+
+func checkReportRecord(s *State, records map[uint]*ReportRecord, timeBefore time.Time,
+	reservationsBeforeRequest map[uint]*Reservation) error {
+
+	for reservationID, reservationBeforeRequest := range reservationsBeforeRequest {
+		// All elements in reservationsBeforeRequest must exist in records
+		record, ok := records[reservationID]
+		if !ok {
+			log.Printf("debug: should exist (reservationID:%d)\n", reservationID)
+			return fatalErrorf("レポートに予約id:%dの行が存在しません", reservationID)
 		}
 
 		event := s.FindEventByID(record.EventID)
@@ -2085,6 +2697,16 @@ func checkReportRecord(s *State, records map[uint]*ReportRecord, timeBefore time
 			return fatalErrorf("レポート(予約id:%d)のシート番号が正しくありません", reservationID)
 		}
 
+		if !isPlausibleTimestamp(record.SoldAt, reservationBeforeRequest.ReserveRequestedAt, reservationBeforeRequest.ReserveCompletedAt) {
+			log.Printf("debug: sold_at:%s is not between %s and %s (reservationID:%d)\n", record.SoldAt, reservationBeforeRequest.ReserveRequestedAt, reservationBeforeRequest.ReserveCompletedAt, reservationID)
+			return fatalErrorf("レポート(予約id:%d)の予約時刻が正しくありません", reservationID)
+		}
+		if !record.CanceledAt.IsZero() && !reservationBeforeRequest.CancelRequestedAt.IsZero() &&
+			!isPlausibleTimestamp(record.CanceledAt, reservationBeforeRequest.CancelRequestedAt, reservationBeforeRequest.CancelCompletedAt) {
+			log.Printf("debug: canceled_at:%s is not between %s and %s (reservationID:%d)\n", record.CanceledAt, reservationBeforeRequest.CancelRequestedAt, reservationBeforeRequest.CancelCompletedAt, reservationID)
+			return fatalErrorf("レポート(予約id:%d)のキャンセル時刻が正しくありません", reservationID)
+		}
+
 		if reservationBeforeRequest.Canceled(timeBefore) {
 			if record.CanceledAt.IsZero() {
 				log.Printf("debug: should have canceledAt (reservationID:%d)\n", reservationID)
@@ -2207,7 +2829,6 @@ func CheckReport(ctx context.Context, state *State) error {
 		ExpectedStatusCode: 200,
 		Description:        "レポートを正しく取得できること",
 		CheckFunc:          checkReportResponse(state, timeBefore, reservationsBeforeRequest),
-		Timeout:            parameter.PostTestReportTimeout,
 	})
 	if err != nil {
 		return err
@@ -2335,6 +2956,71 @@ func CheckSheetReservationEntropy(ctx context.Context, state *State) error {
 	return nil
 }
 
+// 予約で割り当てられる席がランダムであること
+// ランダムに割り当てていれば空席も一様に散らばるので、半分以上埋まっていないランクでアプリが割り当てた席番号は一様分布になる。
+// 小さい番号から順に割り当てる実装では番号が小さい方に偏るので、負荷走行中に集めた席番号をカイ二乗検定する
+func CheckSheetRandomness(ctx context.Context, state *State) error {
+	const (
+		bins = 4
+		// chi-square critical value for 3 degrees of freedom at p=0.001
+		critical = 16.27
+	)
+
+	groups := map[string][]*Reservation{}
+	for _, reservation := range state.GetReservations() {
+		key := fmt.Sprintf("%d-%s", reservation.EventID, reservation.SheetRank)
+		groups[key] = append(groups[key], reservation)
+	}
+
+	// Bins are not of the same width unless the total of the rank is a multiple of bins,
+	// e.g. 13/12/13/12 sheets of S, so the expected count of each bin is proportional to its width
+	var counts [bins]int
+	var expected [bins]float64
+	var n int
+	for _, reservations := range groups {
+		sheetKind := GetSheetKindByRank(reservations[0].SheetRank)
+		if sheetKind == nil || uint(len(reservations)) > sheetKind.Total/2 {
+			continue
+		}
+		var widths [bins]int
+		for i := 0; i < int(sheetKind.Total); i++ {
+			widths[i*bins/int(sheetKind.Total)]++
+		}
+		for _, reservation := range reservations {
+			// initial reservations are not made by the app
+			if reservation.ReservedAt != 0 {
+				continue
+			}
+			if reservation.SheetNum < 1 || reservation.SheetNum > sheetKind.Total {
+				continue
+			}
+			counts[int(reservation.SheetNum-1)*bins/int(sheetKind.Total)]++
+			for i, width := range widths {
+				expected[i] += float64(width) / float64(sheetKind.Total)
+			}
+			n++
+		}
+	}
+	if n < parameter.SheetRandomnessMinSamples {
+		log.Printf("debug: CheckSheetRandomness: too few samples (%d)\n", n)
+		return nil
+	}
+
+	var chi2 float64
+	for i, count := range counts {
+		d := float64(count) - expected[i]
+		chi2 += d * d / expected[i]
+	}
+
+	log.Printf("debug: CheckSheetRandomness: samples=%d counts=%v chi2=%.2f\n", n, counts, chi2)
+	if chi2 > critical {
+		log.Printf("error: CheckSheetRandomness: sheet numbers are not uniformly distributed samples=%d counts=%v chi2=%.2f\n", n, counts, chi2)
+		return fatalErrorf("予約される席の分布がランダムではありません")
+	}
+
+	return nil
+}
+
 func loginAdministrator(ctx context.Context, checker *Checker, admin *Administrator) error {
 	return loginAdministratorWithTimeout(ctx, checker, admin, 0)
 }
@@ -2485,6 +3171,9 @@ func checkJsonReservationResponse(reserved *JsonReservation) func(res *http.Resp
 		if resReserved.SheetRank != reserved.SheetRank {
 			return fatalErrorf("正しい予約情報を取得できません")
 		}
+		if sheetKind := GetSheetKindByRank(resReserved.SheetRank); resReserved.SheetNum < 1 || resReserved.SheetNum > sheetKind.Total {
+			return fatalErrorf("予約した%s席のシート番号(%d)が正しくありません", resReserved.SheetRank, resReserved.SheetNum)
+		}
 		// Set reserved ID and Sheet Number from response
 		reserved.ReservationID = resReserved.ReservationID
 		reserved.SheetNum = resReserved.SheetNum
@@ -2538,6 +3227,11 @@ func cancelSheet(ctx context.Context, state *State, checker *Checker, user *AppU
 		log.Printf("debug: reservation:%d is already locked to cancel\n", reservation.ID)
 		return true, nil
 	}
+	// a reservation picked before the lock, e.g. from the ledger, may have been canceled meanwhile
+	if state.IsCancelRequested(reservation) {
+		log.Printf("debug: reservation:%d is already canceled\n", reservation.ID)
+		return true, nil
+	}
 
 	eventID := reservation.EventID
 	rank := reservation.SheetRank
@@ -2560,3 +3254,1356 @@ func cancelSheet(ctx context.Context, state *State, checker *Checker, user *AppU
 
 	return false, nil
 }
+
+// 同じイベントに対して別々のユーザが同時に予約しても、同じ席が二重に予約されないこと
+func CheckDoubleBooking(ctx context.Context, state *State) error {
+	n := parameter.DoubleBookingConcurrency
+
+	// Collect sheets of the same event. Sheets of the other events are pushed back as is.
+	var eventSheets []*EventSheet
+	for i := 0; i < n; i++ {
+		eventSheet, eventSheetPush := state.PopEventSheet()
+		if eventSheet == nil {
+			break
+		}
+		if len(eventSheets) > 0 && eventSheet.EventID != eventSheets[0].EventID {
+			eventSheetPush()
+			break
+		}
+		eventSheets = append(eventSheets, eventSheet)
+	}
+	if len(eventSheets) < 2 {
+		for _, eventSheet := range eventSheets {
+			state.PushEventSheet(eventSheet)
+		}
+		log.Println("warn: checkDoubleBooking: not enough sheets in the same event")
+		return nil
+	}
+	eventID := eventSheets[0].EventID
+	event := state.FindEventByID(eventID)
+	if event == nil {
+		for _, eventSheet := range eventSheets {
+			state.PushEventSheet(eventSheet)
+		}
+		return nil
+	}
+
+	users := make([]*AppUser, 0, len(eventSheets))
+	checkers := make([]*Checker, 0, len(eventSheets))
+	for range eventSheets {
+		user, checker, userPush := state.PopRandomUser()
+		if user == nil {
+			break
+		}
+		defer userPush()
+		users = append(users, user)
+		checkers = append(checkers, checker)
+	}
+	// Surplus sheets are not reserved
+	for _, eventSheet := range eventSheets[len(users):] {
+		state.PushEventSheet(eventSheet)
+	}
+	eventSheets = eventSheets[:len(users)]
+	if len(users) < 2 {
+		for _, eventSheet := range eventSheets {
+			state.PushEventSheet(eventSheet)
+		}
+		return nil
+	}
+
+	for i, user := range users {
+		err := loginAppUser(ctx, checkers[i], user)
+		if err != nil {
+			for _, eventSheet := range eventSheets {
+				state.PushEventSheet(eventSheet)
+			}
+			return err
+		}
+	}
+
+	reservations := make([]*Reservation, len(users))
+	errs := make([]error, len(users))
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reservations[i], errs[i] = reserveSheet(ctx, state, checkers[i], users[i], eventSheets[i])
+		}(i)
+	}
+	wg.Wait()
+
+	// NOTE: push only after reserve succeeds
+	for i, reservation := range reservations {
+		if reservation != nil {
+			state.PushEventSheet(eventSheets[i])
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	owners := map[string]uint{}
+	for _, reservation := range reservations {
+		key := fmt.Sprintf("%s-%d", reservation.SheetRank, reservation.SheetNum)
+		if userID, ok := owners[key]; ok {
+			return fatalErrorf("同じ席(event:%d %s)が複数のユーザ(%d, %d)に予約されました", eventID, key, userID, reservation.UserID)
+		}
+		owners[key] = reservation.UserID
+	}
+
+	// Every user should see their own sheet as mine, and the others' as reserved but not mine
+	for i, user := range users {
+		err := checkers[i].Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               fmt.Sprintf("/api/events/%d", eventID),
+			ExpectedStatusCode: 200,
+			Description:        "同時に予約した席がそれぞれ予約済みになっていること",
+			CheckFunc: checkJsonEventResponse(event, func(jsonEvent JsonEvent) error {
+				for _, reservation := range reservations {
+					sheets, ok := jsonEvent.Sheets[reservation.SheetRank]
+					if !ok || reservation.SheetNum < 1 || int(reservation.SheetNum) > len(sheets.Details) {
+						return fatalErrorf("イベント(id:%d)の予約した席(%s-%d)が見つかりません", eventID, reservation.SheetRank, reservation.SheetNum)
+					}
+					detail := sheets.Details[reservation.SheetNum-1]
+					if !detail.Reserved {
+						return fatalErrorf("イベント(id:%d)の予約した席(%s-%d)が予約済みになっていません", eventID, reservation.SheetRank, reservation.SheetNum)
+					}
+					if detail.Mine != (reservation.UserID == user.ID) {
+						return fatalErrorf("イベント(id:%d)の席(%s-%d)の予約者が正しくありません", eventID, reservation.SheetRank, reservation.SheetNum)
+					}
+				}
+				return nil
+			}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// イベント詳細のシートのランクごとの番号の範囲と価格が正しいこと
+func CheckSheetRankAndPrice(ctx context.Context, state *State) error {
+	event := state.GetRandomPublicEvent()
+	if event == nil {
+		log.Printf("warn: checkSheetRankAndPrice: no public event")
+		return nil
+	}
+
+	checker := NewChecker()
+
+	err := checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               fmt.Sprintf("/api/events/%d", event.ID),
+		ExpectedStatusCode: 200,
+		Description:        "公開イベントを取得できること",
+		CheckFunc: checkJsonEventResponse(event, func(jsonEvent JsonEvent) error {
+			for _, sheetKind := range DataSet.SheetKinds {
+				if _, ok := jsonEvent.Sheets[sheetKind.Rank]; !ok {
+					return fatalErrorf("イベント(id:%d)の%s席が取得できません", event.ID, sheetKind.Rank)
+				}
+			}
+			return nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Same as reserveSheet, but 409 sold_out is also an expected response.
+// Returns soldOut=true and a nil reservation if the sheet was sold out.
+func tryReserveSheet(ctx context.Context, state *State, checker *Checker, user *AppUser, eventSheet *EventSheet) (reservation *Reservation, soldOut bool, err error) {
+	eventID := eventSheet.EventID
+	rank := eventSheet.Rank
+
+	reserved := &JsonReservation{ReservationID: 0, SheetRank: rank, SheetNum: 0}
+	reservation = &Reservation{ID: 0, EventID: eventID, UserID: user.ID, SheetRank: rank, Price: eventSheet.Price, SheetNum: 0}
+	logID := state.BeginReservation(user, reservation)
+
+	checkReservation := checkJsonReservationResponse(reserved)
+	checkSoldOut := checkJsonErrorResponse("sold_out")
+	statusCode := 0
+	err = checker.Play(ctx, &CheckAction{
+		Method:      "POST",
+		Path:        fmt.Sprintf("/api/events/%d/actions/reserve", eventID),
+		Description: "席の予約ができること、または売り切れの場合エラーになること",
+		PostJSON: map[string]interface{}{
+			"sheet_rank": rank,
+		},
+		AllowServerError: true, // to tell the reservation was not made
+		CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+			statusCode = res.StatusCode
+			switch res.StatusCode {
+			case 202:
+				return checkReservation(res, body)
+			case 409:
+				soldOut = true
+				return checkSoldOut(res, body)
+			}
+			if 500 <= res.StatusCode {
+				return withErrorCode(ErrorCodeServerError, "", res.Status, errorf("サーバエラーが発生しました。%s", res.Status))
+			}
+			return fmt.Errorf("Response code should be 202 or 409, got %d", res.StatusCode)
+		},
+	})
+	// The app answered with an error, so the reservation has not been made. Without a response it may have been.
+	if statusCode != 0 && (statusCode < 200 || 300 <= statusCode) {
+		state.AbortReservation(logID, user, reservation)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if soldOut {
+		return nil, true, nil
+	}
+
+	reservation.ID = reserved.ReservationID
+	reservation.SheetNum = reserved.SheetNum
+	err = state.CommitReservation(logID, user, reservation)
+	if err != nil {
+		return nil, false, err
+	}
+
+	log.Printf("debug: reserve userID:%d(total-price:%s) eventID:%d reservedID:%d(%s-%d) price:%d\n", user.ID, user.Status.TotalPriceString(), eventID, reserved.ReservationID, reserved.SheetRank, reserved.SheetNum, eventSheet.Price)
+	return reservation, false, nil
+}
+
+// 売り切れたイベントでキャンセルが出た瞬間に複数のユーザが一斉に予約しようとする
+// キャンセルされた席を予約できるのはちょうど1人だけであること
+func LoadCancelReserveRace(ctx context.Context, state *State) error {
+	// LoadGetEvent() can run concurrently, but this can not like CheckCancelReserveSheet()
+	state.getRandomPublicSoldOutEventRWMtx.Lock()
+	defer state.getRandomPublicSoldOutEventRWMtx.Unlock()
+
+	event := state.GetRandomPublicSoldOutEvent()
+	if event == nil {
+		log.Printf("debug: loadCancelReserveRace: no public and sold-out event")
+		return nil
+	}
+	reservation := state.GetRandomNonCanceledReservationInEventID(event.ID)
+	if reservation == nil {
+		return nil
+	}
+	rank := reservation.SheetRank
+
+	cancelUser, cancelChecker, cancelUserPush := state.PopUserByID(reservation.UserID)
+	if cancelUser == nil {
+		return nil
+	}
+	defer cancelUserPush()
+
+	err := loginAppUser(ctx, cancelChecker, cancelUser)
+	if err != nil {
+		return err
+	}
+
+	var reserveUsers []*AppUser
+	var reserveCheckers []*Checker
+	for i := 0; i < parameter.CancelReserveRaceUsers; i++ {
+		user, checker, userPush := state.PopRandomUser()
+		if user == nil {
+			break
+		}
+		defer userPush()
+
+		err := loginAppUser(ctx, checker, user)
+		if err != nil {
+			return err
+		}
+		reserveUsers = append(reserveUsers, user)
+		reserveCheckers = append(reserveCheckers, checker)
+	}
+	if len(reserveUsers) == 0 {
+		return nil
+	}
+
+	// The assertion is applied only if no request is in doubt and the rank is exactly sold out
+	getCounts := func() (reserveRequested, reserveCompleted, cancelRequested, cancelCompleted uint) {
+		event.reservationMtx.RLock()
+		defer event.reservationMtx.RUnlock()
+		return event.ReserveRequestedRT.Get(rank), event.ReserveCompletedRT.Get(rank), event.CancelRequestedRT.Get(rank), event.CancelCompletedRT.Get(rank)
+	}
+	rr, rc, cr, cc := getCounts()
+	exact := rr == rc && cr == cc && rc-cc == DataSet.SheetKindMap[rank].Total
+
+	eventSheet := &EventSheet{event.ID, rank, NonReservedNum, event.Price + DataSet.SheetKindMap[rank].Price}
+
+	already_locked, err := cancelSheet(ctx, state, cancelChecker, cancelUser, eventSheet, reservation)
+	if err != nil {
+		return err
+	}
+	if already_locked {
+		return nil
+	}
+
+	reservations := make([]*Reservation, len(reserveUsers))
+	errs := make([]error, len(reserveUsers))
+	var wg sync.WaitGroup
+	for i := range reserveUsers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sheet := *eventSheet
+			reservations[i], _, errs[i] = tryReserveSheet(ctx, state, reserveCheckers[i], reserveUsers[i], &sheet)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	rrAfter, _, crAfter, _ := getCounts()
+	if !exact || rrAfter != rr+uint(len(reserveUsers)) || crAfter != cr+1 {
+		log.Printf("debug: loadCancelReserveRace: skip assertion because other requests touched event:%d rank:%s\n", event.ID, rank)
+		return nil
+	}
+
+	succeeded := 0
+	for _, r := range reservations {
+		if r != nil {
+			succeeded++
+		}
+	}
+	// Record the error as the reserve API's one since it is not detected in a single response
+	action := &CheckAction{Method: "POST", Path: fmt.Sprintf("/api/events/%d/actions/reserve", event.ID)}
+	if succeeded == 0 {
+		return reserveCheckers[0].OnError(action, nil, fatalErrorf("キャンセルされた席(event:%d %s-%d)を予約できません", event.ID, rank, reservation.SheetNum))
+	}
+	if succeeded > 1 {
+		return reserveCheckers[0].OnError(action, nil, fatalErrorf("売り切れのイベント(id:%d)の%s席で、キャンセルされた1席に対して%d件の予約が成功しました", event.ID, rank, succeeded))
+	}
+
+	return nil
+}
+
+// ランクの席を全て予約したイベントでは、それ以上予約できず、残席が0になっていること
+func CheckSoldOutRank(ctx context.Context, state *State) error {
+	// The rank which has the fewest sheets
+	sheetKind := DataSet.SheetKinds[0]
+	for _, sk := range DataSet.SheetKinds {
+		if sk.Total < sheetKind.Total {
+			sheetKind = sk
+		}
+	}
+	rank := sheetKind.Rank
+
+	admin, adminChecker, adminPush := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer adminPush()
+
+	err := loginAdministrator(ctx, adminChecker, admin)
+	if err != nil {
+		return err
+	}
+
+	event, _ := state.CreateNewEvent()
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/admin/api/events",
+		ExpectedStatusCode: 200,
+		Description:        "管理者がイベントを作成できること",
+		PostJSON:           eventPostJSON(event),
+		CheckFunc:          checkJsonFullEventCreateResponse(event),
+	})
+	if err != nil {
+		return err
+	}
+	state.PushNewEventWithoutRank(event, time.Now(), "CheckSoldOutRank", rank)
+
+	user, checker, userPush := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer userPush()
+
+	err = loginAppUser(ctx, checker, user)
+	if err != nil {
+		return err
+	}
+
+	for i := uint(0); i < sheetKind.Total; i++ {
+		eventSheet := &EventSheet{event.ID, rank, NonReservedNum, event.Price + sheetKind.Price}
+		reservation, err := reserveSheet(ctx, state, checker, user, eventSheet)
+		if err != nil {
+			return err
+		}
+		if reservation != nil {
+			state.PushEventSheet(eventSheet)
+		}
+	}
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               fmt.Sprintf("/api/events/%d/actions/reserve", event.ID),
+		ExpectedStatusCode: 409,
+		Description:        "売り切れの場合エラーになること",
+		PostJSON: map[string]interface{}{
+			"sheet_rank": rank,
+		},
+		CheckFunc: checkJsonErrorResponse("sold_out"),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               fmt.Sprintf("/api/events/%d", event.ID),
+		ExpectedStatusCode: 200,
+		Description:        "売り切れたイベントを取得できること",
+		CheckFunc: checkJsonEventResponse(event, func(jsonEvent JsonEvent) error {
+			sheets := jsonEvent.Sheets[rank]
+			if sheets.Remains != 0 {
+				return fatalErrorf("売り切れたイベント(id:%d)の%s席の残席数が正しくありません", event.ID, rank)
+			}
+			for _, detail := range sheets.Details {
+				if !detail.Reserved || !detail.Mine {
+					return fatalErrorf("売り切れたイベント(id:%d)の%s席の予約状況が正しくありません", event.ID, rank)
+				}
+			}
+			return nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               "/",
+		ExpectedStatusCode: 200,
+		Description:        "トップページに売り切れが反映されていること",
+		CheckFunc: checkHTML(func(res *http.Response, doc *goquery.Document) error {
+			selection := doc.Find("#app-wrapper")
+			if selection == nil || len(selection.Nodes) == 0 {
+				return fatalErrorf("app-wrapperが見つかりません")
+			}
+
+			for _, attr := range selection.Nodes[0].Attr {
+				if attr.Key != "data-events" {
+					continue
+				}
+				var events []JsonEvent
+				err := json.Unmarshal([]byte(attr.Val), &events)
+				if err != nil {
+					return fatalErrorf("トップページのイベント一覧のJsonデコードに失敗 %s %v", attr.Val, err)
+				}
+				for _, e := range events {
+					if e.ID != event.ID {
+						continue
+					}
+					if e.Sheets[rank].Remains != 0 {
+						return fatalErrorf("トップページのイベント(id:%d)の%s席の残席数が正しくありません", event.ID, rank)
+					}
+					return nil
+				}
+				return fatalErrorf("トップページにイベント(id:%d)が見つかりません", event.ID)
+			}
+			return fatalErrorf("トップページのイベント一覧が見つかりません")
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 売り切れたイベントで1席をキャンセルすると、残席数が戻り、別のユーザがその席を予約できること
+// キャンセル後のキャッシュの無効化が遅れることがあるので、CancelFreesSheetRetries回まで再確認する
+func CheckCancelFreesSheet(ctx context.Context, state *State) error {
+	// The rank which has the fewest sheets
+	sheetKind := DataSet.SheetKinds[0]
+	for _, sk := range DataSet.SheetKinds {
+		if sk.Total < sheetKind.Total {
+			sheetKind = sk
+		}
+	}
+	rank := sheetKind.Rank
+
+	admin, adminChecker, adminPush := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer adminPush()
+
+	user, checker, userPush := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer userPush()
+
+	otherUser, otherChecker, otherUserPush := state.PopRandomUser()
+	if otherUser == nil {
+		return nil
+	}
+	defer otherUserPush()
+
+	err := loginAdministrator(ctx, adminChecker, admin)
+	if err != nil {
+		return err
+	}
+
+	event, _ := state.CreateNewEvent()
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/admin/api/events",
+		ExpectedStatusCode: 200,
+		Description:        "管理者がイベントを作成できること",
+		PostJSON:           eventPostJSON(event),
+		CheckFunc:          checkJsonFullEventCreateResponse(event),
+	})
+	if err != nil {
+		return err
+	}
+	// nobody else reserves the rank, so that the remains are known
+	state.PushNewEventWithoutRank(event, time.Now(), "CheckCancelFreesSheet", rank)
+
+	err = loginAppUser(ctx, checker, user)
+	if err != nil {
+		return err
+	}
+	err = loginAppUser(ctx, otherChecker, otherUser)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: push after the validation, otherwise the sheets may be canceled by other scenarios
+	var reservedSheets []*EventSheet
+	defer func() {
+		for _, eventSheet := range reservedSheets {
+			state.PushEventSheet(eventSheet)
+		}
+	}()
+
+	var reservations []*Reservation
+	var eventSheets []*EventSheet
+	for i := uint(0); i < sheetKind.Total; i++ {
+		eventSheet := &EventSheet{event.ID, rank, NonReservedNum, event.Price + sheetKind.Price}
+		reservation, err := reserveSheet(ctx, state, checker, user, eventSheet)
+		if err != nil {
+			return err
+		}
+		reservations = append(reservations, reservation)
+		eventSheets = append(eventSheets, eventSheet)
+	}
+
+	i := rand.Intn(len(reservations))
+	canceled := reservations[i]
+	for j, eventSheet := range eventSheets {
+		if j != i {
+			reservedSheets = append(reservedSheets, eventSheet)
+		}
+	}
+	_, err = cancelSheet(ctx, state, checker, user, eventSheets[i], canceled)
+	if err != nil {
+		return err
+	}
+	num := canceled.SheetNum
+
+	wait := func() error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(parameter.CancelFreesSheetRetryInterval):
+			return nil
+		}
+	}
+
+	// The canceled sheet is seen as not reserved by the other user
+	eventPath := fmt.Sprintf("/api/events/%d", event.ID)
+	var remains uint
+	freed := false
+	for retry := 0; !freed; retry++ {
+		if retry > parameter.CancelFreesSheetRetries {
+			err := fatalErrorf("イベント(id:%d)でキャンセルした席(%s-%d)が空席に戻りません", event.ID, rank, num)
+			return otherChecker.OnError(&CheckAction{Method: "GET", Path: eventPath}, nil, withErrorCode(ErrorCodeConsistencyViolation, "1", fmt.Sprint(remains), err))
+		}
+		if retry > 0 {
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+		err = otherChecker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               eventPath,
+			ExpectedStatusCode: 200,
+			Description:        "キャンセルした席が空席になっていること",
+			CheckFunc: checkJsonEventResponse(event, func(jsonEvent JsonEvent) error {
+				sheets := jsonEvent.Sheets[rank]
+				remains = sheets.Remains
+				freed = remains == 1 && !sheets.Details[num-1].Reserved
+				return nil
+			}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The other user gets the canceled sheet since it is the only one left
+	eventSheet := &EventSheet{event.ID, rank, NonReservedNum, event.Price + sheetKind.Price}
+	var reservation *Reservation
+	reservePath := fmt.Sprintf("/api/events/%d/actions/reserve", event.ID)
+	for retry := 0; reservation == nil; retry++ {
+		if retry > parameter.CancelFreesSheetRetries {
+			err := fatalErrorf("イベント(id:%d)でキャンセルされた席(%s-%d)を別のユーザが予約できません", event.ID, rank, num)
+			return otherChecker.OnError(&CheckAction{Method: "POST", Path: reservePath}, nil, withErrorCode(ErrorCodeConsistencyViolation, "202", "409", err))
+		}
+		if retry > 0 {
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+		reservation, _, err = tryReserveSheet(ctx, state, otherChecker, otherUser, eventSheet)
+		if err != nil {
+			return err
+		}
+	}
+	eventSheet.Num = reservation.SheetNum
+	reservedSheets = append(reservedSheets, eventSheet)
+	if reservation.SheetNum != num {
+		err := fatalErrorf("イベント(id:%d)でキャンセルされた席(%s-%d)ではない席(%s-%d)が予約されました", event.ID, rank, num, rank, reservation.SheetNum)
+		return otherChecker.OnError(&CheckAction{Method: "POST", Path: reservePath}, nil, withErrorCode(ErrorCodeConsistencyViolation, fmt.Sprint(num), fmt.Sprint(reservation.SheetNum), err))
+	}
+
+	err = otherChecker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               eventPath,
+		ExpectedStatusCode: 200,
+		Description:        "キャンセルされた席を予約したユーザの予約済みになっていること",
+		CheckFunc: checkJsonEventResponse(event, func(jsonEvent JsonEvent) error {
+			sheets := jsonEvent.Sheets[rank]
+			if sheets.Remains != 0 {
+				return fatalErrorf("売り切れたイベント(id:%d)の%s席の残席数が正しくありません", event.ID, rank)
+			}
+			if detail := sheets.Details[num-1]; !detail.Reserved || !detail.Mine {
+				return fatalErrorf("イベント(id:%d)の席(%s-%d)の予約者が正しくありません", event.ID, rank, num)
+			}
+			return nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type errorContract struct {
+	checker     *Checker
+	method      string
+	path        string
+	postJSON    map[string]interface{}
+	statusCode  int
+	errorCode   string
+	description string
+}
+
+// エラーレスポンスのステータスコードとerrorフィールドが参照実装と一致すること
+func CheckErrorResponses(ctx context.Context, state *State) error {
+	user, userChecker, userPush := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer userPush()
+
+	otherUser, _, otherUserPush := state.PopRandomUser()
+	if otherUser == nil {
+		return nil
+	}
+	defer otherUserPush()
+
+	admin, adminChecker, adminPush := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer adminPush()
+
+	err := loginAppUser(ctx, userChecker, user)
+	if err != nil {
+		return err
+	}
+	err = loginAdministrator(ctx, adminChecker, admin)
+	if err != nil {
+		return err
+	}
+
+	anonymous := NewChecker()
+	rank := GetRandomSheetRank()
+
+	contracts := []errorContract{
+		{anonymous, "GET", fmt.Sprintf("/api/users/%d", user.ID), nil, 401, "login_required", "ログインしていない場合ユーザ情報を取得できないこと"},
+		{anonymous, "POST", "/api/actions/logout", nil, 401, "login_required", "ログインしていない場合ログアウトできないこと"},
+		{anonymous, "GET", "/admin/api/events", nil, 401, "admin_login_required", "管理者としてログインしていない場合イベント一覧を取得できないこと"},
+		{anonymous, "GET", "/admin/api/reports/sales", nil, 401, "admin_login_required", "管理者としてログインしていない場合レポートを取得できないこと"},
+		{anonymous, "POST", "/admin/api/actions/login", map[string]interface{}{"login_name": admin.LoginName, "password": admin.Password + "x"}, 401, "authentication_failed", "管理者のパスワードが間違っている場合ログインできないこと"},
+		{anonymous, "POST", "/api/actions/login", map[string]interface{}{"login_name": user.LoginName, "password": user.Password + "x"}, 401, "authentication_failed", "パスワードが間違っている場合ログインできないこと"},
+		{anonymous, "GET", "/api/events/0", nil, 404, "not_found", "存在しないイベントを取得しようとするとエラーになること"},
+		{userChecker, "GET", fmt.Sprintf("/api/users/%d", otherUser.ID), nil, 403, "forbidden", "他のユーザの情報を取得できないこと"},
+		{userChecker, "GET", "/admin/api/events", nil, 401, "admin_login_required", "一般ユーザは管理者用のイベント一覧を取得できないこと"},
+		{userChecker, "POST", "/admin/api/events", eventPostJSON(&Event{Title: RandomAlphabetString(32), PublicFg: true, Price: 1000}), 401, "admin_login_required", "一般ユーザはイベントを作成できないこと"},
+		{userChecker, "GET", "/admin/api/reports/sales", nil, 401, "admin_login_required", "一般ユーザはレポートを取得できないこと"},
+		{userChecker, "POST", "/api/users", map[string]interface{}{"nickname": user.Nickname, "login_name": user.LoginName, "password": user.Password}, 409, "duplicated", "すでに存在するログイン名ではユーザを作成できないこと"},
+		{userChecker, "POST", "/api/events/0/actions/reserve", map[string]interface{}{"sheet_rank": rank}, 404, "invalid_event", "存在しないイベントのシートを予約しようとするとエラーになること"},
+		{adminChecker, "GET", "/admin/api/events/0", nil, 404, "not_found", "存在しないイベントを管理者が取得しようとするとエラーになること"},
+		{adminChecker, "POST", "/admin/api/events/0/actions/edit", map[string]interface{}{"public": false, "closed": true}, 404, "not_found", "存在しないイベントを編集しようとするとエラーになること"},
+	}
+
+	if event := state.GetRandomPublicEvent(); event != nil {
+		contracts = append(contracts,
+			errorContract{userChecker, "POST", fmt.Sprintf("/api/events/%d/actions/reserve", event.ID), map[string]interface{}{"sheet_rank": "N"}, 400, "invalid_rank", "存在しないランクのシートを予約しようとするとエラーになること"},
+			errorContract{userChecker, "DELETE", fmt.Sprintf("/api/events/%d/sheets/%s/%d/reservation", event.ID, "D", 1), nil, 404, "invalid_rank", "存在しないランクのシートをキャンセルしようとするとエラーになること"},
+		)
+	}
+	for _, event := range state.GetEvents() {
+		// Closed events are never modified, so the edit request has no side effect even if it wrongly succeeds
+		if event.ClosedFg {
+			contracts = append(contracts,
+				errorContract{adminChecker, "POST", fmt.Sprintf("/admin/api/events/%d/actions/edit", event.ID), map[string]interface{}{"public": false, "closed": true}, 400, "cannot_edit_closed_event", "締め切られたイベントを編集しようとするとエラーになること"},
+			)
+			break
+		}
+	}
+
+	for _, c := range contracts {
+		err := c.checker.Play(ctx, &CheckAction{
+			Method:             c.method,
+			Path:               c.path,
+			PostJSON:           c.postJSON,
+			ExpectedStatusCode: c.statusCode,
+			Description:        c.description,
+			CheckFunc:          checkJsonErrorResponse(c.errorCode),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ログアウト後や改ざんされたセッションCookieでは認証が必要なAPIにアクセスできないこと
+// NOTE: Revoking stateless cookie sessions is out of scope. The reference implementation keeps the
+// session in a signed cookie (Sinatra's Rack::Session::Cookie), so a cookie issued before logout is
+// still valid when it is replayed and it is not checked. Only the cookie which logout sets, tampered
+// cookies and garbage cookies are checked.
+func CheckSessionExpiry(ctx context.Context, state *State) error {
+	user, _, userPush := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer userPush()
+
+	// Use another session not to change user.Status.Online of the user's checker
+	checker := NewChecker()
+	userPath := fmt.Sprintf("/api/users/%d", user.ID)
+
+	err := checker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/actions/login",
+		ExpectedStatusCode: 200,
+		Description:        "一般ユーザでログインできること",
+		PostJSON: map[string]interface{}{
+			"login_name": user.LoginName,
+			"password":   user.Password,
+		},
+		CheckFunc: checkJsonUserResponse(user),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               userPath,
+		ExpectedStatusCode: 200,
+		Description:        "ユーザー情報が取得できること",
+	})
+	if err != nil {
+		return err
+	}
+
+	if cookie := checker.getCookie(SessionCookieName); cookie != nil && len(cookie.Value) > 0 {
+		// Flip the last character of the signed session
+		b := []byte(cookie.Value)
+		if b[len(b)-1] == 'A' {
+			b[len(b)-1] = 'B'
+		} else {
+			b[len(b)-1] = 'A'
+		}
+
+		tamperedChecker := NewChecker()
+		tamperedChecker.setCookie(&http.Cookie{Name: SessionCookieName, Value: string(b)})
+		err = tamperedChecker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               userPath,
+			ExpectedStatusCode: 401,
+			Description:        "改ざんされたセッションでユーザ情報を取得できないこと",
+			CheckFunc:          checkJsonErrorResponse("login_required"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	garbageChecker := NewChecker()
+	garbageChecker.setCookie(&http.Cookie{Name: SessionCookieName, Value: RandomAlphabetString(64)})
+	err = garbageChecker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               userPath,
+		ExpectedStatusCode: 401,
+		Description:        "不正なセッションでユーザ情報を取得できないこと",
+		CheckFunc:          checkJsonErrorResponse("login_required"),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/actions/logout",
+		ExpectedStatusCode: 204,
+		Description:        "一般ユーザでログアウトできること",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               userPath,
+		ExpectedStatusCode: 401,
+		Description:        "ログアウト時に更新されたセッションではユーザ情報を取得できないこと",
+		CheckFunc:          checkJsonErrorResponse("login_required"),
+	})
+	if err != nil {
+		return err
+	}
+
+	admin, _, adminPush := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer adminPush()
+
+	adminChecker := NewChecker()
+
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/admin/api/actions/login",
+		ExpectedStatusCode: 200,
+		Description:        "管理者でログインできること",
+		PostJSON: map[string]interface{}{
+			"login_name": admin.LoginName,
+			"password":   admin.Password,
+		},
+		CheckFunc: checkJsonAdministratorResponse(admin),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/admin/api/actions/logout",
+		ExpectedStatusCode: 204,
+		Description:        "管理者でログアウトできること",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = adminChecker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               "/admin/api/events",
+		ExpectedStatusCode: 401,
+		Description:        "ログアウト時に更新されたセッションでは管理者用のイベント一覧を取得できないこと",
+		CheckFunc:          checkJsonErrorResponse("admin_login_required"),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// 管理者としてログインしていないセッションでは管理画面のデータや管理者用APIにアクセスできないこと
+// 認可の省略はスコアを無効にするため、違反はすべてfatalとする
+func CheckAdminAccessControl(ctx context.Context, state *State) error {
+	user, _, userPush := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	defer userPush()
+
+	event := state.GetRandomPublicEvent()
+	if event == nil {
+		return nil
+	}
+
+	// Use another session not to change user.Status.Online of the user's checker
+	userChecker := NewChecker()
+	err := userChecker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/actions/login",
+		ExpectedStatusCode: 200,
+		Description:        "一般ユーザでログインできること",
+		PostJSON: map[string]interface{}{
+			"login_name": user.LoginName,
+			"password":   user.Password,
+		},
+		CheckFunc: checkJsonUserResponse(user),
+	})
+	if err != nil {
+		return err
+	}
+
+	sessions := []struct {
+		name    string
+		checker *Checker
+	}{
+		{"ログインしていないユーザ", NewChecker()},
+		{"一般ユーザ", userChecker},
+	}
+
+	for _, s := range sessions {
+		name := s.name
+
+		err := s.checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               "/admin/",
+			ExpectedStatusCode: 200,
+			Description:        name + "には管理画面のデータが表示されないこと",
+			CheckFunc: checkHTML(func(res *http.Response, doc *goquery.Document) error {
+				wrapper := doc.Find("#app-wrapper")
+				if administrator, ok := wrapper.Attr("data-administrator"); ok && administrator != "null" {
+					return fatalErrorf("%sの管理画面に管理者情報が表示されています", Msg(name))
+				}
+				if v, ok := wrapper.Attr("data-events"); ok {
+					var events []JsonFullEvent
+					if err := json.Unmarshal([]byte(v), &events); err != nil {
+						return fatalErrorf("管理画面のイベント一覧のJsonデコードに失敗 %s %v", v, err)
+					}
+					if len(events) != 0 {
+						return fatalErrorf("%sの管理画面にイベント一覧が表示されています", Msg(name))
+					}
+				}
+				return nil
+			}),
+		})
+		if err != nil {
+			return err
+		}
+
+		requests := []struct {
+			method   string
+			path     string
+			postJSON map[string]interface{}
+		}{
+			{"GET", "/admin/api/events", nil},
+			{"GET", fmt.Sprintf("/admin/api/events/%d", event.ID), nil},
+			// Creates an event the benchmarker does not know only if the access control is broken, which is fatal anyway
+			{"POST", "/admin/api/events", eventPostJSON(&Event{Title: RandomAlphabetString(32), PublicFg: false, Price: 1000})},
+			// No-op for a public event even if it wrongly succeeds
+			{"POST", fmt.Sprintf("/admin/api/events/%d/actions/edit", event.ID), map[string]interface{}{"public": true, "closed": false}},
+			{"GET", fmt.Sprintf("/admin/api/reports/events/%d/sales", event.ID), nil},
+			{"GET", "/admin/api/reports/sales", nil},
+			{"POST", "/admin/api/actions/logout", nil},
+		}
+
+		for _, r := range requests {
+			method, path := r.method, r.path
+			err := s.checker.Play(ctx, &CheckAction{
+				Method:      method,
+				Path:        path,
+				PostJSON:    r.postJSON,
+				Description: name + "は管理者用APIにアクセスできないこと",
+				CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+					if res.StatusCode != 401 {
+						return fatalErrorf("%sが管理者用API %s %s にアクセスできます (status %d)", Msg(name), method, path, res.StatusCode)
+					}
+					return checkJsonErrorResponse("admin_login_required")(res, body)
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ユーザ詳細の最近の予約・最近のイベント・合計金額が、ベンチマーカーがそのユーザで行った操作と一致すること
+// 履歴のない新規ユーザを使うので、期待値を正確に決められる
+func CheckUserDetail(ctx context.Context, state *State) error {
+	user, checker, newUserPush := state.PopNewUser()
+	if user == nil {
+		return nil
+	}
+	checker.ResetCookie()
+
+	err := checker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/users",
+		ExpectedStatusCode: 201,
+		PostJSON: map[string]interface{}{
+			"nickname":   user.Nickname,
+			"login_name": user.LoginName,
+			"password":   user.Password,
+		},
+		Description: "新規ユーザが作成できること",
+		CheckFunc:   checkJsonUserCreateResponse(user),
+	})
+	if err != nil {
+		return err
+	}
+	defer newUserPush()
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/actions/login",
+		ExpectedStatusCode: 200,
+		PostJSON: map[string]interface{}{
+			"login_name": user.LoginName,
+			"password":   user.Password,
+		},
+		Description: "作成したユーザでログインできること",
+	})
+	if err != nil {
+		return err
+	}
+	user.Status.Online = true
+
+	var reservations []*Reservation
+	var eventSheets []*EventSheet
+	for i := 0; i < parameter.UserDetailReservations; i++ {
+		eventSheet, eventSheetPush, err := popOrCreateEventSheet(ctx, state)
+		if err != nil {
+			return err
+		}
+		if eventSheet == nil {
+			return nil
+		}
+
+		reservation, err := reserveSheet(ctx, state, checker, user, eventSheet)
+		if err != nil {
+			return err
+		}
+		defer eventSheetPush() // NOTE: push only after reserve succeeds
+
+		reservations = append(reservations, reservation)
+		eventSheets = append(eventSheets, eventSheet)
+	}
+	if len(reservations) == 0 {
+		return nil
+	}
+
+	canceled := map[uint]bool{}
+	cancel := func(i int) error {
+		_, err := cancelSheet(ctx, state, checker, user, eventSheets[i], reservations[i])
+		if err != nil {
+			return err
+		}
+		canceled[reservations[i].ID] = true
+		return nil
+	}
+
+	checkUserDetail := func(check func(*JsonFullUser) error) error {
+		return checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               fmt.Sprintf("/api/users/%d", user.ID),
+			ExpectedStatusCode: 200,
+			Description:        "ユーザ詳細が表示されること",
+			CheckFunc: checkJsonFullUserResponse(user, func(fullUser *JsonFullUser) error {
+				var totalPrice uint
+				eventIDs := map[uint]bool{}
+				for _, r := range reservations {
+					if !canceled[r.ID] {
+						totalPrice += r.Price
+					}
+					eventIDs[r.EventID] = true
+				}
+				if fullUser.TotalPrice != totalPrice {
+					log.Printf("warn: CheckUserDetail: total price expected=%d got=%d userID=%d\n", totalPrice, fullUser.TotalPrice, user.ID)
+					return fatalErrorf("予約総額が正しくありません userID=%d", user.ID)
+				}
+
+				if len(fullUser.RecentReservations) != len(reservations) {
+					return fatalErrorf("最近予約した席の数が正しくありません userID=%d", user.ID)
+				}
+				for _, got := range fullUser.RecentReservations {
+					var expected *Reservation
+					for _, r := range reservations {
+						if r.ID == got.ReservationID {
+							expected = r
+							break
+						}
+					}
+					if expected == nil {
+						return fatalErrorf("予約していない席が最近予約した席に含まれています userID=%d reservationID=%d", user.ID, got.ReservationID)
+					}
+					if got.Event.ID != expected.EventID || got.SheetRank != expected.SheetRank || got.SheetNum != expected.SheetNum || got.Price != expected.Price {
+						return fatalErrorf("最近予約した席の内容が正しくありません userID=%d reservationID=%d", user.ID, got.ReservationID)
+					}
+					if (got.CanceledAt != 0) != canceled[expected.ID] {
+						return fatalErrorf("最近予約した席のキャンセル状態が正しくありません userID=%d reservationID=%d", user.ID, got.ReservationID)
+					}
+				}
+
+				if len(fullUser.RecentEvents) != len(eventIDs) {
+					return fatalErrorf("最近予約したイベントの数が正しくありません userID=%d", user.ID)
+				}
+				for _, e := range fullUser.RecentEvents {
+					if !eventIDs[e.ID] {
+						return fatalErrorf("予約していないイベントが最近予約したイベントに含まれています userID=%d eventID=%d", user.ID, e.ID)
+					}
+				}
+
+				if check != nil {
+					return check(fullUser)
+				}
+				return nil
+			}),
+		})
+	}
+
+	if len(reservations) >= 2 {
+		err = cancel(1)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = checkUserDetail(nil)
+	if err != nil {
+		return err
+	}
+
+	// The most recent action comes first. Wait since reserved_at and canceled_at have a resolution of one second.
+	time.Sleep(1100 * time.Millisecond)
+	err = cancel(0)
+	if err != nil {
+		return err
+	}
+
+	return checkUserDetail(func(fullUser *JsonFullUser) error {
+		if fullUser.RecentReservations[0].ReservationID != reservations[0].ID {
+			return fatalErrorf("最近予約した席の順番が正しくありません userID=%d", user.ID)
+		}
+		if fullUser.RecentEvents[0].ID != reservations[0].EventID {
+			return fatalErrorf("最近予約したイベントの順番が正しくありません userID=%d", user.ID)
+		}
+		return nil
+	})
+}
+
+// 同じログイン名で登録するとduplicatedエラーになること。同時に登録した場合も成功するのは1つだけであること
+func CheckDuplicateRegistration(ctx context.Context, state *State) error {
+	user, checker, newUserPush := state.PopNewUser()
+	if user == nil {
+		return nil
+	}
+	checker.ResetCookie()
+
+	postJSON := map[string]interface{}{
+		"nickname":   user.Nickname,
+		"login_name": user.LoginName,
+		"password":   user.Password,
+	}
+
+	var (
+		mtx       sync.Mutex
+		wg        sync.WaitGroup
+		createdID []uint
+		errs      []error
+	)
+	start := make(chan struct{})
+	for i := 0; i < parameter.DuplicateSignupConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			err := NewChecker().Play(ctx, &CheckAction{
+				Method:           "POST",
+				Path:             "/api/users",
+				PostJSON:         postJSON,
+				AllowServerError: true,
+				Description:      "同じログイン名で同時に登録した場合、1つだけ成功すること",
+				CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+					switch {
+					case res.StatusCode == 201:
+						var jsonUser JsonUser
+						err := json.NewDecoder(body).Decode(&jsonUser)
+						if err != nil {
+							return fatalErrorf("Jsonのデコードに失敗 %v", err)
+						}
+						mtx.Lock()
+						createdID = append(createdID, jsonUser.ID)
+						mtx.Unlock()
+						return nil
+					case res.StatusCode == 409:
+						return checkJsonErrorResponse("duplicated")(res, body)
+					case 500 <= res.StatusCode:
+						// The reference implementation fails with the unique constraint of login_name
+						// if the other signup is inserted between its duplication check and insert
+						return nil
+					default:
+						return errorf("期待していないステータスコード %d", res.StatusCode)
+					}
+				},
+			})
+			if err != nil {
+				mtx.Lock()
+				errs = append(errs, err)
+				mtx.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if len(createdID) > 1 {
+		log.Printf("warn: CheckDuplicateRegistration: login_name:%s is registered %d times ids:%v\n", user.LoginName, len(createdID), createdID)
+		return fatalErrorf("同じログイン名のユーザが複数登録されました")
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	if len(createdID) == 0 {
+		return errorf("同じログイン名で同時に登録した場合にいずれも成功しませんでした")
+	}
+	user.ID = createdID[0]
+	defer newUserPush()
+
+	err := checker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/users",
+		ExpectedStatusCode: 409,
+		PostJSON:           postJSON,
+		Description:        "すでに存在するログイン名ではユーザを作成できないこと",
+		CheckFunc:          checkJsonErrorResponse("duplicated"),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = checker.Play(ctx, &CheckAction{
+		Method:             "POST",
+		Path:               "/api/actions/login",
+		ExpectedStatusCode: 200,
+		PostJSON: map[string]interface{}{
+			"login_name": user.LoginName,
+			"password":   user.Password,
+		},
+		Description: "作成したユーザでログインできること",
+		CheckFunc:   checkJsonUserResponse(user),
+	})
+	if err != nil {
+		return err
+	}
+	user.Status.Online = true
+
+	return nil
+}
+
+type rankCounts struct {
+	ReserveRequested uint
+	ReserveCompleted uint
+	CancelRequested  uint
+	CancelCompleted  uint
+}
+
+func getRankCounts(event *Event) map[string]rankCounts {
+	event.reservationMtx.RLock()
+	defer event.reservationMtx.RUnlock()
+
+	counts := map[string]rankCounts{}
+	for _, sheetKind := range DataSet.SheetKinds {
+		rank := sheetKind.Rank
+		counts[rank] = rankCounts{
+			ReserveRequested: event.ReserveRequestedRT.Get(rank),
+			ReserveCompleted: event.ReserveCompletedRT.Get(rank),
+			CancelRequested:  event.CancelRequestedRT.Get(rank),
+			CancelCompleted:  event.CancelCompletedRT.Get(rank),
+		}
+	}
+	return counts
+}
+
+// 負荷走行中のイベント詳細で、各ランクの残座席数がベンチマーカーの把握している予約数と処理中のリクエスト数から
+// 決まる範囲に収まっていること。キャッシュの更新漏れなどでスナップショットだけでは気付けない不整合を検出する
+func CheckRemainsInvariant(ctx context.Context, state *State) error {
+	checker := NewChecker()
+
+	seen := map[uint]bool{}
+	for i := 0; i < parameter.RemainsInvariantEvents; i++ {
+		event := state.GetRandomPublicEvent()
+		if event == nil {
+			return nil
+		}
+		if seen[event.ID] {
+			continue
+		}
+		seen[event.ID] = true
+
+		countsBeforeRequest := getRankCounts(event)
+
+		err := checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               fmt.Sprintf("/api/events/%d", event.ID),
+			ExpectedStatusCode: 200,
+			Description:        "公開イベントを取得できること",
+			CheckFunc: checkJsonEventResponse(event, func(e JsonEvent) error {
+				countsAfterResponse := getRankCounts(event)
+
+				var total, remains uint
+				for _, sheetKind := range DataSet.SheetKinds {
+					rank := sheetKind.Rank
+					sheets := e.Sheets[rank]
+					total += sheets.Total
+					remains += sheets.Remains
+
+					if sheets.Remains > sheets.Total {
+						return fatalErrorf("イベント(id:%d)の%s席の残座席数が総座席数を超えています", e.ID, rank)
+					}
+
+					before, after := countsBeforeRequest[rank], countsAfterResponse[rank]
+					lower := int(sheetKind.Total) + int(before.CancelCompleted) - int(after.ReserveRequested)
+					upper := int(sheetKind.Total) + int(after.CancelRequested) - int(before.ReserveCompleted)
+					if int(sheets.Remains) < lower || upper < int(sheets.Remains) {
+						log.Printf("warn: CheckRemainsInvariant: eventID=%d rank=%s remains=%d is not included in (%d-%d) before:%+v after:%+v\n", e.ID, rank, sheets.Remains, lower, upper, before, after)
+						return fatalErrorf("イベント(id:%d)の%s席の残座席数が正しくありません", e.ID, rank)
+					}
+				}
+
+				if e.Total != total {
+					return fatalErrorf("イベント(id:%d)の総座席数が各席の合計と一致しません", e.ID)
+				}
+				if e.Remains != remains {
+					return fatalErrorf("イベント(id:%d)の総残座席数が各席の合計と一致しません", e.ID)
+				}
+				return nil
+			}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package bench
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Outcome and duration of every run of a scenario, so that the result tells which scenario logic
+// fails rather than only which requests do. The durations are kept in the buckets of EndpointStat.
+type ScenarioStat struct {
+	Name      string  `json:"name"`
+	Runs      int64   `json:"runs"`
+	Succeeded int64   `json:"succeeded"`
+	Failed    int64   `json:"failed"`
+	Aborted   int64   `json:"aborted"` // cut off by the end of the phase, not counted in the durations
+	Skipped   int64   `json:"skipped"` // not run since a check it depends on failed, not counted in the runs
+	MeanMs    float64 `json:"mean_ms"`
+	P50Ms     float64 `json:"p50_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+}
+
+type scenarioStat struct {
+	EndpointStat
+	aborted int64
+	skipped int64
+	total   time.Duration
+}
+
+var (
+	scenarioStatsMtx sync.Mutex
+	scenarioStats    = map[string]*scenarioStat{}
+)
+
+// Records a run of the scenario which took d and returned err. ctx is the one the scenario ran with.
+func RecordScenarioRun(ctx context.Context, name string, d time.Duration, err error) {
+	scenarioStatsMtx.Lock()
+	defer scenarioStatsMtx.Unlock()
+
+	stat := getScenarioStatLocked(name)
+	if err != nil && ctx.Err() != nil {
+		stat.aborted++
+		return
+	}
+	stat.add(d, err == nil)
+	stat.total += d
+}
+
+// Records that the check was skipped since a check it depends on failed
+func RecordScenarioSkip(name string) {
+	scenarioStatsMtx.Lock()
+	defer scenarioStatsMtx.Unlock()
+
+	getScenarioStatLocked(name).skipped++
+}
+
+func getScenarioStatLocked(name string) *scenarioStat {
+	stat, found := scenarioStats[name]
+	if !found {
+		stat = &scenarioStat{EndpointStat: EndpointStat{Endpoint: name}}
+		scenarioStats[name] = stat
+	}
+	return stat
+}
+
+func ResetScenarioStats() {
+	scenarioStatsMtx.Lock()
+	defer scenarioStatsMtx.Unlock()
+
+	scenarioStats = map[string]*scenarioStat{}
+}
+
+// Returns the stats of the scenarios which have run, sorted by name
+func GetScenarioStats() []ScenarioStat {
+	scenarioStatsMtx.Lock()
+	defer scenarioStatsMtx.Unlock()
+
+	stats := make([]ScenarioStat, 0, len(scenarioStats))
+	for name, stat := range scenarioStats {
+		ms := func(d time.Duration) float64 {
+			return float64(d) / float64(time.Millisecond)
+		}
+		s := ScenarioStat{
+			Name:      name,
+			Runs:      stat.Requests + stat.aborted,
+			Succeeded: stat.Requests - stat.Errors,
+			Failed:    stat.Errors,
+			Aborted:   stat.aborted,
+			Skipped:   stat.skipped,
+			P50Ms:     ms(stat.Percentile(50)),
+			P95Ms:     ms(stat.Percentile(95)),
+			P99Ms:     ms(stat.Percentile(99)),
+		}
+		if stat.Requests > 0 {
+			s.MeanMs = ms(stat.total) / float64(stat.Requests)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
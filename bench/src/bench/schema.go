@@ -0,0 +1,263 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Response schemas of the API, checked by Checker.Play for every JSON response
+// so that contract drift (unknown, missing or mistyped fields) is caught even by
+// checkers which only look at a few fields.
+
+type jsonSchema struct {
+	Type     string                 // "object", "array", "map", "string", "number", "boolean"
+	Nullable bool                   // null is also allowed
+	Fields   map[string]*jsonSchema // "object": field name (with "?" suffix if optional) -> schema
+	Items    *jsonSchema            // "array", "map": schema of the elements
+}
+
+func schemaObject(fields map[string]*jsonSchema) *jsonSchema {
+	return &jsonSchema{Type: "object", Fields: fields}
+}
+
+func schemaArray(items *jsonSchema) *jsonSchema {
+	return &jsonSchema{Type: "array", Items: items}
+}
+
+func schemaMap(items *jsonSchema) *jsonSchema {
+	return &jsonSchema{Type: "map", Items: items}
+}
+
+func schemaNullable(s *jsonSchema) *jsonSchema {
+	ns := *s
+	ns.Nullable = true
+	return &ns
+}
+
+var (
+	schemaString  = &jsonSchema{Type: "string"}
+	schemaNumber  = &jsonSchema{Type: "number"}
+	schemaBoolean = &jsonSchema{Type: "boolean"}
+
+	schemaError = schemaObject(map[string]*jsonSchema{
+		"error": schemaString,
+	})
+	schemaUser = schemaObject(map[string]*jsonSchema{
+		"id":       schemaNumber,
+		"nickname": schemaString,
+	})
+	schemaSheetDetail = schemaObject(map[string]*jsonSchema{
+		"num":          schemaNumber,
+		"mine?":        schemaBoolean,
+		"reserved?":    schemaBoolean,
+		"reserved_at?": schemaNumber,
+	})
+	schemaSheets = schemaMap(schemaObject(map[string]*jsonSchema{
+		"total":   schemaNumber,
+		"remains": schemaNumber,
+		"price":   schemaNumber,
+		"detail?": schemaArray(schemaSheetDetail),
+	}))
+	schemaEvent = schemaObject(map[string]*jsonSchema{
+		"id":      schemaNumber,
+		"title":   schemaString,
+		"total":   schemaNumber,
+		"remains": schemaNumber,
+		"sheets":  schemaSheets,
+	})
+	schemaFullEvent = schemaObject(map[string]*jsonSchema{
+		"id":      schemaNumber,
+		"title":   schemaString,
+		"price":   schemaNumber,
+		"public":  schemaBoolean,
+		"closed":  schemaBoolean,
+		"total":   schemaNumber,
+		"remains": schemaNumber,
+		"sheets":  schemaSheets,
+	})
+	schemaReservation = schemaObject(map[string]*jsonSchema{
+		"id":         schemaNumber,
+		"sheet_rank": schemaString,
+		"sheet_num":  schemaNumber,
+	})
+	schemaFullUser = schemaObject(map[string]*jsonSchema{
+		"id":       schemaNumber,
+		"nickname": schemaString,
+		"recent_reservations": schemaArray(schemaObject(map[string]*jsonSchema{
+			"id": schemaNumber,
+			"event": schemaObject(map[string]*jsonSchema{
+				"id":     schemaNumber,
+				"title":  schemaString,
+				"price":  schemaNumber,
+				"public": schemaBoolean,
+				"closed": schemaBoolean,
+			}),
+			"sheet_rank":  schemaString,
+			"sheet_num":   schemaNumber,
+			"price":       schemaNumber,
+			"reserved_at": schemaNumber,
+			"canceled_at": schemaNullable(schemaNumber),
+		})),
+		"total_price":   schemaNumber,
+		"recent_events": schemaArray(schemaFullEvent),
+	})
+)
+
+type endpointSchema struct {
+	Method  string
+	Pattern string // path segments starting with ":" match any value
+	Schema  *jsonSchema
+}
+
+var endpointSchemas = []endpointSchema{
+	{"POST", "/api/users", schemaUser},
+	{"GET", "/api/users/:id", schemaFullUser},
+	{"POST", "/api/actions/login", schemaUser},
+	{"GET", "/api/events", schemaArray(schemaEvent)},
+	{"GET", "/api/events/:id", schemaEvent},
+	{"POST", "/api/events/:id/actions/reserve", schemaReservation},
+	{"POST", "/admin/api/actions/login", schemaUser},
+	{"GET", "/admin/api/events", schemaArray(schemaFullEvent)},
+	{"POST", "/admin/api/events", schemaFullEvent},
+	{"GET", "/admin/api/events/:id", schemaFullEvent},
+	{"POST", "/admin/api/events/:id/actions/edit", schemaFullEvent},
+}
+
+func matchPathPattern(pattern, path string) bool {
+	ps := strings.Split(pattern, "/")
+	ss := strings.Split(path, "/")
+	if len(ps) != len(ss) {
+		return false
+	}
+	for i := range ps {
+		if strings.HasPrefix(ps[i], ":") {
+			if ss[i] == "" {
+				return false
+			}
+		} else if ps[i] != ss[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the schema of the response, or nil if the response is not a JSON API response.
+func findResponseSchema(method, path string, statusCode int) *jsonSchema {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	if !strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/admin/api/") {
+		return nil
+	}
+	if statusCode == 204 {
+		return nil
+	}
+	if 400 <= statusCode {
+		return schemaError
+	}
+	for _, e := range endpointSchemas {
+		if e.Method == method && matchPathPattern(e.Pattern, path) {
+			return e.Schema
+		}
+	}
+	return nil
+}
+
+func validateJSONSchema(body []byte, schema *jsonSchema) error {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return errorf("レスポンスのJsonデコードに失敗 %v", err)
+	}
+	if err := validateJSONValue("$", v, schema); err != nil {
+		return errorf("レスポンスのJsonの形式が正しくありません %v", err)
+	}
+	return nil
+}
+
+func validateJSONValue(path string, v interface{}, schema *jsonSchema) error {
+	if v == nil {
+		if schema.Nullable {
+			return nil
+		}
+		return errorf("%s: nullです (%s expected)", path, schema.Type)
+	}
+
+	switch schema.Type {
+	case "string":
+		if _, ok := v.(string); !ok {
+			return errorf("%s: 型が正しくありません (string expected)", path)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return errorf("%s: 型が正しくありません (number expected)", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return errorf("%s: 型が正しくありません (boolean expected)", path)
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return errorf("%s: 型が正しくありません (array expected)", path)
+		}
+		for i, item := range items {
+			if err := validateJSONValue(fmt.Sprintf("%s[%d]", path, i), item, schema.Items); err != nil {
+				return err
+			}
+		}
+	case "map":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return errorf("%s: 型が正しくありません (object expected)", path)
+		}
+		for key, item := range obj {
+			if err := validateJSONValue(path+"."+key, item, schema.Items); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return errorf("%s: 型が正しくありません (object expected)", path)
+		}
+
+		fields := make([]string, 0, len(schema.Fields))
+		for field := range schema.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		known := map[string]bool{}
+		for _, field := range fields {
+			fieldSchema := schema.Fields[field]
+			name := strings.TrimSuffix(field, "?")
+			known[name] = true
+
+			item, ok := obj[name]
+			if !ok {
+				if strings.HasSuffix(field, "?") {
+					continue
+				}
+				return errorf("%s.%s: フィールドがありません", path, name)
+			}
+			if err := validateJSONValue(path+"."+name, item, fieldSchema); err != nil {
+				return err
+			}
+		}
+
+		var unknown []string
+		for name := range obj {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return errorf("%s: 不明なフィールドがあります %v", path, unknown)
+		}
+	}
+
+	return nil
+}
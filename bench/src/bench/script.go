@@ -0,0 +1,365 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Custom load scenarios written in Starlark (https://github.com/google/starlark-go), loaded from
+// the *.star files of -scripts. Each file defines run(s) which is called as a load scenario named
+// LoadScript:<file name> with the weight WEIGHT (1 if not defined).
+//
+//	WEIGHT = 5
+//
+//	def run(s):
+//	    s.login()
+//	    res = s.get("/api/events", status = 200)
+//	    events = json.decode(res.body)
+//	    check(len(events) > 0, "イベント一覧が取得できること")
+//
+// s is a session of a virtual user, which starts anonymous:
+//
+//	s.get(path, status = 0, headers = {}, timeout = "")
+//	s.post(path, form = {}, json = None, body = "", content_type = "", status = 0, headers = {}, timeout = "")
+//	s.delete(path, status = 0, headers = {}, timeout = "")
+//	    send a request and return struct(status, body, headers). A status other than the expected one
+//	    (if not 0) is an error of the app, and so is a 5xx. timeout (e.g. "30s") overrides the one of
+//	    the endpoint class (-timeouts).
+//	s.login(), s.login_admin()
+//	    log in as a random user or administrator and return struct(id, nickname)
+//
+// Other predeclared names are check(cond, message) which records an error of the app when cond is
+// false, randint(a, b) and json (json.encode, json.decode). Requests are counted and scored like the
+// ones of the built-in scenarios. Scripts must not change what the built-in scenarios verify, such
+// as reservations of the users, since State does not know about them.
+var ScriptDir = ""
+
+type script struct {
+	name   string
+	weight int
+	run    starlark.Callable
+}
+
+// Loads the scripts of ScriptDir and registers them as load scenarios
+func LoadScripts() error {
+	if ScriptDir == "" {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(ScriptDir, "*.star"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		s, err := loadScript(file)
+		if err != nil {
+			return err
+		}
+		registerNamed("LoadScript:"+s.name, ScenarioLoad, s.weight, s.Run)
+		log.Println("Loaded script", file, "weight", s.weight)
+	}
+	return nil
+}
+
+func loadScript(file string) (*script, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := &starlark.Thread{Name: file}
+	globals, err := starlark.ExecFile(thread, file, src, scriptPredeclared())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load script %s: %v", file, err)
+	}
+
+	s := &script{
+		name:   strings.TrimSuffix(filepath.Base(file), ".star"),
+		weight: 1,
+	}
+	run, ok := globals["run"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script %s does not define run(s)", file)
+	}
+	s.run = run
+	if v, ok := globals["WEIGHT"]; ok {
+		w, err := starlark.AsInt32(v)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("WEIGHT of script %s must be a non-negative int", file)
+		}
+		s.weight = w
+	}
+	return s, nil
+}
+
+func scriptPredeclared() starlark.StringDict {
+	return starlark.StringDict{
+		"json":    starlarkjson.Module,
+		"check":   starlark.NewBuiltin("check", scriptCheck),
+		"randint": starlark.NewBuiltin("randint", scriptRandint),
+	}
+}
+
+// Runs the script as a load scenario
+func (s *script) Run(ctx context.Context, state *State) error {
+	sess := &scriptSession{ctx: ctx, state: state, checker: NewChecker()}
+	defer sess.release()
+
+	thread := &starlark.Thread{Name: s.name}
+	thread.SetLocal(scriptSessionKey, sess)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel("benchmark finished")
+		case <-done:
+		}
+	}()
+
+	_, err := starlark.Call(thread, s.run, starlark.Tuple{sess.value()}, nil)
+	if sess.err != nil {
+		// already recorded as an error of the app
+		return sess.err
+	}
+	if err != nil && ctx.Err() == nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			log.Println("warn: script", s.name, "failed", evalErr.Backtrace())
+		} else {
+			log.Println("warn: script", s.name, "failed", err)
+		}
+	}
+	return nil
+}
+
+const scriptSessionKey = "session"
+
+type scriptSession struct {
+	ctx     context.Context
+	state   *State
+	checker *Checker
+	push    func()
+
+	// the last request for errors recorded by check()
+	lastMethod, lastPath, lastRequestID string
+
+	// the first error of the app, which stops the script
+	err error
+}
+
+func (s *scriptSession) release() {
+	if s.push != nil {
+		s.push()
+		s.push = nil
+	}
+}
+
+func (s *scriptSession) fail(err error) error {
+	if s.err == nil {
+		s.err = err
+	}
+	return err
+}
+
+func (s *scriptSession) value() starlark.Value {
+	return starlarkstruct.FromStringDict(starlark.String("session"), starlark.StringDict{
+		"get":         starlark.NewBuiltin("get", s.request("GET")),
+		"post":        starlark.NewBuiltin("post", s.request("POST")),
+		"delete":      starlark.NewBuiltin("delete", s.request("DELETE")),
+		"login":       starlark.NewBuiltin("login", s.login),
+		"login_admin": starlark.NewBuiltin("login_admin", s.loginAdmin),
+	})
+}
+
+func (s *scriptSession) request(method string) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			path, body, contentType string
+			timeout                 string
+			status                  int
+			headers, form           *starlark.Dict
+			jsonValue               starlark.Value
+		)
+		pairs := []interface{}{"path", &path, "status?", &status, "headers?", &headers, "timeout?", &timeout}
+		if method == "POST" {
+			pairs = append(pairs, "form?", &form, "json?", &jsonValue, "body?", &body, "content_type?", &contentType)
+		}
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, pairs...); err != nil {
+			return nil, err
+		}
+
+		a := &CheckAction{
+			Method:             method,
+			Path:               path,
+			ExpectedStatusCode: status,
+			Description:        fmt.Sprintf("スクリプト %s の %s %s が成功すること", thread.Name, method, path),
+		}
+		var err error
+		if a.Headers, err = stringMap(headers); err != nil {
+			return nil, err
+		}
+		if timeout != "" {
+			if a.Timeout, err = time.ParseDuration(timeout); err != nil {
+				return nil, fmt.Errorf("%s: invalid timeout %q", b.Name(), timeout)
+			}
+		}
+		switch {
+		case form != nil:
+			if a.PostData, err = stringMap(form); err != nil {
+				return nil, err
+			}
+		case jsonValue != nil:
+			encoded, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{jsonValue}, nil)
+			if err != nil {
+				return nil, err
+			}
+			a.PostBody = strings.NewReader(string(encoded.(starlark.String)))
+			a.ContentType = "application/json"
+		case method == "POST":
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			a.PostBody = strings.NewReader(body)
+			a.ContentType = contentType
+		}
+
+		var res starlark.Value
+		a.CheckFunc = func(r *http.Response, b *bytes.Buffer) error {
+			s.lastRequestID = r.Request.Header.Get(RequestIDHeader)
+			res = scriptResponse(r, b)
+			return nil
+		}
+		s.lastMethod, s.lastPath = method, path
+
+		if err := s.checker.Play(s.ctx, a); err != nil {
+			return nil, s.fail(err)
+		}
+		if res == nil {
+			return starlark.None, nil
+		}
+		return res, nil
+	}
+}
+
+func scriptResponse(r *http.Response, body *bytes.Buffer) starlark.Value {
+	headers := starlark.NewDict(len(r.Header))
+	for name := range r.Header {
+		headers.SetKey(starlark.String(strings.ToLower(name)), starlark.String(r.Header.Get(name)))
+	}
+	return starlarkstruct.FromStringDict(starlark.String("response"), starlark.StringDict{
+		"status":  starlark.MakeInt(r.StatusCode),
+		"body":    starlark.String(body.String()),
+		"headers": headers,
+	})
+}
+
+func (s *scriptSession) login(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	s.release()
+
+	user, checker, push := s.state.PopRandomUser()
+	if user == nil {
+		return nil, fmt.Errorf("no users are available")
+	}
+	s.checker, s.push = checker, push
+	if err := loginAppUser(s.ctx, checker, user); err != nil {
+		return nil, s.fail(err)
+	}
+	return starlarkstruct.FromStringDict(starlark.String("user"), starlark.StringDict{
+		"id":       starlark.MakeInt(int(user.ID)),
+		"nickname": starlark.String(user.Nickname),
+	}), nil
+}
+
+func (s *scriptSession) loginAdmin(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+	s.release()
+
+	admin, checker, push := s.state.PopRandomAdministrator()
+	if admin == nil {
+		return nil, fmt.Errorf("no administrators are available")
+	}
+	s.checker, s.push = checker, push
+	if err := loginAdministrator(s.ctx, checker, admin); err != nil {
+		return nil, s.fail(err)
+	}
+	return starlarkstruct.FromStringDict(starlark.String("administrator"), starlark.StringDict{
+		"id":       starlark.MakeInt(int(admin.ID)),
+		"nickname": starlark.String(admin.Nickname),
+	}), nil
+}
+
+func scriptCheck(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		cond    starlark.Value
+		message string
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "cond", &cond, "message", &message); err != nil {
+		return nil, err
+	}
+	if cond.Truth() {
+		return starlark.None, nil
+	}
+
+	s, _ := thread.Local(scriptSessionKey).(*scriptSession)
+	if s == nil {
+		return nil, fmt.Errorf("check() is called outside of run(s)")
+	}
+	cerr := &CheckerError{
+		t:         time.Now(),
+		err:       fmt.Errorf("%s", message),
+		code:      ErrorCodeWrongBody,
+		method:    s.lastMethod,
+		path:      s.lastPath,
+		url:       s.lastPath,
+		requestID: s.lastRequestID,
+	}
+	appendError(cerr)
+	return nil, s.fail(cerr)
+}
+
+func scriptRandint(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var lo, hi int
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "a", &lo, "b", &hi); err != nil {
+		return nil, err
+	}
+	if hi < lo {
+		return nil, fmt.Errorf("randint: empty range [%d, %d]", lo, hi)
+	}
+	return starlark.MakeInt(lo + rand.Intn(hi-lo+1)), nil
+}
+
+func stringMap(d *starlark.Dict) (map[string]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+	m := map[string]string{}
+	for _, kv := range d.Items() {
+		k, ok1 := starlark.AsString(kv[0])
+		v, ok2 := starlark.AsString(kv[1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("keys and values must be strings: %v", d)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
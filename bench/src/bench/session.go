@@ -0,0 +1,167 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+
+	"bench/parameter"
+)
+
+// Session is a logged-in user walking through the site, rather than a single stateless request
+type Session struct {
+	state   *State
+	user    *AppUser
+	checker *Checker
+	push    func()
+}
+
+// Returns nil if no user is available
+func NewSession(state *State) *Session {
+	user, checker, push := state.PopRandomUser()
+	if user == nil {
+		return nil
+	}
+	return &Session{state: state, user: user, checker: checker, push: push}
+}
+
+func (s *Session) Close() {
+	s.push()
+}
+
+// Run walks through top page → event detail → reserve → my page
+func (s *Session) Run(ctx context.Context) error {
+	err := loginAppUser(ctx, s.checker, s.user)
+	if err != nil {
+		return err
+	}
+
+	goLoadAsset(ctx, s.checker)
+	err = s.checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               "/",
+		ExpectedStatusCode: 200,
+		Description:        "ページが表示されること",
+	})
+	if err != nil {
+		return err
+	}
+
+	eventSheet, eventSheetPush, err := popOrCreateEventSheet(ctx, s.state)
+	if err != nil {
+		return err
+	}
+	if eventSheet == nil {
+		return nil
+	}
+	reserved := false
+	defer func() {
+		// NOTE: push only after reserve succeeds
+		if reserved {
+			eventSheetPush()
+		}
+	}()
+
+	event := s.state.FindEventByID(eventSheet.EventID)
+	if event == nil {
+		return nil
+	}
+	err = s.checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               fmt.Sprintf("/api/events/%d", event.ID),
+		ExpectedStatusCode: 200,
+		Description:        "公開イベントを取得できること",
+		CheckFunc:          checkJsonEventResponse(event, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	reservation, err := reserveSheet(ctx, s.state, s.checker, s.user, eventSheet)
+	if err != nil {
+		return err
+	}
+	if reservation == nil {
+		return nil
+	}
+	reserved = true
+
+	err = s.checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               fmt.Sprintf("/api/users/%d", s.user.ID),
+		ExpectedStatusCode: 200,
+		Description:        "ユーザー情報が取得できること",
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func LoadUserSession(ctx context.Context, state *State) error {
+	session := NewSession(state)
+	if session == nil {
+		return nil
+	}
+	defer session.Close()
+
+	return session.Run(ctx)
+}
+
+// An organizer who keeps the admin page open to monitor the sales during the event: the admin page
+// is reloaded, and the details and the sales report of a public event are opened from it,
+// AdminSessionPageViews times in a session.
+func LoadAdminSession(ctx context.Context, state *State) error {
+	admin, checker, push := state.PopRandomAdministrator()
+	if admin == nil {
+		return nil
+	}
+	defer push()
+
+	err := loginAdministrator(ctx, checker, admin)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < parameter.AdminSessionPageViews; i++ {
+		goLoadAsset(ctx, checker)
+		err = checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               "/admin/",
+			ExpectedStatusCode: 200,
+			Description:        "ページが表示されること",
+		})
+		if err != nil {
+			return err
+		}
+
+		event := state.GetRandomPublicEvent()
+		if event == nil {
+			continue
+		}
+
+		// the event may be changed by the other scenarios, and is checked at CheckAdminEventLifecycle
+		err = checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               fmt.Sprintf("/admin/api/events/%d", event.ID),
+			ExpectedStatusCode: 200,
+			Description:        "管理者が公開イベントを取得できること",
+		})
+		if err != nil {
+			return err
+		}
+
+		// We do check at CheckEventReport
+		err = checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               fmt.Sprintf("/admin/api/reports/events/%d/sales", event.ID),
+			ExpectedStatusCode: 200,
+			Description:        "レポートを取得できること",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package bench
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bench/parameter"
+)
+
+// Slow requests are kept in a sliding window of LoadLevelUpLookback, which blocks the level up when
+// it has LoadLevelUpSlowRequests or more of them in flight, and the slowest SlowPathTopK of the whole
+// run are reported in the result. Finished requests block the level up through the latency
+// percentiles of the endpoint stats instead.
+type SlowPath struct {
+	Path      string    `json:"path"`
+	LatencyMs float64   `json:"latency_ms"`
+	InFlight  bool      `json:"in_flight,omitempty"` // LatencyMs is the threshold, the request was not finished yet
+	Time      time.Time `json:"time"`                // when the request was found slow or finished
+}
+
+type slowRequest struct {
+	path     string
+	latency  time.Duration
+	t        time.Time
+	observed bool
+	done     bool
+}
+
+var (
+	slowPathMtx     sync.Mutex
+	slowRequests    []*slowRequest // in the order they were found slow, pruned after LoadLevelUpLookback
+	slowestRequests []*slowRequest // the slowest first
+)
+
+func (r *slowRequest) slowPath() SlowPath {
+	return SlowPath{
+		Path:      r.path,
+		LatencyMs: float64(r.latency) / float64(time.Millisecond),
+		InFlight:  !r.done,
+		Time:      r.t,
+	}
+}
+
+// Called when the request is not finished within the threshold
+func observeSlowRequest(r *slowRequest, threshold time.Duration) {
+	slowPathMtx.Lock()
+	defer slowPathMtx.Unlock()
+
+	now := time.Now()
+	r.observed = true
+	r.latency = threshold
+	r.t = now
+
+	i := 0
+	for i < len(slowRequests) && now.Sub(slowRequests[i].t) >= parameter.LoadLevelUpLookback {
+		i++
+	}
+	slowRequests = append(slowRequests[i:], r)
+}
+
+// Records the latency of a request observed slow
+func finishSlowRequest(r *slowRequest, latency time.Duration) {
+	slowPathMtx.Lock()
+	defer slowPathMtx.Unlock()
+
+	if !r.observed || r.done {
+		return
+	}
+	r.done = true
+	r.latency = latency
+	r.t = time.Now()
+
+	i := sort.Search(len(slowestRequests), func(i int) bool { return slowestRequests[i].latency < latency })
+	if i >= parameter.SlowPathTopK {
+		return
+	}
+	slowestRequests = append(slowestRequests, nil)
+	copy(slowestRequests[i+1:], slowestRequests[i:])
+	slowestRequests[i] = r
+	if len(slowestRequests) > parameter.SlowPathTopK {
+		slowestRequests = slowestRequests[:parameter.SlowPathTopK]
+	}
+}
+
+// Returns the slowest SlowPathTopK requests found slow within window and the number of them
+func GetRecentSlowPaths(window time.Duration) ([]SlowPath, int) {
+	slowPathMtx.Lock()
+	defer slowPathMtx.Unlock()
+
+	var paths []SlowPath
+	for _, r := range slowRequests {
+		if time.Since(r.t) < window {
+			paths = append(paths, r.slowPath())
+		}
+	}
+	n := len(paths)
+	sort.SliceStable(paths, func(i, j int) bool { return paths[i].LatencyMs > paths[j].LatencyMs })
+	if len(paths) > parameter.SlowPathTopK {
+		paths = paths[:parameter.SlowPathTopK]
+	}
+	return paths, n
+}
+
+// Returns the number of requests found slow within window which are not finished yet.
+// They are not in the endpoint stats until they finish.
+func CountInFlightSlowRequests(window time.Duration) int {
+	slowPathMtx.Lock()
+	defer slowPathMtx.Unlock()
+
+	n := 0
+	for _, r := range slowRequests {
+		if !r.done && time.Since(r.t) < window {
+			n++
+		}
+	}
+	return n
+}
+
+// Forgets the slow requests so far. The ones still in flight are not recorded when they finish.
+func ResetSlowPaths() {
+	slowPathMtx.Lock()
+	defer slowPathMtx.Unlock()
+
+	for _, r := range slowRequests {
+		r.done = true
+	}
+	slowRequests = nil
+	slowestRequests = nil
+}
+
+// Returns the slowest SlowPathTopK finished requests of the run
+func GetSlowestPaths() []SlowPath {
+	slowPathMtx.Lock()
+	defer slowPathMtx.Unlock()
+
+	paths := make([]SlowPath, 0, len(slowestRequests))
+	for _, r := range slowestRequests {
+		paths = append(paths, r.slowPath())
+	}
+	return paths
+}
+
+func FormatSlowPaths(paths []SlowPath) string {
+	s := make([]string, 0, len(paths))
+	for _, p := range paths {
+		s = append(s, fmt.Sprintf("%s(%.0fms)", p.Path, p.LatencyMs))
+	}
+	return strings.Join(s, " ")
+}
@@ -1,24 +1,25 @@
 package bench
 
 type StaticFile struct {
-	Path string
-	Size int64
-	Hash string
+	Path   string
+	Size   int64
+	Hash   string // MD5
+	SHA256 string
 }
 
 var (
 	StaticFiles = []*StaticFile{
-		&StaticFile{"/css/admin.css", 684, "af8ea54a6883660979ab6e9d3b041a41"},
-		&StaticFile{"/css/bootstrap.min.css", 140930, "a7022c6fa83d91db67738d6e3cd3252d"},
-		&StaticFile{"/css/layout.css", 707, "25d20a88af77ba832e0d25a99ebe67c3"},
-		&StaticFile{"/favicon.ico", 1092, "07b21a6c8984e04d108064c585411601"},
-		&StaticFile{"/js/admin.js", 8454, "f3739b2c9ba150e2a2c4f53d7194fea2"},
-		&StaticFile{"/js/app.js", 10204, "43f9dccae02a8dab134b20c053e41f7b"},
-		&StaticFile{"/js/bootstrap-waitingfor.min.js", 2074, "c6167b2ec19dc56b16aa94511a15964c"},
-		&StaticFile{"/js/bootstrap.bundle.min.js", 70682, "d70c474886678aebe3e9d91965dc8b62"},
-		&StaticFile{"/js/fetch.min.js", 7337, "b72077f7f0fa3fc8f79a2fc57c15d827"},
-		&StaticFile{"/js/jquery-3.3.1.slim.min.js", 69917, "99b0a83cf1b0b1e2cb16041520e87641"},
-		&StaticFile{"/js/vue.min.js", 86452, "5283b86cbf48a538ee3cbebac633ccd4"},
+		&StaticFile{"/css/admin.css", 684, "af8ea54a6883660979ab6e9d3b041a41", "6a135429d41bbfc53c62f27bb5b9e2ce6152e33958d80d28d3ed873f58a1ad99"},
+		&StaticFile{"/css/bootstrap.min.css", 140930, "a7022c6fa83d91db67738d6e3cd3252d", "31df1e69ea3aece8a8bae5c08bcb7f5e977cb76f886897b301355359b66a48ec"},
+		&StaticFile{"/css/layout.css", 707, "25d20a88af77ba832e0d25a99ebe67c3", "c6a075ff7d14372411804a5535c6c479c4752e51c2bd1a032a4df14e0158de23"},
+		&StaticFile{"/favicon.ico", 1092, "07b21a6c8984e04d108064c585411601", "25ba063060f43a8a7550d3ba1a0b958ed8539a4dc1299144f714aa28c311ae3f"},
+		&StaticFile{"/js/admin.js", 8454, "f3739b2c9ba150e2a2c4f53d7194fea2", "a7129c363914875050484aa279da5a72d8830dbe00a7cc694d8b4032c96fdb49"},
+		&StaticFile{"/js/app.js", 10204, "43f9dccae02a8dab134b20c053e41f7b", "c5ffd9ae73d2d74f130e52a8cb99bf24bef0ac8c3b7f877ee310ec1e3177e9fd"},
+		&StaticFile{"/js/bootstrap-waitingfor.min.js", 2074, "c6167b2ec19dc56b16aa94511a15964c", "457392033993d7b1c7ae7ab05f71e4a39c7f4e0f427211cc5fac11e5d189e946"},
+		&StaticFile{"/js/bootstrap.bundle.min.js", 70682, "d70c474886678aebe3e9d91965dc8b62", "928f97f310d8f768c5e3d521e3b1ce2cff156f9cc60c5d09fad772f4a2c43f52"},
+		&StaticFile{"/js/fetch.min.js", 7337, "b72077f7f0fa3fc8f79a2fc57c15d827", "2be73aad94e105f8f20e23e250308e7d2115fae65430f3148b2d36380acf0033"},
+		&StaticFile{"/js/jquery-3.3.1.slim.min.js", 69917, "99b0a83cf1b0b1e2cb16041520e87641", "dde76b9b2b90d30eb97fc81f06caa8c338c97b688cea7d2729c88f529f32fbb1"},
+		&StaticFile{"/js/vue.min.js", 86452, "5283b86cbf48a538ee3cbebac633ccd4", "4da2dc78cc23591a9ee3285ba8f3891fa57b506b7902fbdd35fa5a2172566c55"},
 	}
 )
 
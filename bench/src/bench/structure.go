@@ -7,6 +7,8 @@ import (
 	"sync"
 	"time"
 
+	"bench/parameter"
+
 	"github.com/LK4D4/trylock"
 )
 
@@ -222,6 +224,7 @@ type ReportRecord struct {
 	SheetNum      uint
 	SheetPrice    uint
 	UserID        uint
+	SoldAt        time.Time
 	CanceledAt    time.Time
 }
 
@@ -236,7 +239,7 @@ type Reservation struct {
 	ReservedAt int64 // Used only in initial reservations. 0 is set for rest because reserve API does not return it
 	CanceledAt int64 // Used only in initial reservations. 0 is set for rest because reserve API does not return it
 
-	// ReserveRequestedAt time.Time
+	ReserveRequestedAt time.Time
 	ReserveCompletedAt time.Time
 	cancelMtx          trylock.Mutex
 	CancelRequestedAt  time.Time
@@ -336,6 +339,7 @@ type State struct {
 
 	reservationMtx        sync.Mutex
 	reservations          map[uint]*Reservation // key: reservation id
+	initialReservedCount  uint
 	reserveRequestedCount uint
 	reserveCompletedCount uint
 	cancelRequestedCount  uint
@@ -352,6 +356,8 @@ type State struct {
 	cancelLogMtx  sync.Mutex
 	cancelLogID   uint64                  // 2^64 should be enough
 	cancelLog     map[uint64]*Reservation // key: cancelLogID
+
+	ledger ledger
 }
 
 func (s *State) Init() {
@@ -385,6 +391,7 @@ func (s *State) Init() {
 	}
 	s.reserveRequestedCount = uint(len(s.reservations))
 	s.reserveCompletedCount = uint(len(s.reservations))
+	s.initialReservedCount = uint(len(s.reservations))
 	// NOTE: Need to init cancel counts if initial data contains cancels.
 
 	s.reserveLogID = 0
@@ -424,19 +431,20 @@ func (s *State) PopUserByID(userID uint) (*AppUser, *Checker, func()) {
 		return nil, nil, nil
 	}
 
-	var i int
-	var u *AppUser
-	for i, u = range s.users {
-		if u.ID == userID {
+	i := -1
+	for j, user := range s.users {
+		if user.ID == userID {
+			i = j
 			break
 		}
 	}
 
-	if u == nil {
+	if i < 0 {
 		log.Printf("debug: User ID:%d not found\n", userID)
 		return nil, nil, nil
 	}
 
+	u := s.users[i]
 	s.users[i] = s.users[n-1]
 	s.users[n-1] = nil
 	s.users = s.users[:n-1]
@@ -615,6 +623,24 @@ func (s *State) pushNewEventLocked(event *Event, createdAt time.Time, caller str
 	}
 }
 
+// Same as PushNewEvent, but sheets of the rank are not pushed into eventSheets
+// so that nobody else reserves them
+func (s *State) PushNewEventWithoutRank(event *Event, createdAt time.Time, caller string, rank string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.pushNewEventLocked(event, createdAt, caller)
+
+	eventSheets := s.eventSheets[:0]
+	for _, eventSheet := range s.eventSheets {
+		if eventSheet.EventID == event.ID && eventSheet.Rank == rank {
+			continue
+		}
+		eventSheets = append(eventSheets, eventSheet)
+	}
+	s.eventSheets = eventSheets
+}
+
 // Initial closed events are all reserved and closed
 func (s *State) pushInitialClosedEventLocked(event *Event, createdAt time.Time) {
 	event.CreatedAt = createdAt
@@ -761,6 +787,46 @@ func (s *State) PushEventSheet(eventSheet *EventSheet) {
 	}
 }
 
+// Moves the sheet of the canceled reservation from reservedEventSheets back into eventSheets,
+// so that it is reserved again. If the event has been made private or closed since, the sheet goes
+// where pushNewEventLocked puts the sheets of such events instead, as the app refuses to reserve it.
+// Does nothing if the sheet is not found.
+func (s *State) ReleaseEventSheet(reservation *Reservation) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	var event *Event
+	for _, e := range s.events {
+		if e.ID == reservation.EventID {
+			event = e
+			break
+		}
+	}
+
+	for i, eventSheet := range s.reservedEventSheets {
+		if eventSheet.EventID != reservation.EventID || eventSheet.Rank != reservation.SheetRank || eventSheet.Num != reservation.SheetNum {
+			continue
+		}
+		n := len(s.reservedEventSheets)
+		s.reservedEventSheets[i] = s.reservedEventSheets[n-1]
+		s.reservedEventSheets[n-1] = nil
+		s.reservedEventSheets = s.reservedEventSheets[:n-1]
+
+		eventSheet.Num = NonReservedNum
+		switch {
+		case event == nil:
+			log.Printf("debug: ReleaseEventSheet: event %d is not found\n", reservation.EventID)
+		case event.ClosedFg:
+			s.closedEventSheets = append(s.closedEventSheets, eventSheet)
+		case !event.PublicFg:
+			s.privateEventSheets = append(s.privateEventSheets, eventSheet)
+		default:
+			s.eventSheets = append(s.eventSheets, eventSheet)
+		}
+		return
+	}
+}
+
 func GetRandomSheetRank() string {
 	return DataSet.SheetKinds[rand.Intn(len(DataSet.SheetKinds))].Rank
 }
@@ -794,6 +860,13 @@ func (s *State) FindReservationByID(reservationID uint) *Reservation {
 	return reservation
 }
 
+func (s *State) IsCancelRequested(reservation *Reservation) bool {
+	s.reservationMtx.Lock()
+	defer s.reservationMtx.Unlock()
+
+	return !reservation.CancelRequestedAt.IsZero()
+}
+
 // Returns a shallow copy of s.reservations
 func (s *State) GetReservations() map[uint]*Reservation {
 	s.reservationMtx.Lock()
@@ -901,6 +974,22 @@ func (s *State) GetReserveRequestedCount() uint {
 	return s.reserveRequestedCount
 }
 
+// Returns the number of completed reservations and requested cancelations made by the benchmarker,
+// that is, reservations in the initial data set are excluded
+func (s *State) GetReserveCancelCount() (reserved uint, canceled uint) {
+	s.reservationMtx.Lock()
+	defer s.reservationMtx.Unlock()
+
+	return s.reserveCompletedCount - s.initialReservedCount, s.cancelRequestedCount
+}
+
+// Decides whether a user cancels the reservation just made
+// so that the realized cancel:reserve ratio follows parameter.CancelReserveRatio
+func (s *State) ShouldCancel() bool {
+	reserved, canceled := s.GetReserveCancelCount()
+	return float64(canceled) < parameter.CancelReserveRatio*float64(reserved)
+}
+
 func (e *Event) GetReserveRequestedCount() uint {
 	e.reservationMtx.Lock()
 	defer e.reservationMtx.Unlock()
@@ -909,6 +998,7 @@ func (e *Event) GetReserveRequestedCount() uint {
 }
 
 func (s *State) BeginReservation(lockedUser *AppUser, reservation *Reservation) (logID uint64) {
+	reservation.ReserveRequestedAt = time.Now()
 	func() {
 		s.reservationMtx.Lock()
 		defer s.reservationMtx.Unlock()
@@ -944,6 +1034,7 @@ func (s *State) CommitReservation(logID uint64, lockedUser *AppUser, reservation
 
 		reservation.ReserveCompletedAt = time.Now()
 		s.reservations[reservation.ID] = reservation
+		s.ledger.append(LedgerReserve, reservation, reservation.ReserveCompletedAt)
 		s.reserveCompletedCount++
 		assert(uint(len(s.reservations)) == s.reserveCompletedCount)
 		return nil
@@ -970,6 +1061,31 @@ func (s *State) CommitReservation(logID uint64, lockedUser *AppUser, reservation
 	return nil
 }
 
+// Undoes BeginReservation when the app answered the reservation with an error, i.e. it is known
+// not to have been made. Reservations whose outcome is unknown (e.g. timeouts) must not be aborted.
+func (s *State) AbortReservation(logID uint64, lockedUser *AppUser, reservation *Reservation) {
+	func() {
+		s.reservationMtx.Lock()
+		defer s.reservationMtx.Unlock()
+
+		s.reserveRequestedCount--
+	}()
+	func() {
+		event := s.FindEventByID(reservation.EventID)
+		rank := reservation.SheetRank
+
+		event.reservationMtx.Lock()
+		defer event.reservationMtx.Unlock()
+
+		event.ReserveRequestedCount--
+		*event.ReserveRequestedRT.getPointer(rank)--
+	}()
+	{
+		lockedUser.Status.PositiveTotalPrice -= reservation.Price
+	}
+	s.abortReserveLog(logID, reservation)
+}
+
 func (s *State) BeginCancelation(lockedUser *AppUser, reservation *Reservation) (logID uint64) {
 	func() {
 		s.reservationMtx.Lock()
@@ -1005,6 +1121,7 @@ func (s *State) CommitCancelation(logID uint64, lockedUser *AppUser, reservation
 
 		reservation.CancelCompletedAt = time.Now()
 		s.reservations[reservation.ID] = reservation
+		s.ledger.append(LedgerCancel, reservation, reservation.CancelCompletedAt)
 		s.cancelCompletedCount++
 	}()
 	func() {
@@ -1045,6 +1162,14 @@ func (s *State) deleteReserveLog(reserveLogID uint64, reservation *Reservation)
 	delete(s.reserveLog, reserveLogID)
 }
 
+func (s *State) abortReserveLog(reserveLogID uint64, reservation *Reservation) {
+	s.reserveLogMtx.Lock()
+	defer s.reserveLogMtx.Unlock()
+
+	log.Printf("debug: deleteReserveLog LogID:%2d EventID:%2d UserID:%3d SheetRank:%s (Aborted)\n", reserveLogID, reservation.EventID, reservation.UserID, reservation.SheetRank)
+	delete(s.reserveLog, reserveLogID)
+}
+
 func (s *State) appendCancelLog(reservation *Reservation) uint64 {
 	s.cancelLogMtx.Lock()
 	defer s.cancelLogMtx.Unlock()
@@ -0,0 +1,96 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Think time of virtual users: during the load, a Checker pauses for ThinkTime after a response
+// before its next request, as a user reads the page before the next click, instead of hammering
+// the app back-to-back. Static files are loaded right away as browsers do. Checks do not think.
+
+// ThinkTime returns how long a virtual user pauses between requests
+var ThinkTime = func() time.Duration { return 0 }
+
+// SetThinkTime configures ThinkTime from a spec.
+//
+//	none                      no think time (default)
+//	fixed:<d>                 always d (const:<d> is the same)
+//	uniform:<min>:<max>       uniformly distributed in [min, max)
+//	exp:<mean>                exponentially distributed with the given mean
+//	normal:<mean>:<stddev>    normally distributed, and 0 instead of negative ones
+func SetThinkTime(spec string) error {
+	parts := strings.Split(spec, ":")
+	durations := make([]time.Duration, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		d, err := time.ParseDuration(p)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid think time %q: %v", spec, p)
+		}
+		durations = append(durations, d)
+	}
+
+	switch {
+	case spec == "" || spec == "none":
+		ThinkTime = func() time.Duration { return 0 }
+	case (parts[0] == "fixed" || parts[0] == "const") && len(durations) == 1:
+		d := durations[0]
+		ThinkTime = func() time.Duration { return d }
+	case parts[0] == "uniform" && len(durations) == 2 && durations[0] < durations[1]:
+		min, max := durations[0], durations[1]
+		ThinkTime = func() time.Duration { return min + time.Duration(rand.Int63n(int64(max-min))) }
+	case parts[0] == "exp" && len(durations) == 1:
+		mean := durations[0]
+		ThinkTime = func() time.Duration { return time.Duration(rand.ExpFloat64() * float64(mean)) }
+	case parts[0] == "normal" && len(durations) == 2:
+		mean, stddev := durations[0], durations[1]
+		ThinkTime = func() time.Duration {
+			if d := time.Duration(float64(mean) + rand.NormFloat64()*float64(stddev)); d > 0 {
+				return d
+			}
+			return 0
+		}
+	default:
+		return fmt.Errorf("invalid think time %q", spec)
+	}
+	return nil
+}
+
+type thinkTimeKey struct{}
+
+// Returns a context whose requests are made after ThinkTime, for the load scenarios
+func WithThinkTime(ctx context.Context) context.Context {
+	return context.WithValue(ctx, thinkTimeKey{}, true)
+}
+
+func thinksIn(ctx context.Context) bool {
+	v, _ := ctx.Value(thinkTimeKey{}).(bool)
+	return v
+}
+
+// Pauses until ThinkTime passes since the last response to the virtual user. The first request
+// of a user is sent right away. Returns an error if ctx is done.
+func (c *Checker) think(ctx context.Context) error {
+	last := atomic.LoadInt64(&c.lastResponseAt)
+	if last == 0 {
+		return nil
+	}
+	d := ThinkTime() - time.Since(time.Unix(0, last))
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
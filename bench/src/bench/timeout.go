@@ -0,0 +1,72 @@
+package bench
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client timeouts by the class of the endpoint. Static files and reports have their own timeouts
+// since a report legitimately takes much longer than a static file, and the other requests (the
+// API and the pages) have the ones of their method.
+
+// Returns the timeout of a request of method to path, unless its CheckAction has one
+func TimeoutOf(method, path string) time.Duration {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	switch {
+	case strings.HasPrefix(path, "/admin/api/reports/"):
+		return ReportTimeout
+	case staticFileByPath[path] != nil:
+		return StaticTimeout
+	}
+
+	switch method {
+	case http.MethodPost:
+		return PostTimeout
+	case http.MethodDelete:
+		return DeleteTimeout
+	}
+	return GetTimeout
+}
+
+// SetTimeouts overrides the timeouts of the endpoint classes.
+//
+//	<class>=<d>,...  e.g. static=5s,report=2m,api=3s
+//
+// The classes are static, report, api (the API and the pages of any method) and get, post and
+// delete for the ones of a method.
+func SetTimeouts(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, s := range strings.Split(spec, ",") {
+		i := strings.Index(s, "=")
+		if i <= 0 {
+			return fmt.Errorf("invalid timeout %q", s)
+		}
+		d, err := time.ParseDuration(s[i+1:])
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", s)
+		}
+		switch s[:i] {
+		case "static":
+			StaticTimeout = d
+		case "report":
+			ReportTimeout = d
+		case "api":
+			GetTimeout, PostTimeout, DeleteTimeout = d, d, d
+		case "get":
+			GetTimeout = d
+		case "post":
+			PostTimeout = d
+		case "delete":
+			DeleteTimeout = d
+		default:
+			return fmt.Errorf("invalid timeout class %q: static, report, api, get, post or delete", s[:i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bench/parameter"
+)
+
+// Spans of scenarios and requests are exported in OTLP/HTTP JSON (<endpoint>/v1/traces) so that
+// the runs can be inspected in Jaeger or Tempo through an OpenTelemetry collector. Requests carry
+// a W3C traceparent header so that the app's spans join the same trace. Disabled if empty.
+var OTLPEndpoint = ""
+
+var (
+	spanCh       chan *Span
+	spanExportCh chan chan struct{}
+)
+
+type spanKey struct{}
+
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+}
+
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// Starts the exporter. Spans are dropped when the exporter can not keep up.
+func StartTracing() {
+	if OTLPEndpoint == "" {
+		return
+	}
+	spanCh = make(chan *Span, parameter.TraceQueueSize)
+	spanExportCh = make(chan chan struct{})
+	go exportSpans()
+}
+
+// Exports the remaining spans, waiting up to timeout
+func FlushTraces(timeout time.Duration) {
+	if spanCh == nil {
+		return
+	}
+	done := make(chan struct{})
+	select {
+	case spanExportCh <- done:
+	case <-time.After(timeout):
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// Starts a span as a child of the span in ctx, if any. Returns nil when tracing is disabled.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return startSpan(ctx, name, spanKindInternal)
+}
+
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if spanCh == nil {
+		return ctx, nil
+	}
+	s := &Span{name: name, kind: kind, start: time.Now(), attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// Finishes the span. err marks the span as failed.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	select {
+	case spanCh <- s:
+	default:
+	}
+}
+
+// W3C Trace Context header value for the span
+func (s *Span) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+func exportSpans() {
+	ticker := time.NewTicker(parameter.TraceExportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := postSpans(batch); err != nil {
+			log.Println("warn: failed to export spans", err)
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case s := <-spanCh:
+			batch = append(batch, s)
+			if len(batch) >= parameter.TraceBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case done := <-spanExportCh:
+			for n := len(spanCh); n > 0; n-- {
+				batch = append(batch, <-spanCh)
+			}
+			flush()
+			close(done)
+		}
+	}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	for k, v := range attrs {
+		var value map[string]interface{}
+		switch v := v.(type) {
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		list = append(list, map[string]interface{}{"key": k, "value": value})
+	}
+	return list
+}
+
+func postSpans(spans []*Span) error {
+	var otlpSpans []map[string]interface{}
+	for _, s := range spans {
+		span := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            map[string]interface{}{"code": 1},
+		}
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			span["status"] = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+		otlpSpans = append(otlpSpans, span)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": UserAgent}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "bench"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: parameter.TraceExportTimeout}
+	res, err := client.Post(strings.TrimSuffix(OTLPEndpoint, "/")+"/v1/traces", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Each Checker (i.e. a virtual user) sends the User-Agent of a browser picked when it is created,
+// so that the app can not tell the benchmarker by its User-Agent nor serve it from a cache keyed
+// by a single one. Requests and static files are counted with the label device of the browser.
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+)
+
+type userAgent struct {
+	device string
+	value  string
+}
+
+var defaultUserAgents = []userAgent{
+	{DeviceDesktop, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36"},
+	{DeviceDesktop, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0"},
+	{DeviceDesktop, "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Safari/605.1.15"},
+	{DeviceDesktop, "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36"},
+	{DeviceDesktop, "Mozilla/5.0 (X11; Linux x86_64; rv:133.0) Gecko/20100101 Firefox/133.0"},
+	{DeviceMobile, "Mozilla/5.0 (iPhone; CPU iPhone OS 18_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Mobile/15E148 Safari/604.1"},
+	{DeviceMobile, "Mozilla/5.0 (iPad; CPU OS 18_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Mobile/15E148 Safari/604.1"},
+	{DeviceMobile, "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Mobile Safari/537.36"},
+	{DeviceMobile, "Mozilla/5.0 (Linux; Android 14; SM-S921B) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/27.0 Chrome/125.0.0.0 Mobile Safari/537.36"},
+}
+
+var userAgents = defaultUserAgents
+
+// Sets the User-Agents of virtual users. spec is "" for the built-in browsers, "fixed" to send
+// UserAgent from every user as before, or the path of a file of "<device> <User-Agent>" lines,
+// in which empty lines and lines starting with # are ignored.
+func SetUserAgents(spec string) error {
+	switch spec {
+	case "":
+		userAgents = defaultUserAgents
+		return nil
+	case "fixed":
+		userAgents = []userAgent{{"bench", UserAgent}}
+		return nil
+	}
+
+	f, err := os.Open(spec)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var uas []userAgent
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		fields := strings.SplitN(s, " ", 2)
+		if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" {
+			return fmt.Errorf("%s:%d: invalid user agent %q (expected \"<device> <User-Agent>\")", spec, line, s)
+		}
+		uas = append(uas, userAgent{fields[0], strings.TrimSpace(fields[1])})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(uas) == 0 {
+		return fmt.Errorf("%s: no user agents", spec)
+	}
+	userAgents = uas
+	return nil
+}
+
+func pickUserAgent() userAgent {
+	return userAgents[rand.Intn(len(userAgents))]
+}
+
+// Returns one of the User-Agents of device, or false if there is none
+func pickUserAgentOf(device string) (userAgent, bool) {
+	var uas []userAgent
+	for _, ua := range userAgents {
+		if ua.device == device {
+			uas = append(uas, ua)
+		}
+	}
+	if len(uas) == 0 {
+		return userAgent{}, false
+	}
+	return uas[rand.Intn(len(uas))], true
+}
+
+// Loads the top page and the static files as a mobile browser (-mobile-checks). The top page has
+// to have the viewport for mobile devices, and the static files have to be the same as the ones
+// served to desktop browsers.
+func CheckMobileAssets(ctx context.Context, state *State) error {
+	ua, ok := pickUserAgentOf(DeviceMobile)
+	if !ok {
+		return nil
+	}
+	checker := NewChecker()
+	checker.userAgent = ua
+
+	err := checker.Play(ctx, &CheckAction{
+		Method:             "GET",
+		Path:               "/",
+		ExpectedStatusCode: 200,
+		Description:        "モバイル端末でページが表示されること",
+		CheckFunc: checkHTML(func(res *http.Response, doc *goquery.Document) error {
+			content, _ := doc.Find(`meta[name="viewport"]`).Attr("content")
+			if !strings.Contains(content, "width=device-width") {
+				log.Printf("debug: viewport:%q (User-Agent:%s)\n", content, ua.value)
+				return fatalErrorf("%sにモバイル端末向けのviewportが指定されていません", Msg("トップページ"))
+			}
+			return nil
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, staticFile := range StaticFiles {
+		sf := staticFile
+		err := checker.Play(ctx, &CheckAction{
+			Method:             "GET",
+			Path:               sf.Path,
+			ExpectedStatusCode: 200,
+			Description:        "モバイル端末で静的ファイルが取得できること",
+			CheckFunc: func(res *http.Response, body *bytes.Buffer) error {
+				return checkStaticFileBody(sf, body)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package bench
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// CSV of login_name,password,nickname (-users) which replaces the initial users of user.tsv, for a
+// database seeded with its own fixtures. The users get the ids 1, 2, ... in the order of the rows,
+// so the database has to have them with the same ids, as the dump of gen-initial-dataset -users has
+// along with the reservations made by them. The first row is skipped if it is the header.
+var UsersPath = ""
+
+func readUsersCSV(path string) ([]*AppUser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	var users []*AppUser
+	lines := map[string]int{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		line, _ := r.FieldPos(0)
+		if line == 1 && strings.EqualFold(record[0], "login_name") {
+			continue
+		}
+		if len(record) != 3 {
+			return nil, fmt.Errorf("%s:%d: %d fields (expected login_name,password,nickname)", path, line, len(record))
+		}
+		loginName, password, nickname := record[0], record[1], record[2]
+		if loginName == "" || password == "" || nickname == "" {
+			return nil, fmt.Errorf("%s:%d: empty login_name, password or nickname", path, line)
+		}
+		if first, found := lines[loginName]; found {
+			return nil, fmt.Errorf("%s:%d: duplicate login_name %q (first at line %d)", path, line, loginName, first)
+		}
+		lines[loginName] = line
+
+		users = append(users, &AppUser{
+			ID:        uint(len(users) + 1),
+			LoginName: loginName,
+			Password:  password,
+			Nickname:  nickname,
+		})
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%s: no users", path)
+	}
+	return users, nil
+}
+
+// Replaces DataSet.Users with the users of UsersPath. The users of user.tsv are all left to sign up
+// then, except the ones whose login name is taken by a user of the CSV.
+func loadCustomUsers() {
+	users, err := readUsersCSV(UsersPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	taken := make(map[string]bool, len(users))
+	for _, u := range users {
+		taken[u.LoginName] = true
+	}
+	newUsers := make([]*AppUser, 0, len(DataSet.Users)+len(DataSet.NewUsers))
+	for _, u := range append(DataSet.Users, DataSet.NewUsers...) {
+		if taken[u.LoginName] {
+			continue
+		}
+		u.ID = 0 // auto increment
+		newUsers = append(newUsers, u)
+	}
+	log.Printf("debug: loaded %d users from %s (%d users left to sign up)\n", len(users), UsersPath, len(newUsers))
+
+	DataSet.Users = users
+	DataSet.NewUsers = newUsers
+}
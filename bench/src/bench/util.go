@@ -2,7 +2,9 @@ package bench
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"math/rand"
 	"runtime"
 	"strings"
@@ -52,6 +54,24 @@ func PutBuffer(buf *bytes.Buffer) {
 	bytesBufferPool.Put(buf)
 }
 
+// Decodes the gzip encoded buf into a buffer taken from the pool. Truncated or corrupted
+// streams are reported as errors since gzip.Reader verifies the size and the checksum at EOF.
+func gunzipBuffer(buf *bytes.Buffer) (*bytes.Buffer, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	decoded := GetBuffer()
+	_, err = io.Copy(decoded, zr)
+	if err != nil {
+		PutBuffer(decoded)
+		return nil, err
+	}
+	return decoded, nil
+}
+
 func JoinCrc32(crcSum []byte) uint32 {
 	return uint32(crcSum[0])<<24 | uint32(crcSum[1])<<16 | uint32(crcSum[2])<<8 | uint32(crcSum[3])
 }
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"bench"
+	"bench/counter"
+	"bench/parameter"
+)
+
+// Distributed benchmarking: a coordinator (-agents) runs the benchmark as usual and asks agents
+// (-agent-listen) on other machines to add load against the same target at the same time.
+// Agents only run load scenarios whose checks do not depend on the state of the coordinator,
+// and their counters are merged into the coordinator's before the score is calculated.
+// Agents require the shared -agent-token on every request, and only load their own -remotes.
+var (
+	agentListen string
+	agents      string
+	agentToken  string
+)
+
+type agentRunRequest struct {
+	Remotes      []string      `json:"remotes"`
+	HostStrategy string        `json:"host_strategy"`
+	Duration     time.Duration `json:"duration"`
+}
+
+type agentRunResponse struct {
+	Hostname  string              `json:"hostname"`
+	LoadLevel int64               `json:"load_level"`
+	Counters  []counter.Count     `json:"counters"`
+	Errors    []bench.ErrorDetail `json:"errors"`
+}
+
+func registerAgentFuncs() {
+	addLoadFunc(10, benchFunc{"LoadAdminTopPage", bench.LoadAdminTopPage})
+	addLoadAndLevelUpFunc(30, benchFunc{"LoadTopPage", bench.LoadTopPage})
+}
+
+// Returns the remote of req which is not in allowed, the -remotes of the agent, or "" if there is none
+func disallowedAgentRemote(req *agentRunRequest, allowed []string) string {
+	for _, remote := range req.Remotes {
+		target := remote
+		if i := strings.LastIndex(remote, "="); i >= 0 {
+			target = remote[:i] // without the weight
+		}
+		found := false
+		for _, a := range allowed {
+			if strings.TrimSpace(a) == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return remote
+		}
+	}
+	return ""
+}
+
+// Serves a single run requested by the coordinator and exits after responding
+func runAgentMode(listen string, allowed []string) {
+	if agentToken == "" {
+		log.Fatalln("-agent-listen requires -agent-token")
+	}
+	updateHostname()
+
+	done := make(chan struct{})
+	var once sync.Once
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(agentToken)) != 1 {
+			log.Println("warn: rejected a run request without the agent token from", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		req := new(agentRunRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(req.Remotes) == 0 {
+			http.Error(w, "no remotes", http.StatusBadRequest)
+			return
+		}
+		if remote := disallowedAgentRemote(req, allowed); remote != "" {
+			log.Println("warn: rejected a run request against", remote, "from", r.RemoteAddr)
+			http.Error(w, fmt.Sprintf("remote %s is not allowed by -remotes of the agent", remote), http.StatusForbidden)
+			return
+		}
+
+		ran := false
+		once.Do(func() {
+			ran = true
+			res, err := runAgent(r.Context(), req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(res)
+			}
+			close(done)
+		})
+		if !ran {
+			http.Error(w, "already running", http.StatusConflict)
+		}
+	})
+
+	server := &http.Server{Addr: listen, Handler: mux}
+	go func() {
+		<-done
+		server.Shutdown(context.Background())
+	}()
+
+	log.Println("Waiting for the coordinator on", listen)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalln(err)
+	}
+}
+
+func runAgent(ctx context.Context, req *agentRunRequest) (*agentRunResponse, error) {
+	log.Println("Agent run requested. Remotes", req.Remotes, "Duration", req.Duration)
+
+	if err := bench.SetTargetHosts(req.Remotes); err != nil {
+		return nil, err
+	}
+	if err := bench.SetHostStrategy(req.HostStrategy); err != nil {
+		return nil, err
+	}
+
+	registerAgentFuncs()
+	state := new(bench.State)
+	state.Init()
+
+	ctx, cancel := context.WithTimeout(ctx, req.Duration)
+	defer cancel()
+
+	go loadMain(ctx, state)
+	<-ctx.Done()
+	time.Sleep(parameter.AllowableDelay)
+
+	printCounterSummary()
+
+	res := &agentRunResponse{
+		Hostname:  hostname,
+		LoadLevel: counter.Get(loadLevelUpKey),
+		Counters:  counter.Snapshot().List(),
+	}
+	res.Errors = bench.GetCheckerErrorDetails()
+	return res, nil
+}
+
+// Starts the load on every agent and returns a channel which receives their results once they finish
+func startAgents(ctx context.Context, remoteAddrs []string, duration time.Duration) <-chan []*agentRunResponse {
+	ch := make(chan []*agentRunResponse, 1)
+
+	addrs := strings.Split(agents, ",")
+	results := make([]*agentRunResponse, len(addrs))
+
+	body, _ := json.Marshal(&agentRunRequest{
+		Remotes:      remoteAddrs,
+		HostStrategy: bench.HostStrategy,
+		Duration:     duration,
+	})
+
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			res, err := requestAgentRun(ctx, addr, body)
+			if err != nil {
+				log.Println("warn: agent", addr, err)
+				return
+			}
+			results[i] = res
+		}(i, strings.TrimSpace(addr))
+	}
+
+	go func() {
+		wg.Wait()
+		var rs []*agentRunResponse
+		for _, r := range results {
+			if r != nil {
+				rs = append(rs, r)
+			}
+		}
+		ch <- rs
+	}()
+
+	return ch
+}
+
+func requestAgentRun(ctx context.Context, addr string, body []byte) (*agentRunResponse, error) {
+	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/run", addr), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+agentToken)
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", res.Status)
+	}
+
+	r := new(agentRunResponse)
+	if err := json.NewDecoder(res.Body).Decode(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Adds the counters of the agents to ours and returns their errors prefixed with the agent hostname
+func mergeAgentResults(results []*agentRunResponse) (errors []bench.ErrorDetail) {
+	for _, r := range results {
+		for _, c := range r.Counters {
+			// the load level is our own
+			if strings.HasPrefix(c.Name, "load-level-") {
+				continue
+			}
+			counter.Add(c.Key, int(c.Value))
+		}
+		for _, e := range r.Errors {
+			e.Agent = r.Hostname
+			e.Message = fmt.Sprintf("[agent %s] %s", r.Hostname, e.Message)
+			errors = append(errors, e)
+		}
+
+		now := time.Now().Format("01/02 15:04:05")
+		appendLoadLog(bench.Msgf("%v エージェント %s の負荷走行結果を合算しました。(負荷レベル %d, エラー %d件)", now, r.Hostname, r.LoadLevel, len(r.Errors)))
+		log.Println("Merged agent result", r.Hostname, "load level", r.LoadLevel, "errors", len(r.Errors))
+	}
+	return errors
+}
@@ -1,3 +1,6 @@
+// rand.Seed is a no-op since Go 1.24 unless randseednop=0, and -seed relies on it
+//go:debug randseednop=0
+
 package main
 
 import (
@@ -9,41 +12,76 @@ import (
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"bench"
 	"bench/counter"
 	"bench/parameter"
-
-	"github.com/comail/colog"
 )
 
 var (
-	benchDuration    time.Duration = time.Minute
-	preTestOnly      bool
-	noLevelup        bool
-	checkFuncs       []benchFunc // also preTestFuncs
-	everyCheckFuncs  []benchFunc
-	loadFuncs        []benchFunc
-	loadLevelUpFuncs []benchFunc
-	postTestFuncs    []benchFunc
-	loadLogs         []string
+	benchDuration      time.Duration = time.Minute
+	warmupDuration     time.Duration
+	ramp               *rampProfile
+	sessionWeight      int
+	adminWeight        int
+	churnWeight        int
+	chaosWeight        int
+	reportStreamWeight int
+	herdWeight         int
+	cancelRaceWeight   int
+	mobileChecks       bool
+	preTestOnly        bool
+	noLevelup          bool
+	shedAfter          time.Duration
+	checkFuncs         []benchFunc // also preTestFuncs
+	everyCheckFuncs    []benchFunc
+	loadFuncs          []benchFunc
+	loadLevelUpFuncs   []benchFunc
+	postTestFuncs      []benchFunc
+	loadLogs           []string
 
 	pprofPort int = 16060
 )
 
+// Exit codes of the benchmarker
+const (
+	exitOK                = 0
+	exitFail              = 1 // finished but did not pass, or aborted
+	exitInitializeFailure = 2
+	exitPreTestFailure    = 3
+	exitFatalCheckerError = 4 // fatal checker error during the load
+	exitPortalUnreachable = 5 // workermode only
+	exitSLAViolation      = 6
+)
+
 type benchFunc struct {
 	Name string
 	Func func(ctx context.Context, state *bench.State) error
 }
 
+// Runs the scenario in its own span when tracing is enabled, and records it in the scenario stats
+func (f benchFunc) Run(ctx context.Context, state *bench.State) error {
+	ctx, span := bench.StartSpan(ctx, f.Name)
+	startAt := time.Now()
+	err := f.Func(ctx, state)
+	bench.RecordScenarioRun(ctx, f.Name, time.Since(startAt), err)
+	span.End(err)
+	return err
+}
+
 func addCheckFunc(f benchFunc) {
 	checkFuncs = append(checkFuncs, f)
 }
@@ -69,10 +107,11 @@ func addPostTestFunc(f benchFunc) {
 	postTestFuncs = append(postTestFuncs, f)
 }
 
-func requestInitialize(targetHost string) error {
-	u, _ := url.Parse("/initialize")
-	u.Scheme = "http"
-	u.Host = targetHost
+func requestInitialize(targetURL string) error {
+	u, err := url.Parse(targetURL + "/initialize")
+	if err != nil {
+		return err
+	}
 
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
@@ -83,7 +122,8 @@ func requestInitialize(targetHost string) error {
 	req.Host = bench.TorbAppHost
 
 	client := &http.Client{
-		Timeout: bench.InitializeTimeout,
+		Transport: bench.NewTransport(),
+		Timeout:   bench.InitializeTimeout,
 	}
 
 	res, err := client.Do(req)
@@ -104,16 +144,74 @@ func requestInitialize(targetHost string) error {
 	return nil
 }
 
+// Fails fast on remotes whose host name can not be resolved, instead of failing every request of the run
+func resolveRemotes(hosts []string) error {
+	for _, hostport := range hosts {
+		if path, ok := bench.GetUnixSocket(hostport); ok {
+			log.Println("debug: remote", hostport, "is the unix domain socket", path)
+			continue
+		}
+		host, _, err := net.SplitHostPort(hostport)
+		if err != nil {
+			// the port is optional for host:port remotes
+			host = hostport
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), parameter.RemoteResolveTimeout)
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to resolve remote %s: %v", hostport, err)
+		}
+		log.Println("debug: resolved remote", hostport, addrs)
+	}
+	return nil
+}
+
+// Calls requestInitialize until it succeeds, up to InitializeAttempts times within InitializeDeadline.
+// Every attempt is recorded in loadLogs.
+func requestInitializeWithRetry(ctx context.Context, targetURL string) error {
+	deadline := time.Now().Add(parameter.InitializeDeadline)
+	backoff := parameter.InitializeBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		t := time.Now()
+		err = requestInitialize(targetURL)
+		now := t.Format("01/02 15:04:05")
+		if err == nil {
+			appendLoadLog(bench.Msgf("%v /initialize に成功しました。(%d回目, %v)", now, attempt, time.Since(t)))
+			return nil
+		}
+		appendLoadLog(bench.Msgf("%v /initialize に失敗しました。(%d回目, %v) %v", now, attempt, time.Since(t), err))
+		log.Println("requestInitialize() failed", attempt, err)
+
+		if attempt >= parameter.InitializeAttempts || time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+	}
+}
+
 // 負荷を掛ける前にアプリが最低限動作しているかをチェックする
 // エラーが発生したら負荷をかけずに終了する
+// The checks run in the order of their dependencies and share one set of fixtures.
 func preTest(ctx context.Context, state *bench.State) error {
+	ctx = bench.WithFixtures(ctx, bench.NewFixtures())
 	funcs := make([]benchFunc, len(checkFuncs)+len(everyCheckFuncs))
 	copy(funcs, checkFuncs)
 	copy(funcs[len(checkFuncs):], everyCheckFuncs)
 	for _, checkFunc := range funcs {
 		t := time.Now()
-		err := checkFunc.Func(ctx, state)
+		errorsBefore := len(bench.GetCheckerErrors())
+		err := checkFunc.Run(ctx, state)
 		log.Println("preTest:", checkFunc.Name, time.Since(t))
+		recordPreTestResult(checkFunc.Name, time.Since(t), err, errorsBefore)
 		if err != nil {
 			return err
 		}
@@ -125,7 +223,7 @@ func preTest(ctx context.Context, state *bench.State) error {
 func postTest(ctx context.Context, state *bench.State) error {
 	for _, postTestFunc := range postTestFuncs {
 		t := time.Now()
-		err := postTestFunc.Func(ctx, state)
+		err := postTestFunc.Run(ctx, state)
 		log.Println("postTest:", postTestFunc.Name, time.Since(t))
 		if err != nil {
 			return err
@@ -136,6 +234,28 @@ func postTest(ctx context.Context, state *bench.State) error {
 }
 
 func checkMain(ctx context.Context, state *bench.State) error {
+	// The check workers are stopped and waited for on return
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	round := newCheckRound(checkFuncs)
+	checkErr := make(chan error, parameter.CheckWorkers)
+	for i := 0; i < parameter.CheckWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runCheckWorker(ctx, state, round); err != nil {
+				checkErr <- err
+			}
+		}()
+	}
+
+	// DeepCheck runs in its own goroutine since it takes longer than the other checks
+	deepCheckErr := make(chan error, 1)
+	go watchDeepCheck(ctx, state, deepCheckErr)
+
 	// Inserts CheckEventReport and CheckReport on every the specified interval
 	checkEventReportTicker := time.NewTicker(parameter.CheckEventReportInterval)
 	defer checkEventReportTicker.Stop()
@@ -144,18 +264,6 @@ func checkMain(ctx context.Context, state *bench.State) error {
 	everyCheckerTicker := time.NewTicker(parameter.EveryCheckerInterval)
 	defer everyCheckerTicker.Stop()
 
-	randCheckFuncIndices := []int{}
-	popRandomPermCheckFunc := func() benchFunc {
-		n := len(randCheckFuncIndices)
-		if n == 0 {
-			randCheckFuncIndices = rand.Perm(len(checkFuncs))
-			n = len(randCheckFuncIndices)
-		}
-		i := randCheckFuncIndices[n-1]
-		randCheckFuncIndices = randCheckFuncIndices[:n-1]
-		return checkFuncs[i]
-	}
-
 	for {
 		select {
 		case <-checkEventReportTicker.C:
@@ -163,7 +271,7 @@ func checkMain(ctx context.Context, state *bench.State) error {
 				return nil
 			}
 			t := time.Now()
-			err := bench.CheckEventReport(ctx, state)
+			err := benchFunc{"CheckEventReport", bench.CheckEventReport}.Run(ctx, state)
 			log.Println("checkMain(checkEventReport): CheckEventReport", time.Since(t))
 
 			// fatalError以外は見逃してあげる
@@ -175,17 +283,21 @@ func checkMain(ctx context.Context, state *bench.State) error {
 				return nil
 			}
 			t := time.Now()
-			err := bench.CheckReport(ctx, state)
+			err := benchFunc{"CheckReport", bench.CheckReport}.Run(ctx, state)
 			log.Println("checkMain(checkReport): CheckReport", time.Since(t))
 
 			// fatalError以外は見逃してあげる
 			if err != nil && bench.IsFatal(err) {
 				return err
 			}
+		case err := <-deepCheckErr:
+			return err
+		case err := <-checkErr:
+			return err
 		case <-everyCheckerTicker.C:
 			for _, checkFunc := range everyCheckFuncs {
 				t := time.Now()
-				err := checkFunc.Func(ctx, state)
+				err := checkFunc.Run(ctx, state)
 				log.Println("checkMain(every):", checkFunc.Name, time.Since(t))
 
 				// fatalError以外は見逃してあげる
@@ -201,31 +313,40 @@ func checkMain(ctx context.Context, state *bench.State) error {
 		case <-ctx.Done():
 			// benchmarker timeout
 			return nil
-		default:
-			if ctx.Err() != nil {
-				return nil
-			}
+		}
+	}
+}
 
-			// Sequentially runs the check functions in randomly permuted order
-			checkFunc := popRandomPermCheckFunc()
-			t := time.Now()
-			err := checkFunc.Func(ctx, state)
-			log.Println("checkMain:", checkFunc.Name, time.Since(t))
+// Runs the checks of round until ctx is done. Returns the first fatal error.
+func runCheckWorker(ctx context.Context, state *bench.State, round *checkRound) error {
+	for {
+		checkFunc, fixtures, ok := round.next(ctx)
+		if !ok {
+			return nil
+		}
+		t := time.Now()
+		err := checkFunc.Run(bench.WithFixtures(ctx, fixtures), state)
+		round.finish(checkFunc, err)
+		log.Println("checkMain:", checkFunc.Name, time.Since(t))
 
-			// fatalError以外は見逃してあげる
-			if err != nil && bench.IsFatal(err) {
-				return err
-			}
+		// fatalError以外は見逃してあげる
+		if err != nil && bench.IsFatal(err) {
+			return err
+		}
 
-			if err != nil {
-				// バリデーションシナリオを悪用してスコアブーストさせないためエラーのときは少し待つ
-				time.Sleep(parameter.WaitOnError)
-			}
+		if err != nil {
+			// バリデーションシナリオを悪用してスコアブーストさせないためエラーのときは少し待つ
+			time.Sleep(parameter.WaitOnError)
 		}
 	}
 }
 
-func goLoadFuncs(ctx context.Context, state *bench.State, n int) {
+func goLoadFuncs(ctx context.Context, state *bench.State, n int) int {
+	n = acquireWorkers(n)
+	if n == 0 {
+		return 0
+	}
+
 	sumWait := (n - 1) * n / 2
 	waits := rand.Perm(n)
 
@@ -237,6 +358,8 @@ func goLoadFuncs(ctx context.Context, state *bench.State, n int) {
 		sumDelay += delay
 
 		go func() {
+			defer releaseWorker()
+			ctx := bench.WithThinkTime(ctx)
 			for {
 				if ctx.Err() != nil {
 					return
@@ -244,7 +367,7 @@ func goLoadFuncs(ctx context.Context, state *bench.State, n int) {
 
 				loadFunc := loadFuncs[rand.Intn(len(loadFuncs))]
 				t := time.Now()
-				err := loadFunc.Func(ctx, state)
+				err := loadFunc.Run(ctx, state)
 				log.Println("debug: loadFunc:", loadFunc.Name, time.Since(t))
 
 				if err != nil {
@@ -257,9 +380,17 @@ func goLoadFuncs(ctx context.Context, state *bench.State, n int) {
 		}()
 	}
 	log.Println("debug: goLoadLevelUpFuncs wait totally", sumDelay)
+	return n
 }
 
-func goLoadLevelUpFuncs(ctx context.Context, state *bench.State, n int) {
+// Workers stop after their current scenario when stop is closed, so that the load can be shed
+// without aborting in-flight requests.
+func goLoadLevelUpFuncs(ctx context.Context, state *bench.State, n int, stop <-chan struct{}) int {
+	n = acquireWorkers(n)
+	if n == 0 {
+		return 0
+	}
+
 	sumWait := (n - 1) * n / 2
 	waits := rand.Perm(n)
 
@@ -271,14 +402,21 @@ func goLoadLevelUpFuncs(ctx context.Context, state *bench.State, n int) {
 		sumDelay += delay
 
 		go func() {
+			defer releaseWorker()
+			ctx := bench.WithThinkTime(ctx)
 			for {
 				if ctx.Err() != nil {
 					return
 				}
+				select {
+				case <-stop:
+					return
+				default:
+				}
 
 				loadFunc := loadLevelUpFuncs[rand.Intn(len(loadLevelUpFuncs))]
 				t := time.Now()
-				err := loadFunc.Func(ctx, state)
+				err := loadFunc.Run(ctx, state)
 				log.Println("debug: levelUpFunc:", loadFunc.Name, time.Since(t))
 
 				if err != nil {
@@ -291,13 +429,48 @@ func goLoadLevelUpFuncs(ctx context.Context, state *bench.State, n int) {
 		}()
 	}
 	log.Println("debug: goLoadLevelUpFuncs wait totally", sumDelay)
+	return n
+}
+
+// Runs load scenarios for warmupDuration so that connection establishment and cold caches on
+// the target do not skew the score of short runs. Counters and stats are reset when the warm-up
+// ends, and errors of the warm-up are not collected.
+func warmUp(ctx context.Context, state *bench.State) {
+	warmupCtx, cancel := context.WithTimeout(ctx, warmupDuration)
+	defer cancel()
+
+	bench.GuardCheckerError(true)
+	goLoadFuncs(warmupCtx, state, int(parameter.LoadInitialNumGoroutines))
+	<-warmupCtx.Done()
+	// let the requests canceled at the end of the warm-up fail while the errors are guarded
+	time.Sleep(parameter.AllowableDelay)
+
+	counter.Reset()
+	bench.ResetEndpointStats()
+	bench.ResetHostStats()
+	bench.ResetScenarioStats()
+	bench.ResetSlowPaths()
+	bench.GuardCheckerError(false)
+	appendLoadLog(bench.Msgf("%v ウォームアップが終了しました。", time.Now().Format("01/02 15:04:05")))
+}
+
+// Level-up workers started at once. The last one is stopped first when the load is shed
+type loadBatch struct {
+	level int64
+	n     int
+	stop  chan struct{}
 }
 
 func loadMain(ctx context.Context, state *bench.State) {
-	levelUpRatio := parameter.LoadLevelUpRatio
-	numGoroutines := parameter.LoadInitialNumGoroutines
+	numGoroutines := ramp.Initial
+	loadStartAt := time.Now()
+
+	var batches []loadBatch
+	var troubleSince time.Time
 
-	goLoadFuncs(ctx, state, int(numGoroutines))
+	numGoroutines = float64(goLoadFuncs(ctx, state, int(numGoroutines)))
+
+	go runScoreTimeline(ctx, loadStartAt)
 
 	levelUpTicker := time.NewTicker(parameter.LoadLevelUpInterval)
 	defer levelUpTicker.Stop()
@@ -305,32 +478,58 @@ func loadMain(ctx context.Context, state *bench.State) {
 	for {
 		select {
 		case <-levelUpTicker.C:
-			log.Printf("debug: loadLevel:%d numGoroutines:%d runtime.NumGoroutines():%d\n", counter.GetKey("load-level-up"), int(numGoroutines), runtime.NumGoroutine())
+			sampleReservations(state, loadStartAt)
+			sampleLoadLevel(loadStartAt, numGoroutines)
+			log.Printf("debug: loadLevel:%d numGoroutines:%d runtime.NumGoroutines():%d\n", counter.Get(loadLevelUpKey), int(numGoroutines), runtime.NumGoroutine())
 			if noLevelup {
 				continue
 			}
 
-			e, et := bench.GetLastCheckerError()
-			hasRecentErr := e != nil && time.Since(et) < 5*time.Second
-
-			path, st := bench.GetLastSlowPath()
-			hasRecentSlowPath := path != "" && time.Since(st) < 5*time.Second
+			errs, slows := getLevelUpBlockers()
+			hasRecentErr := len(errs) > 0
+			hasRecentSlowPath := len(slows) > 0
 
 			now := time.Now().Format("01/02 15:04:05")
 
+			if !hasRecentErr && !hasRecentSlowPath {
+				troubleSince = time.Time{}
+			} else if troubleSince.IsZero() {
+				troubleSince = time.Now()
+			} else if shedAfter > 0 && time.Since(troubleSince) >= shedAfter && len(batches) > 0 {
+				batch := batches[len(batches)-1]
+				batches = batches[:len(batches)-1]
+				close(batch.stop)
+				numGoroutines -= float64(batch.n)
+				counter.Add(loadLevelUpKey, int(batch.level-1-counter.Get(loadLevelUpKey)))
+				counter.Inc(loadLevelDownKey)
+				troubleSince = time.Now()
+
+				appendLoadLog(bench.Msgf("%v エラーまたは遅いレスポンスが%v秒以上続いたため負荷レベルを下げました。", now, shedAfter.Seconds()))
+				log.Println("Decrease Load Level", counter.Get(loadLevelUpKey), "stopped goroutines:", batch.n)
+				continue
+			}
+
 			if hasRecentErr {
-				loadLogs = append(loadLogs, fmt.Sprintf("%v エラーが発生したため負荷レベルを上げられませんでした。%v", now, e))
-				log.Println("Cannot increase Load Level. Reason: RecentErr", e, "Before", time.Since(et))
+				appendLoadLog(bench.Msgf("%v エラーが発生したため負荷レベルを上げられませんでした。%v", now, strings.Join(errs, ", ")))
+				log.Println("Cannot increase Load Level. Reason: ErrorRate", strings.Join(errs, ", "))
 			} else if hasRecentSlowPath {
-				loadLogs = append(loadLogs, fmt.Sprintf("%v レスポンスが遅いため負荷レベルを上げられませんでした。%v", now, path))
-				log.Println("Cannot increase Load Level. Reason: SlowPath", path, "Before", time.Since(st))
+				appendLoadLog(bench.Msgf("%v レスポンスが遅いため負荷レベルを上げられませんでした。%v", now, strings.Join(slows, ", ")))
+				log.Println("Cannot increase Load Level. Reason: SlowPath", strings.Join(slows, ", "))
+			} else if reason, saturated := getRecentSaturation(parameter.LoadLevelUpLookback); saturated {
+				appendLoadLog(bench.Msgf("%v ベンチマーカーのリソースが不足しているため負荷レベルを上げられませんでした。%v", now, reason))
+				log.Println("Cannot increase Load Level. Reason: BenchSaturated", reason)
 			} else {
-				loadLogs = append(loadLogs, fmt.Sprintf("%v 負荷レベルが上昇しました。", now))
-				counter.IncKey("load-level-up")
-				nextNumGoroutines := numGoroutines * levelUpRatio
-				log.Println("Increase Load Level", counter.GetKey("load-level-up"))
-				goLoadLevelUpFuncs(ctx, state, int(nextNumGoroutines-numGoroutines))
-				numGoroutines = nextNumGoroutines
+				appendLoadLog(bench.Msgf("%v 負荷レベルが上昇しました。", now))
+				counter.Inc(loadLevelUpKey)
+				level := counter.Get(loadLevelUpKey)
+				nextNumGoroutines := ramp.Next(int(level), numGoroutines)
+				log.Println("Increase Load Level", level)
+				if nextNumGoroutines > numGoroutines {
+					stop := make(chan struct{})
+					n := goLoadLevelUpFuncs(ctx, state, int(nextNumGoroutines-numGoroutines), stop)
+					numGoroutines += float64(n)
+					batches = append(batches, loadBatch{level, n, stop})
+				}
 			}
 		case <-ctx.Done():
 			// ベンチ終了、このタイミングでエラーの収集をやめる。
@@ -340,245 +539,763 @@ func loadMain(ctx context.Context, state *bench.State) {
 	}
 }
 
+type counterSummary struct {
+	Key   string
+	Value int64
+}
+
+var (
+	loadLevelUpKey   = counter.Key{Name: "load-level-up"}
+	loadLevelDownKey = counter.Key{Name: "load-level-down"}
+)
+
+// Sums the counters by endpoint. Request counts (METHOD|path) and other counts are returned separately.
+func summarizeCounters() (requests []counterSummary, others []counterSummary) {
+	// requests of any status, and of any device which summarizeDevices splits them by
+	m := counter.GroupBy(counter.Key{}, func(k counter.Key) counter.Key {
+		switch k.Name {
+		case counter.NameRequest:
+			k.Status = ""
+			k.Labels = ""
+		case counter.NameStaticFile:
+			k.Labels = counter.Labels("status", k.Label("status"))
+		}
+		return k
+	})
+
+	for key, count := range m {
+		switch key.Name {
+		case counter.NamePhaseUs, counter.NamePhaseN:
+			// summarized by summarizePhases
+		case counter.NameConn:
+			// summarized by summarizeConnReuse
+		case counter.NameRequest:
+			requests = append(requests, counterSummary{key.String(), count})
+		default:
+			others = append(others, counterSummary{key.String(), count})
+		}
+	}
+
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Value > requests[j].Value })
+	sort.Slice(others, func(i, j int) bool { return others[i].Value > others[j].Value })
+	return
+}
+
 func printCounterSummary() {
-	m := map[string]int64{}
+	requests, others := summarizeCounters()
 
-	for key, count := range counter.GetMap() {
-		if strings.HasPrefix(key, "GET|/api/events/") {
-			key = "GET|/api/events/*"
-		} else if strings.HasPrefix(key, "POST|/api/events/") {
-			key = "POST|/api/events/*/actions/reserve"
-		} else if strings.HasPrefix(key, "DELETE|/api/events/") {
-			key = "DELETE|/api/events/*/sheets/*/*/reservation"
-		} else if strings.HasPrefix(key, "GET|/admin/api/events/") {
-			key = "GET|/admin/api/events/*"
-		} else if strings.HasPrefix(key, "GET|/api/users/") {
-			key = "GET|/api/users/*"
-		} else if strings.HasPrefix(key, "POST|/admin/api/events/") {
-			key = "POST|/admin/api/events/*/actions/edit"
-		} else if strings.HasPrefix(key, "GET|/admin/api/reports/events/") {
-			key = "GET|/admin/api/reports/events/*/sales"
+	log.Println("----- Request counts -----")
+	for _, kv := range requests {
+		log.Println(kv.Key, kv.Value)
+	}
+	log.Println("----- Other counts ------")
+	for _, kv := range others {
+		log.Println(kv.Key, kv.Value)
+	}
+	log.Println("----- Request phases (avg ms) -----")
+	for _, p := range summarizePhases() {
+		log.Println(p)
+	}
+	log.Println("----- Scenarios (ok/failed/aborted/skipped, mean/p95 ms) -----")
+	for _, s := range bench.GetScenarioStats() {
+		log.Printf("%s %d/%d/%d/%d %.1f/%.1f", s.Name, s.Succeeded, s.Failed, s.Aborted, s.Skipped, s.MeanMs, s.P95Ms)
+	}
+	if devices := summarizeDevices(counter.Snapshot()); len(devices) > 1 {
+		log.Println("----- Devices (requests, score) -----")
+		for _, d := range devices {
+			log.Printf("%s %d %d", d.Device, d.Requests, d.Score)
 		}
+	}
+	if hosts := bench.GetHostStats(); len(hosts) > 1 {
+		log.Println("----- Hosts (requests/errors, mean/p95 ms) -----")
+		for _, h := range hosts {
+			log.Printf("%s %d/%d %.1f/%.1f", h.Host, h.Requests, h.Errors, h.MeanMs, h.P95Ms)
+		}
+	}
+	log.Println("----- Connection reuse -----")
+	for _, c := range summarizeConnReuse() {
+		log.Printf("%s reused=%d new=%d ratio=%.2f%%", c.Host, c.Reused, c.New, c.Ratio*100)
+	}
+	log.Println("-------------------------")
+}
 
-		m[key] += count
+// The stats per host are in the result only if there are several remotes
+func getHostStats() []bench.HostStat {
+	if hosts := bench.GetHostStats(); len(hosts) > 1 {
+		return hosts
 	}
+	return nil
+}
+
+type connReuseSummary struct {
+	Host   string  `json:"host"`
+	Reused int64   `json:"reused"`
+	New    int64   `json:"new"`
+	Ratio  float64 `json:"ratio"` // reused / (reused + new)
+}
 
-	type p struct {
-		Key   string
-		Value int64
+// Aggregates the NameConn counters per host
+func summarizeConnReuse() []connReuseSummary {
+	m := map[string]*connReuseSummary{}
+	for key, value := range counter.GroupBy(counter.Key{Name: counter.NameConn}, func(k counter.Key) counter.Key { return k }) {
+		host := key.Label("host")
+		c := m[host]
+		if c == nil {
+			c = &connReuseSummary{Host: host}
+			m[host] = c
+		}
+		if key.Label("reused") == "true" {
+			c.Reused += value
+		} else {
+			c.New += value
+		}
 	}
-	var s []p
 
-	for key, count := range m {
-		s = append(s, p{key, count})
+	var summaries []connReuseSummary
+	for _, c := range m {
+		c.Ratio = float64(c.Reused) / float64(c.Reused+c.New)
+		summaries = append(summaries, *c)
 	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Host < summaries[j].Host })
+	return summaries
+}
 
-	sort.Slice(s, func(i, j int) bool { return s[i].Value > s[j].Value })
+type phaseSummary struct {
+	Endpoint string             `json:"endpoint"`
+	Count    int64              `json:"count"`  // requests whose body was read
+	AvgMs    map[string]float64 `json:"avg_ms"` // average per phase, only over the requests in which the phase happened
+	Counts   map[string]int64   `json:"counts"` // requests in which the phase happened
+}
 
-	log.Println("----- Request counts -----")
-	for _, kv := range s {
-		if strings.HasPrefix(kv.Key, "GET|") || strings.HasPrefix(kv.Key, "POST|") || strings.HasPrefix(kv.Key, "DELETE|") {
-			log.Println(kv.Key, kv.Value)
+func (p phaseSummary) String() string {
+	s := fmt.Sprintf("%s n=%d", p.Endpoint, p.Count)
+	for _, phase := range bench.RequestPhases {
+		if n := p.Counts[phase]; n > 0 {
+			s += fmt.Sprintf(" %s=%.2f", phase, p.AvgMs[phase])
+			if n != p.Count {
+				s += fmt.Sprintf("(n=%d)", n)
+			}
 		}
 	}
-	log.Println("----- Other counts ------")
-	for _, kv := range s {
-		if strings.HasPrefix(kv.Key, "GET|") || strings.HasPrefix(kv.Key, "POST|") || strings.HasPrefix(kv.Key, "DELETE|") {
-		} else {
-			log.Println(kv.Key, kv.Value)
+	return s
+}
+
+// Aggregates the NamePhaseUs and NamePhaseN counters per endpoint
+func summarizePhases() []phaseSummary {
+	sums := map[string]map[string]int64{}
+	counts := map[string]map[string]int64{}
+	for key, value := range counter.Snapshot().Map() {
+		if key.Name != counter.NamePhaseUs && key.Name != counter.NamePhaseN {
+			continue
 		}
+		endpoint := key.Method + "|" + key.Path
+		m := sums
+		if key.Name == counter.NamePhaseN {
+			m = counts
+		}
+		if m[endpoint] == nil {
+			m[endpoint] = map[string]int64{}
+		}
+		m[endpoint][key.Label("phase")] += value
 	}
-	log.Println("-------------------------")
+
+	var summaries []phaseSummary
+	for endpoint, c := range counts {
+		p := phaseSummary{Endpoint: endpoint, Count: c["body"], AvgMs: map[string]float64{}, Counts: c}
+		for phase, n := range c {
+			p.AvgMs[phase] = float64(sums[endpoint][phase]) / float64(n) / 1000
+		}
+		summaries = append(summaries, p)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Count > summaries[j].Count })
+	return summaries
 }
 
-func startBenchmark(remoteAddrs []string) *BenchResult {
-	addLoadFunc(10, benchFunc{"LoadCreateUser", bench.LoadCreateUser})
-	addLoadFunc(10, benchFunc{"LoadMyPage", bench.LoadMyPage})
-	addLoadFunc(10, benchFunc{"LoadEventReport", bench.LoadEventReport})
-	addLoadFunc(10, benchFunc{"LoadAdminTopPage", bench.LoadAdminTopPage})
-	addLoadFunc(1, benchFunc{"LoadReport", bench.LoadReport})
-	addLoadAndLevelUpFunc(30, benchFunc{"LoadTopPage", bench.LoadTopPage})
-	addLoadAndLevelUpFunc(10, benchFunc{"LoadReserveCancelSheet", bench.LoadReserveCancelSheet})
-	addLoadAndLevelUpFunc(20, benchFunc{"LoadReserveSheet", bench.LoadReserveSheet})
-	addLoadAndLevelUpFunc(30, benchFunc{"LoadGetEvent", bench.LoadGetEvent})
-
-	addCheckFunc(benchFunc{"CheckStaticFiles", bench.CheckStaticFiles})
-	addCheckFunc(benchFunc{"CheckCreateUser", bench.CheckCreateUser})
-	addCheckFunc(benchFunc{"CheckLogin", bench.CheckLogin})
-	addCheckFunc(benchFunc{"CheckTopPage", bench.CheckTopPage})
-	addCheckFunc(benchFunc{"CheckAdminTopPage", bench.CheckAdminTopPage})
-	addCheckFunc(benchFunc{"CheckReserveSheet", bench.CheckReserveSheet})
-	addCheckFunc(benchFunc{"CheckAdminLogin", bench.CheckAdminLogin})
-	addCheckFunc(benchFunc{"CheckCreateEvent", bench.CheckCreateEvent})
-	addCheckFunc(benchFunc{"CheckMyPage", bench.CheckMyPage})
-	addCheckFunc(benchFunc{"CheckCancelReserveSheet", bench.CheckCancelReserveSheet})
-	addCheckFunc(benchFunc{"CheckGetEvent", bench.CheckGetEvent})
-
-	addEveryCheckFunc(benchFunc{"CheckSheetReservationEntropy", bench.CheckSheetReservationEntropy})
-
-	addPostTestFunc(benchFunc{"CheckReport", bench.CheckReport})
+// Builds the scenario lists from the scenarios registered in the bench package.
+// The checks are sorted by their dependencies.
+func registerBenchFuncs() {
+	checks, err := bench.SortedChecks()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, s := range checks {
+		addCheckFunc(benchFunc{s.Name, s.Func})
+		checkDependencies[s.Name] = s.After
+	}
+
+	for _, s := range bench.RegisteredScenarios() {
+		f := benchFunc{s.Name, s.Func}
+		switch s.Kind {
+		case bench.ScenarioEveryCheck:
+			addEveryCheckFunc(f)
+		case bench.ScenarioLoad:
+			addLoadFunc(s.Weight, f)
+		case bench.ScenarioLoadAndLevelUp:
+			addLoadAndLevelUpFunc(s.Weight, f)
+		case bench.ScenarioPostTest:
+			addPostTestFunc(f)
+		}
+	}
+	if mobileChecks {
+		addCheckFunc(benchFunc{"CheckMobileAssets", bench.CheckMobileAssets})
+	}
+
+	// the weights are given by -session-weight, -admin-session-weight, -churn-weight, -chaos,
+	// -cancel-race-weight, -herd-weight and -report-stream-weight
+	if sessionWeight > 0 {
+		addLoadAndLevelUpFunc(sessionWeight, benchFunc{"LoadUserSession", bench.LoadUserSession})
+	}
+	if adminWeight > 0 {
+		addLoadFunc(adminWeight, benchFunc{"LoadAdminSession", bench.LoadAdminSession})
+	}
+	if churnWeight > 0 {
+		addLoadAndLevelUpFunc(churnWeight, benchFunc{"LoadReserveCancelChurn", bench.LoadReserveCancelChurn})
+	}
+	if chaosWeight > 0 {
+		addLoadFunc(chaosWeight, benchFunc{"LoadChaos", bench.LoadChaos})
+	}
+	if reportStreamWeight > 0 {
+		addLoadFunc(reportStreamWeight, benchFunc{"LoadReportStream", bench.LoadReportStream})
+	}
+	if herdWeight > 0 {
+		addLoadFunc(herdWeight, benchFunc{"LoadThunderingHerd", bench.LoadThunderingHerd})
+	}
+	if cancelRaceWeight > 0 {
+		addLoadFunc(cancelRaceWeight, benchFunc{"LoadCancelReserveRace", bench.LoadCancelReserveRace})
+	}
+}
+
+type scoreCounts struct {
+	Get      int64 `json:"get"`
+	Post     int64 `json:"post"`
+	Delete   int64 `json:"delete"` // == Cancel
+	Static   int64 `json:"static"`
+	Top      int64 `json:"top"`
+	Reserve  int64 `json:"reserve"`
+	Cancel   int64 `json:"cancel"`
+	GetEvent int64 `json:"get_event"`
+}
+
+// Sums up the request counts used for scoring from a map which has the same keys as counter
+func sumScoreCounts(m map[counter.Key]int64) scoreCounts {
+	var c scoreCounts
+	for key, count := range m {
+		if key.Name == counter.NameStaticFile {
+			if status := key.Label("status"); status == "200" || status == "304" {
+				c.Static += count
+			}
+			continue
+		}
+		if key.Name != counter.NameRequest {
+			continue
+		}
+		switch key.Method + "|" + key.Path {
+		case "GET|/api/events/*":
+			c.GetEvent += count
+		case "POST|/api/events/*/actions/reserve":
+			c.Reserve += count
+		case "DELETE|/api/events/*/sheets/*/*/reservation":
+			c.Cancel += count
+		case "GET|/":
+			c.Top += count
+		}
+		switch key.Method {
+		case "GET":
+			c.Get += count
+		case "POST":
+			c.Post += count
+		case "DELETE":
+			c.Delete += count
+		}
+	}
+	return c
+}
+
+func (c scoreCounts) Score() int64 {
+	return parameter.Score(c.Get, c.Post, c.Delete, c.Static, c.Reserve, c.Cancel, c.Top, c.GetEvent)
+}
+
+// Scores the requests in counts
+func calcScore(counts counter.Counts) int64 {
+	c := sumScoreCounts(counts.Map())
+	score := c.Score()
+
+	log.Println("get", c.Get)
+	log.Println("post", c.Post)
+	log.Println("delete", c.Delete)
+	log.Println("static", c.Static)
+	log.Println("top", c.Top)
+	log.Println("reserve", c.Reserve)
+	log.Println("cancel", c.Cancel)
+	log.Println("get_event", c.GetEvent)
+	log.Println("score", score)
+
+	return score
+}
+
+// Traps SIGINT/SIGTERM and cancels the returned context so that the running benchmark
+// can stop and still report what it has collected so far. A second signal exits immediately.
+func trapSignals() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		log.Println("Received signal", sig, "aborting benchmark")
+		bench.GuardCheckerError(true)
+		cancel()
+
+		sig = <-sigCh
+		log.Println("Received signal", sig, "again, exit immediately")
+		os.Exit(exitFail)
+	}()
+
+	return ctx
+}
+
+func startBenchmark(baseCtx context.Context, remoteAddrs []string) *BenchResult {
+	registerBenchFuncs()
 
 	result := new(BenchResult)
 	result.StartTime = time.Now()
+	result.exitCode = exitFail
+
+	clockCtx, clockCancel := context.WithCancel(baseCtx)
+	go bench.WatchClockJump(clockCtx)
 	defer func() {
+		clockCancel()
 		result.EndTime = time.Now()
+		result.normalizeScore(benchDuration)
+		for _, jump := range bench.GetClockJumps() {
+			result.ClockJumps = append(result.ClockJumps, jump.String())
+		}
 	}()
 
-	getErrorsString := func() []string {
-		var errors []string
-		for _, err := range bench.GetCheckerErrors() {
-			errors = append(errors, err.Error())
+	state := new(bench.State)
+
+	// Returns a partial result if the benchmark was interrupted by a signal or a stop condition
+	abortedResult := func() *BenchResult {
+		printCounterSummary()
+
+		result.Aborted = true
+		counts := counter.Snapshot()
+		result.Score, result.FinalWindow = applyFreezePolicy(calcScore(counts), counts)
+		result.Score, result.ErrorPenalty = applyErrorPenalty(result.Score)
+		result.LoadLevel = int(counter.Get(loadLevelUpKey))
+		result.CancelReserveRatio = realizedCancelReserveRatio(state)
+		result.ReservationTimeline = getReservationSamples()
+		result.ScoreTimeline, result.ScoreBuckets = getScoreTimeline()
+		result.LatencyClasses = getLatencyClassResults()
+		result.Devices = summarizeDevices(counts)
+		result.RequestCounts = getRequestCounts()
+		result.SlowPaths = bench.GetSlowestPaths()
+		result.ThunderingHerd = bench.GetThunderingHerdResult()
+		result.RequestPhases = summarizePhases()
+		result.Scenarios = bench.GetScenarioStats()
+		result.Hosts = getHostStats()
+		result.ConnReuse = summarizeConnReuse()
+		result.BenchBoundReasons = getSaturationReasons()
+		result.BenchBound = len(result.BenchBoundReasons) > 0
+		result.TransferredBytes = counter.Sum(counter.Key{Name: counter.NameBytes})
+		result.setErrors(bench.GetCheckerErrorDetails())
+		result.Message = bench.Msg("ベンチマークが中断されました。")
+		if reason := getStopReason(); reason != "" {
+			result.Message += " " + reason
 		}
-		return errors
+		return result
 	}
 
-	state := new(bench.State)
-
 	log.Println("State.Init()")
 	state.Init()
 	log.Println("State.Init() Done")
 
 	log.Println("requestInitialize()")
-	err := requestInitialize(bench.GetRandomTargetHost())
+	err := requestInitializeWithRetry(baseCtx, bench.GetRandomTargetURL())
+	if baseCtx.Err() != nil {
+		return abortedResult()
+	}
 	if err != nil {
 		result.Score = 0
-		result.Errors = getErrorsString()
-		result.Message = fmt.Sprint("/initialize へのリクエストに失敗しました。", err)
+		result.setErrors(bench.GetCheckerErrorDetails())
+		result.Message = fmt.Sprint(bench.Msg("/initialize へのリクエストに失敗しました。"), err)
+		result.exitCode = exitInitializeFailure
 		return result
 	}
 	log.Println("requestInitialize() Done")
 
-	ctx, cancel := context.WithTimeout(context.Background(), benchDuration)
+	// Warm-up runs inside the benchmark context, but does not shorten the scoring window
+	ctx, cancel := context.WithTimeout(baseCtx, benchDuration+warmupDuration)
 	defer cancel()
 
 	log.Println("preTest()")
 	err = preTest(ctx, state)
+	if baseCtx.Err() != nil {
+		return abortedResult()
+	}
 	if err != nil {
 		result.Score = 0
-		result.Errors = getErrorsString()
-		result.Message = fmt.Sprint("負荷走行前のバリデーションに失敗しました。", err)
+		result.setErrors(bench.GetCheckerErrorDetails())
+		result.Message = fmt.Sprint(bench.Msg("負荷走行前のバリデーションに失敗しました。"), err)
+		result.exitCode = exitPreTestFailure
 		return result
 	}
 	log.Println("preTest() Done")
 
 	if preTestOnly {
 		result.Score = 0
-		result.Errors = getErrorsString()
+		result.setErrors(bench.GetCheckerErrorDetails())
 		result.Message = fmt.Sprint("preTest passed.")
+		result.exitCode = exitOK
 		return result
 	}
 
-	go loadMain(ctx, state)
+	if warmupDuration > 0 {
+		log.Println("warmUp()")
+		warmUp(ctx, state)
+		if baseCtx.Err() != nil {
+			return abortedResult()
+		}
+		log.Println("warmUp() Done")
+	}
+
+	if benchDuration != parameter.StandardDuration {
+		appendLoadLog(bench.Msgf("%v 負荷走行時間(%v秒)が標準の%v秒ではありません。スコアは1分あたりに換算した値(score_per_minute)で比べてください。",
+			time.Now().Format("01/02 15:04:05"), benchDuration.Seconds(), parameter.StandardDuration.Seconds()))
+	}
+	go watchFreezeWindow(ctx)
+	go watchHostHealth(ctx)
+	go watchBenchSaturation(ctx)
+	var agentResults <-chan []*agentRunResponse
+	if agents != "" {
+		deadline, _ := ctx.Deadline()
+		agentResults = startAgents(baseCtx, remoteAddrs, time.Until(deadline))
+	}
+	if arrivalRate > 0 {
+		go openLoopMain(ctx, state)
+	} else {
+		go loadMain(ctx, state)
+	}
 	log.Println("checkMain()")
 	err = checkMain(ctx, state)
+	if baseCtx.Err() != nil {
+		return abortedResult()
+	}
 	if err != nil {
 		result.Score = 0
-		result.Errors = getErrorsString()
-		result.Message = fmt.Sprint("負荷走行中のバリデーションに失敗しました。", err)
+		result.setErrors(bench.GetCheckerErrorDetails())
+		result.Message = fmt.Sprint(bench.Msg("負荷走行中のバリデーションに失敗しました。"), err)
+		result.exitCode = exitFatalCheckerError
 		return result
 	}
 	log.Println("checkMain() Done")
 
+	var agentErrors []bench.ErrorDetail
+	if agentResults != nil {
+		log.Println("Waiting for agents")
+		agentErrors = mergeAgentResults(<-agentResults)
+	}
+
 	time.Sleep(parameter.AllowableDelay)
 
 	// If backlog, the queue length for completely established sockets waiting to be accepted,
 	// are too large or not configured well, postTest may timeout because of the remained requests.
 	log.Println("postTest()")
-	err = postTest(context.Background(), state)
+	err = postTest(baseCtx, state)
+	if baseCtx.Err() != nil {
+		return abortedResult()
+	}
 	if err != nil {
 		result.Score = 0
-		result.Errors = getErrorsString()
-		result.Message = fmt.Sprint("負荷走行後のバリデーションに失敗しました。", err)
+		result.setErrors(bench.GetCheckerErrorDetails())
+		result.Message = fmt.Sprint(bench.Msg("負荷走行後のバリデーションに失敗しました。"), err)
 		return result
 	}
 	log.Println("postTest() Done")
 
 	printCounterSummary()
 
-	getEventCount := counter.SumPrefix("GET|/api/events/")
-	reserveCount := counter.SumPrefix("POST|/api/events/")
-	cancelCount := counter.SumPrefix("DELETE|/api/events/")
-	topCount := counter.SumEqual("GET|/")
-
-	getCount := counter.SumPrefix(`GET|/`)
-	postCount := counter.SumPrefix(`POST|/`)
-	deleteCount := counter.SumPrefix(`DELETE|/`) // == cancelCount
-	staticCount := counter.GetKey("staticfile-304") + counter.GetKey("staticfile-200")
-
-	score := parameter.Score(getCount, postCount, deleteCount, staticCount, reserveCount, cancelCount, topCount, getEventCount)
-
-	log.Println("get", getCount)
-	log.Println("post", postCount)
-	log.Println("delete", deleteCount)
-	log.Println("static", staticCount)
-	log.Println("top", topCount)
-	log.Println("reserve", reserveCount)
-	log.Println("cancel", cancelCount)
-	log.Println("get_event", getEventCount)
-	log.Println("score", score)
-
-	result.LoadLevel = int(counter.GetKey("load-level-up"))
+	// The requests of postTest are scored as well
+	counts := counter.Snapshot()
+	score, finalWindow := applyFreezePolicy(calcScore(counts), counts)
+	score, errorPenalty := applyErrorPenalty(score)
+
+	result.LoadLevel = int(counter.Get(loadLevelUpKey))
+	result.CancelReserveRatio = realizedCancelReserveRatio(state)
+	result.ReservationTimeline = getReservationSamples()
+	result.ScoreTimeline, result.ScoreBuckets = getScoreTimeline()
+	result.LatencyClasses = getLatencyClassResults()
+	result.Devices = summarizeDevices(counts)
+	result.RequestCounts = getRequestCounts()
+	result.SlowPaths = bench.GetSlowestPaths()
+	result.ThunderingHerd = bench.GetThunderingHerdResult()
+	result.RequestPhases = summarizePhases()
+	result.Scenarios = bench.GetScenarioStats()
+	result.Hosts = getHostStats()
+	result.ConnReuse = summarizeConnReuse()
+	result.BenchBoundReasons = getSaturationReasons()
+	result.BenchBound = len(result.BenchBoundReasons) > 0
+	result.TransferredBytes = counter.Sum(counter.Key{Name: counter.NameBytes})
+	result.FinalWindow = finalWindow
+	result.ErrorPenalty = errorPenalty
+	if sla != nil {
+		result.SLA = sla.check(slaRules)
+		if !result.SLA.Pass {
+			var endpoints []string
+			for _, v := range result.SLA.Violations {
+				endpoints = append(endpoints, fmt.Sprintf("%s(%s, %s)", v.Endpoint, v.Rule, v.Actual))
+			}
+			result.Score = 0
+			result.setErrors(bench.GetCheckerErrorDetails())
+			result.Message = fmt.Sprint(bench.Msg("SLAを満たしていないエンドポイントがあります。"), strings.Join(endpoints, " "))
+			result.exitCode = exitSLAViolation
+			return result
+		}
+	}
 	result.Pass = true
 	result.Score = score
-	result.Errors = getErrorsString()
+	result.setErrors(append(bench.GetCheckerErrorDetails(), agentErrors...))
 	result.Message = "ok"
+	result.exitCode = exitOK
 	return result
 }
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
-
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds | log.Lshortfile)
-	log.SetPrefix("[isu8q-bench] ")
-	colog.Register()
-	colog.SetDefaultLevel(colog.LInfo)
-	colog.SetMinLevel(colog.LInfo)
-
 	var (
-		workermode bool
-		portalUrl  string
-		dataPath   string
-		remotes    string
-		output     string
-		jobid      string
-		tempdir    string
-		test       bool
-		debugMode  bool
-		debugLog   bool
-		nolevelup  bool
-		duration   time.Duration
+		seed        int64
+		workermode  bool
+		portalUrl   string
+		dataPath    string
+		remotes     string
+		output      string
+		junitPath   string
+		reportPath  string
+		harPath     string
+		countersOut string
+		recordPath  string
+		replayPath  string
+		dashboard   string
+		progress    string
+		jobid       string
+		tempdir     string
+		test        bool
+		debugMode   bool
+		debugLog    bool
+		logFormat   string
+		logLevel    string
+		nolevelup   bool
+		duration    time.Duration
+		warmup      time.Duration
+		rampSpec    string
+		cancelRatio float64
+		latencySpec string
+		thinkTime   string
+		userAgents  string
+		churnRatio  string
+
+		hostStrategy   string
+		proxy          string
+		slowThresholds string
+		timeouts       string
+		lang           string
+		selfcheckRace  bool
+		staticDir      string
+		compare        bool
 	)
 
 	flag.BoolVar(&workermode, "workermode", false, "workermode")
-	flag.StringVar(&portalUrl, "portal", "http://localhost:8888", "portal site url (only used at workermode)")
+	flag.StringVar(&portalUrl, "portal", "http://localhost:8888", "portal site url, comma-separated to fail over between portals sharing the job queue (only used at workermode)")
+	flag.StringVar(&portalToken, "portal-token", "", "bearer token sent to the portal (only used at workermode)")
 	flag.StringVar(&dataPath, "data", "./data", "path to data directory")
-	flag.StringVar(&remotes, "remotes", "localhost:8080", "remote addrs to benchmark")
+	flag.StringVar(&bench.UsersPath, "users", "", "CSV of login_name,password,nickname replacing the initial users, which the database has to have with ids in the order of the rows")
+	flag.StringVar(&proxy, "proxy", "", "send benchmark traffic through this proxy (http://host:port for CONNECT or socks5://host:port)")
+	flag.StringVar(&bench.TorbAppHost, "app-host", bench.TorbAppHost, "Host header sent to remotes")
+	flag.StringVar(&remotes, "remotes", "localhost:8080", "remote addrs, URLs or unix domain sockets to benchmark (e.g. 10.0.0.1:8080,https://app.example.com,unix:/var/run/torb.sock; host=weight for -host-strategy weighted)")
+	flag.BoolVar(&healthCheck, "health-check", true, "evict remotes which stop responding during the load until they recover")
+	flag.StringVar(&agents, "agents", "", "comma-separated addrs of agents (-agent-listen) which add load against the same remotes")
+	flag.StringVar(&agentListen, "agent-listen", "", "run as an agent and wait for a coordinator (-agents) on this address (e.g. :17070), only against -remotes")
+	flag.StringVar(&agentToken, "agent-token", "", "token shared by the coordinator and the agents, required by -agent-listen")
+	flag.StringVar(&hostStrategy, "host-strategy", "least-conn", "how to distribute requests among remotes (least-conn, random, round-robin, weighted, least-error, sticky)")
 	flag.StringVar(&output, "output", "", "path to write result json")
+	flag.StringVar(&dashboard, "dashboard", "", "listen address of the live dashboard (e.g. :16061)")
+	flag.StringVar(&progress, "progress", "", "path to write progress as NDJSON every second (- for stdout)")
+	flag.StringVar(&reportPath, "report", "", "path to write result as a self-contained html report")
+	flag.StringVar(&bench.OTLPEndpoint, "otlp-endpoint", "", "export traces of scenarios and requests to this OTLP/HTTP endpoint (e.g. http://localhost:4318)")
+	flag.StringVar(&countersOut, "counters-out", "", "path to write all counters at the end of the run as CSV, or JSON if it ends with .json")
+	flag.StringVar(&recordPath, "record", "", "path to record all requests for -replay")
+	flag.StringVar(&replayPath, "replay", "", "re-issue the requests recorded by -record against remotes, with the same timing, and exit")
+	flag.StringVar(&harPath, "har", "", "path to write sampled requests and responses in HTTP Archive format")
+	flag.Float64Var(&bench.HARSampleRate, "har-sample", 0.01, "fraction of requests recorded by -har")
 	flag.StringVar(&jobid, "jobid", "", "job id")
-	flag.StringVar(&tempdir, "tempdir", "", "path to temp dir")
+	flag.Int64Var(&seed, "seed", 0, "seed of math/rand to reproduce a run (0 for a random seed)")
+	flag.StringVar(&tempdir, "tempdir", "", "path to temp dir (failed checks are dumped into its failures directory)")
 	flag.BoolVar(&test, "test", false, "run pretest only")
+	flag.StringVar(&junitPath, "junit", "", "path to write pretest results as JUnit XML (only used with -test)")
 	flag.BoolVar(&debugMode, "debug-mode", false, "add debugging info into request header")
-	flag.BoolVar(&debugLog, "debug-log", false, "print debug log")
+	flag.BoolVar(&debugLog, "debug-log", false, "print debug log (same as -log-level=debug)")
+	flag.StringVar(&logFormat, "log-format", "text", "log format (text, json)")
+	flag.StringVar(&logLevel, "log-level", "info", "minimum log level (debug, info, warn, error)")
+	flag.BoolVar(&bench.StrictHTML, "strict-html", false, "validate the full DOM structure of the top page and the admin page")
+	flag.BoolVar(&bench.FuzzAllowReferenceErrors, "fuzz-allow-reference-errors", false, "accept the 500s which the reference app answers to some malformed inputs of the fuzz check")
 	flag.DurationVar(&duration, "duration", time.Minute, "benchamrk duration")
+	flag.DurationVar(&warmup, "warmup", 0, "run load scenarios for this duration before the scoring window starts")
+	flag.DurationVar(&freezeWindow, "final-window", 0, "do not count requests in the final window if its error rate exceeds -final-window-error-rate (0 to disable)")
+	flag.Float64Var(&freezeErrorRate, "final-window-error-rate", 0.01, "allowed error rate in the final window")
+	flag.StringVar(&slaRules, "sla", "", "fail the run if any endpoint exceeds the budgets (e.g. p99=500ms,avail=99%)")
+	flag.Float64Var(&errorPenaltyRate, "error-penalty", 0, "deduct this ratio of the score per non-fatal error (e.g. 0.01 for 1%, 0 to disable)")
+	flag.Float64Var(&errorPenaltyCap, "error-penalty-cap", 0.5, "upper limit of the ratio deducted by -error-penalty")
+	flag.IntVar(&parameter.InitializeAttempts, "initialize-attempts", parameter.InitializeAttempts, "max attempts of /initialize")
+	flag.DurationVar(&parameter.InitializeBackoff, "initialize-backoff", parameter.InitializeBackoff, "wait before retrying /initialize (doubled on every retry)")
+	flag.DurationVar(&parameter.InitializeDeadline, "initialize-deadline", parameter.InitializeDeadline, "overall deadline of /initialize attempts")
+	flag.DurationVar(&parameter.ClockSkewTolerance, "clock-skew", parameter.ClockSkewTolerance, "allowed clock difference between the benchmarker and the app for timestamps in responses")
 	flag.BoolVar(&nolevelup, "nolevelup", false, "dont increase load level")
+	flag.DurationVar(&parameter.LoadLevelUpInterval, "levelup-interval", parameter.LoadLevelUpInterval, "interval to try the load level up")
+	flag.DurationVar(&parameter.LoadLevelUpLookback, "levelup-lookback", parameter.LoadLevelUpLookback, "slow requests in flight within this window block the load level up")
+	flag.DurationVar(&parameter.LoadLevelUpWindow, "levelup-window", parameter.LoadLevelUpWindow, "error rates and latency percentiles of the endpoints within this window block the load level up")
+	flag.IntVar(&parameter.MaxIdleConns, "max-idle-conns", parameter.MaxIdleConns, "max idle connections in total (0 for unlimited)")
+	flag.IntVar(&parameter.MaxIdleConnsPerHost, "max-idle-conns-per-host", parameter.MaxIdleConnsPerHost, "max idle connections per remote")
+	flag.IntVar(&parameter.MaxConnsPerHost, "max-conns-per-host", parameter.MaxConnsPerHost, "max connections per remote including active ones (0 for unlimited)")
+	flag.DurationVar(&parameter.IdleConnTimeout, "idle-conn-timeout", parameter.IdleConnTimeout, "close idle connections after this duration (0 for no timeout)")
+	flag.Float64Var(&parameter.LoadInitialNumGoroutines, "initial-goroutines", parameter.LoadInitialNumGoroutines, "# of load goroutines at the start (the step size of the level up is set by -ramp)")
+	flag.IntVar(&maxErrors, "max-errors", 0, "abort the run with the partial result when the checker errors reach this number (0 for no limit)")
+	flag.BoolVar(&failFast, "fail-fast", false, "abort the run with the partial result on the first checker error")
+	flag.DurationVar(&shedAfter, "shed-after", parameter.LoadShedAfter, "decrease load level when errors or slow responses persist for this duration (0 to disable)")
+	flag.Float64Var(&cancelRatio, "cancel-ratio", parameter.CancelReserveRatio, "target cancel:reserve ratio of load scenarios (negative to follow scenario weights)")
+	flag.Float64Var(&arrivalRate, "rps", 0, "start load scenarios at this arrival rate per second (open-loop model, disables load level up)")
+	flag.StringVar(&latencySpec, "latency-classes", "", "emulate remote users by delaying requests per user class (name:ratio:delay,... e.g. remote:0.1:100ms)")
+	flag.StringVar(&userAgents, "user-agents", "", "User-Agents of virtual users: built-in desktop and mobile browsers if empty, fixed for the benchmarker's, or a file of \"<device> <User-Agent>\" lines")
+	flag.BoolVar(&mobileChecks, "mobile-checks", false, "check that the top page and the static files are served to mobile browsers")
+	flag.IntVar(&maxWorkers, "max-workers", 0, "upper limit of concurrent load goroutines (0 for unlimited)")
+	flag.IntVar(&sessionWeight, "session-weight", 0, "weight of the virtual user session scenario (top page → event → reserve → my page) among load scenarios")
+	flag.StringVar(&timeouts, "timeouts", "", "client timeouts per endpoint class (class=d,... e.g. static=5s,report=2m,api=3s; classes: static, report, api, get, post, delete)")
+	flag.IntVar(&churnWeight, "churn-weight", 0, "weight of the scenario which alternates reservations and cancellations of earlier reservations at -churn-ratio among load scenarios")
+	flag.StringVar(&churnRatio, "churn-ratio", "70/30", "reserve/cancel ratio of the -churn-weight scenario")
+	flag.IntVar(&adminWeight, "admin-session-weight", 0, "weight of the organizer session scenario (admin page → event → event report, repeated) among load scenarios")
+	flag.StringVar(&slowThresholds, "slow-thresholds", "", "slow path thresholds per path prefix which block the load level up (prefix=d,... e.g. /admin/api/reports/=5s)")
+	flag.IntVar(&cancelRaceWeight, "cancel-race-weight", 0, "weight of the scenario in which users try to reserve a sheet canceled at the same time among load scenarios")
+	flag.IntVar(&herdWeight, "herd-weight", 0, "weight of the scenario in which many users reserve the rank of the fewest sheets of a new event at once among load scenarios")
+	flag.IntVar(&reportStreamWeight, "report-stream-weight", 0, "weight of the scenario which streams and checks the sales reports among load scenarios")
+	flag.IntVar(&chaosWeight, "chaos", 0, "weight of misbehaving clients (aborted responses, half bodies, slowloris, resets) among load scenarios")
+	flag.StringVar(&bench.ScriptDir, "scripts", "", "directory of Starlark scripts (*.star) added as load scenarios")
+	flag.StringVar(&thinkTime, "think-time", "none", "think time of virtual users between their requests during the load (none, fixed:d, uniform:min:max, exp:mean, normal:mean:stddev)")
+	flag.StringVar(&rampSpec, "ramp", "exponential", "load ramp profile (exponential[:ratio], linear[:n], step[:levels[:n]], custom:n0,n1,...)")
+	flag.StringVar(&lang, "lang", "ja", "language of the result message, the load logs and the errors (ja, en)")
+	flag.BoolVar(&selfcheckRace, "selfcheck-race", false, "run all scenarios against an internal fake server to detect data races (requires -race build)")
+	flag.StringVar(&staticDir, "staticdir", "../webapp/static", "path to webapp/static directory served by the fake server of -selfcheck-race")
+	flag.BoolVar(&compare, "compare", false, "compare two result json files (bench -compare old.json new.json)")
 	flag.Parse()
 
+	if compare {
+		if flag.NArg() != 2 {
+			log.Fatalln("usage: bench -compare old.json new.json")
+		}
+		err := compareResults(os.Stdout, flag.Arg(0), flag.Arg(1))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	if debugLog {
-		colog.SetMinLevel(colog.LDebug)
+		logLevel = "debug"
+	}
+	level, err := parseLogLevel(logLevel)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = setupLogging(os.Stderr, logFormat, level, jobid)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rand.Seed(seed)
+	log.Println("Seed", seed)
+
+	err = bench.SetLang(lang)
+	if err != nil {
+		log.Fatalln(err)
 	}
 	bench.DebugMode = debugMode
+	if tempdir != "" {
+		bench.FailureDir = filepath.Join(tempdir, "failures")
+	}
+	if harPath == "" {
+		bench.HARSampleRate = 0
+	}
+	bench.ConfigureConnPool()
+	err = bench.SetProxy(proxy)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if parameter.LoadLevelUpInterval <= 0 {
+		log.Fatalln("-levelup-interval must be positive, got", parameter.LoadLevelUpInterval)
+	}
 	bench.DataPath = dataPath
 	bench.PrepareDataSet()
 
 	preTestOnly = test
 	noLevelup = nolevelup
 	benchDuration = duration
+	warmupDuration = warmup
+	parameter.CancelReserveRatio = cancelRatio
+
+	ramp, err = parseRampProfile(rampSpec)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = bench.SetLatencyClasses(latencySpec)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = bench.SetChurnRatio(churnRatio)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = bench.SetUserAgents(userAgents)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = bench.SetThinkTime(thinkTime)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = bench.SetSlowThresholds(slowThresholds)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = bench.SetTimeouts(timeouts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = bench.LoadScripts()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	sla, err = parseSLA(slaRules)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	bench.StartTracing()
+
+	if selfcheckRace {
+		runSelfCheckRace(staticDir)
+		return
+	}
 
 	if workermode {
 		runWorkerMode(tempdir, portalUrl)
 		return
 	}
 
+	if agentListen != "" {
+		runAgentMode(agentListen, strings.Split(remotes, ","))
+		return
+	}
+
+	publishExpvars()
 	go func() {
 		log.Println(http.ListenAndServe(fmt.Sprintf(":%d", pprofPort), nil))
 	}()
@@ -589,12 +1306,55 @@ func main() {
 	}
 	log.Println("Remotes", remoteAddrs)
 
-	bench.SetTargetHosts(remoteAddrs)
+	err = bench.SetTargetHosts(remoteAddrs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if proxy == "" {
+		// behind a proxy, the remotes may be resolvable only by the proxy
+		err = resolveRemotes(bench.GetTargetHosts())
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	err = bench.SetHostStrategy(hostStrategy)
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	result := startBenchmark(remoteAddrs)
+	if dashboard != "" {
+		go serveDashboard(dashboard)
+	}
+
+	ctx, stopBenchmark := context.WithCancel(trapSignals())
+	go watchStopConditions(ctx, stopBenchmark)
+	progressCtx, progressCancel := context.WithCancel(ctx)
+	if progress != "" {
+		go writeProgress(progressCtx, progress)
+	}
+	if replayPath != "" {
+		runReplay(ctx, replayPath)
+		return
+	}
+	if recordPath != "" {
+		err = bench.StartRecording(recordPath, seed)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	startProfiling(tempdir, jobid)
+	result := startBenchmark(ctx, remoteAddrs)
+	if err := bench.StopRecording(); err != nil {
+		log.Println("warn: failed to write", recordPath, err)
+	}
+	progressCancel()
+	result.Profiles = captureProfiles()
+	bench.FlushTraces(5 * time.Second)
 	result.IPAddrs = remotes
 	result.JobID = jobid
-	result.Logs = loadLogs
+	result.Seed = seed
+	result.Logs = getLoadLogs()
 
 	b, err := json.Marshal(result)
 	if err != nil {
@@ -611,7 +1371,37 @@ func main() {
 		log.Println("result json saved to ", output)
 	}
 
-	if !result.Pass {
-		os.Exit(1)
+	if harPath != "" {
+		err := writeHAR(harPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Println("har saved to ", harPath)
+	}
+
+	if countersOut != "" {
+		err := writeCounters(countersOut)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Println("counters saved to ", countersOut)
+	}
+
+	if reportPath != "" {
+		err := writeReport(reportPath, result)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Println("html report saved to ", reportPath)
 	}
+
+	if test && junitPath != "" {
+		err := writeJUnit(junitPath, result)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Println("junit xml saved to ", junitPath)
+	}
+
+	os.Exit(result.exitCode)
 }
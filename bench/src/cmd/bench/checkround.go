@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+
+	"bench"
+)
+
+// Names of the checks which a check depends on, given by bench.RegisterCheckAfter
+var checkDependencies = map[string][]string{}
+
+// The checks during the load run in rounds, each of which runs every check once in a random order
+// with its own fixtures. Up to parameter.CheckWorkers checks run at a time, and a check is started
+// only after the checks it depends on have finished in the round. A check whose dependency failed
+// is skipped in the round, so that the failure is attributed to the dependency only.
+type checkRound struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	funcs    []benchFunc
+	pending  []benchFunc // not started yet in this round
+	running  int
+	done     map[string]bool
+	failed   map[string]bool // failed or skipped
+	fixtures *bench.Fixtures
+}
+
+func newCheckRound(funcs []benchFunc) *checkRound {
+	r := &checkRound{funcs: funcs}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// Returns the next check to run and the fixtures of its round, waiting for the running checks if
+// none can start yet. Returns false when ctx is done.
+func (r *checkRound) next(ctx context.Context) (benchFunc, *bench.Fixtures, bool) {
+	stop := context.AfterFunc(ctx, func() {
+		r.mu.Lock()
+		r.cond.Broadcast()
+		r.mu.Unlock()
+	})
+	defer stop()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ctx.Err() == nil {
+		if len(r.pending) == 0 && r.running == 0 {
+			r.pending = make([]benchFunc, len(r.funcs))
+			for i, j := range rand.Perm(len(r.funcs)) {
+				r.pending[i] = r.funcs[j]
+			}
+			r.done = map[string]bool{}
+			r.failed = map[string]bool{}
+			r.fixtures = bench.NewFixtures()
+		}
+		if i := r.runnable(); i >= 0 {
+			f := r.pending[i]
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			r.running++
+			return f, r.fixtures, true
+		}
+		r.cond.Wait()
+	}
+	return benchFunc{}, nil, false
+}
+
+// Returns the index of the first pending check whose dependencies have succeeded in the round, or -1.
+// The checks whose dependencies have failed are skipped on the way.
+func (r *checkRound) runnable() int {
+	for i := 0; i < len(r.pending); {
+		f := r.pending[i]
+		if dep := r.failedDependency(f); dep != "" {
+			log.Printf("debug: checkMain: %s is skipped since %s failed\n", f.Name, dep)
+			bench.RecordScenarioSkip(f.Name)
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			r.done[f.Name] = true
+			r.failed[f.Name] = true
+			// the checks before i may depend on f
+			i = 0
+			continue
+		}
+		ready := true
+		for _, dep := range checkDependencies[f.Name] {
+			ready = ready && r.done[dep]
+		}
+		if ready {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+func (r *checkRound) failedDependency(f benchFunc) string {
+	for _, dep := range checkDependencies[f.Name] {
+		if r.failed[dep] {
+			return dep
+		}
+	}
+	return ""
+}
+
+func (r *checkRound) finish(f benchFunc, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.running--
+	r.done[f.Name] = true
+	if err != nil {
+		r.failed[f.Name] = true
+	}
+	r.cond.Broadcast()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+func getRequestCounts() map[string]int64 {
+	requests, _ := summarizeCounters()
+	m := map[string]int64{}
+	for _, kv := range requests {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func readBenchResult(path string) (*BenchResult, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result := new(BenchResult)
+	err = json.Unmarshal(b, result)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return result, nil
+}
+
+func percentDelta(a, b int64) string {
+	if a == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+.1f%%", float64(b-a)/float64(a)*100)
+}
+
+// Prints the difference between two BenchResult files like benchcmp
+func compareResults(w io.Writer, pathA, pathB string) error {
+	a, err := readBenchResult(pathA)
+	if err != nil {
+		return err
+	}
+	b, err := readBenchResult(pathB)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%-48s %12s %12s %12s %8s\n", "", "old", "new", "delta", "")
+	fmt.Fprintf(w, "%-48s %12d %12d %+12d %8s\n", "score", a.Score, b.Score, b.Score-a.Score, percentDelta(a.Score, b.Score))
+	if a.DurationSec != b.DurationSec || a.NonStandardDuration || b.NonStandardDuration {
+		// the raw scores of different durations are not comparable
+		fmt.Fprintf(w, "%-48s %12v %12v\n", "duration_sec", a.DurationSec, b.DurationSec)
+		fmt.Fprintf(w, "%-48s %12d %12d %+12d %8s\n", "score_per_minute", a.ScorePerMinute, b.ScorePerMinute, b.ScorePerMinute-a.ScorePerMinute, percentDelta(a.ScorePerMinute, b.ScorePerMinute))
+	}
+	fmt.Fprintf(w, "%-48s %12d %12d %+12d\n", "load_level", a.LoadLevel, b.LoadLevel, b.LoadLevel-a.LoadLevel)
+	fmt.Fprintf(w, "%-48s %12v %12v\n", "pass", a.Pass, b.Pass)
+
+	var keys []string
+	for key := range a.RequestCounts {
+		keys = append(keys, key)
+	}
+	for key := range b.RequestCounts {
+		if _, ok := a.RequestCounts[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		fmt.Fprintln(w)
+		for _, key := range keys {
+			ca, cb := a.RequestCounts[key], b.RequestCounts[key]
+			fmt.Fprintf(w, "%-48s %12d %12d %+12d %8s\n", key, ca, cb, cb-ca, percentDelta(ca, cb))
+		}
+	}
+
+	errorsA := map[string]bool{}
+	for _, e := range a.Errors {
+		errorsA[e.label()] = true
+	}
+	errorsB := map[string]bool{}
+	for _, e := range b.Errors {
+		errorsB[e.label()] = true
+	}
+
+	var removed, added []string
+	for e := range errorsA {
+		if !errorsB[e] {
+			removed = append(removed, e)
+		}
+	}
+	for e := range errorsB {
+		if !errorsA[e] {
+			added = append(added, e)
+		}
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+
+	if len(added) > 0 {
+		fmt.Fprintln(w, "\nnew errors:")
+		for _, e := range added {
+			fmt.Fprintln(w, "  +", e)
+		}
+	}
+	if len(removed) > 0 {
+		fmt.Fprintln(w, "\nremoved errors:")
+		for _, e := range removed {
+			fmt.Fprintln(w, "  -", e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"bench/counter"
+)
+
+// Writes every counter as it is kept, one row per key, for analysis after the run.
+// The format is JSON if path ends with .json, and CSV otherwise.
+func writeCounters(path string) error {
+	counts := counter.Snapshot().List()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(counts)
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"name", "method", "path", "status", "labels", "value"})
+	for _, c := range counts {
+		w.Write([]string{c.Name, c.Method, c.Path, c.Status, c.Labels, strconv.FormatInt(c.Value, 10)})
+	}
+	w.Flush()
+	return w.Error()
+}
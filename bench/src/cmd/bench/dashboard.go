@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"bench"
+	"bench/counter"
+)
+
+const dashboardRecentErrors = 10
+
+type progressStatus struct {
+	Time         time.Time        `json:"time"`
+	Elapsed      float64          `json:"elapsed"` // seconds since the benchmarker started
+	Score        int64            `json:"score"`   // estimated from the current counters
+	LoadLevel    int64            `json:"load_level"`
+	NumErrors    int              `json:"num_errors"`
+	RecentErrors []string         `json:"recent_errors"`
+	Requests     []counterSummary `json:"requests"`
+}
+
+var benchStartAt = time.Now()
+
+func getProgressStatus(numRecentErrors int) *progressStatus {
+	errs := bench.GetCheckerErrors()
+	requests, _ := summarizeCounters()
+
+	st := &progressStatus{
+		Time:      time.Now(),
+		Elapsed:   time.Since(benchStartAt).Seconds(),
+		Score:     sumScoreCounts(counter.Snapshot().Map()).Score(),
+		LoadLevel: counter.Get(loadLevelUpKey),
+		NumErrors: len(errs),
+		Requests:  requests,
+	}
+	if len(errs) > numRecentErrors {
+		errs = errs[len(errs)-numRecentErrors:]
+	}
+	for _, err := range errs {
+		st.RecentErrors = append(st.RecentErrors, err.Error())
+	}
+	return st
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>isucon8q bench dashboard</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+td.num { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Benchmark Dashboard</h1>
+<table>
+<tr><th>Elapsed</th><td class="num" id="elapsed"></td></tr>
+<tr><th>Score (estimated)</th><td class="num" id="score"></td></tr>
+<tr><th>Load level</th><td class="num" id="level"></td></tr>
+<tr><th>Errors</th><td class="num" id="num-errors"></td></tr>
+</table>
+<h2>Recent errors</h2>
+<ul id="errors"></ul>
+<h2>Request counts</h2>
+<table id="requests"></table>
+<script>
+function text(id, v) { document.getElementById(id).textContent = v; }
+function update() {
+  fetch("/api/status").then(function(res) { return res.json(); }).then(function(st) {
+    text("elapsed", st.elapsed.toFixed(1) + "s");
+    text("score", st.score);
+    text("level", st.load_level);
+    text("num-errors", st.num_errors);
+    var errors = document.getElementById("errors");
+    errors.innerHTML = "";
+    (st.recent_errors || []).forEach(function(e) {
+      var li = document.createElement("li");
+      li.textContent = e;
+      errors.appendChild(li);
+    });
+    var requests = document.getElementById("requests");
+    requests.innerHTML = "";
+    (st.requests || []).forEach(function(kv) {
+      var tr = requests.insertRow();
+      tr.insertCell().textContent = kv.Key;
+      var td = tr.insertCell();
+      td.className = "num";
+      td.textContent = kv.Value;
+    });
+  }).catch(function() {});
+}
+update();
+setInterval(update, {{.IntervalMs}});
+</script>
+</body>
+</html>
+`))
+
+// Serves a live dashboard of the running benchmark
+func serveDashboard(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		dashboardTemplate.Execute(w, map[string]interface{}{"IntervalMs": int64(time.Second / time.Millisecond)})
+	})
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(getProgressStatus(dashboardRecentErrors))
+	})
+
+	log.Println("Dashboard", addr)
+	log.Println(http.ListenAndServe(addr, mux))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"bench"
+	"bench/parameter"
+)
+
+// Runs bench.DeepCheck every DeepCheckInterval during the load, and sends its first fatal error to errCh
+func watchDeepCheck(ctx context.Context, state *bench.State, errCh chan<- error) {
+	ticker := time.NewTicker(parameter.DeepCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		t := time.Now()
+		err := benchFunc{"DeepCheck", bench.DeepCheck}.Run(ctx, state)
+		log.Println("checkMain(deep): DeepCheck", time.Since(t))
+
+		if err != nil && bench.IsFatal(err) {
+			errCh <- err
+			return
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sort"
+
+	"bench/counter"
+)
+
+// Splits the requests and the score by the label device of the counters, sorted by device
+func summarizeDevices(counts counter.Counts) []DeviceResult {
+	byDevice := map[string]map[counter.Key]int64{}
+	for key, count := range counts.Map() {
+		if key.Name != counter.NameRequest && key.Name != counter.NameStaticFile {
+			continue
+		}
+		device := key.Label("device")
+		if device == "" {
+			continue
+		}
+		if byDevice[device] == nil {
+			byDevice[device] = map[counter.Key]int64{}
+		}
+		byDevice[device][key] = count
+	}
+
+	var results []DeviceResult
+	for device, m := range byDevice {
+		results = append(results, DeviceResult{
+			Device:   device,
+			Requests: counts.Sum(counter.Key{Name: counter.NameRequest, Labels: counter.Labels("device", device)}),
+			Score:    sumScoreCounts(m).Score(),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Device < results[j].Device })
+	return results
+}
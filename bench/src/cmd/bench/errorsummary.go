@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"time"
+
+	"bench"
+	"bench/counter"
+	"bench/parameter"
+)
+
+// Identical errors, which differ only in the time and the request, reported once with their count.
+// The embedded detail is of the first occurrence.
+type ErrorSummary struct {
+	bench.ErrorDetail
+	Count    int       `json:"count"`
+	LastTime time.Time `json:"last_time"`
+}
+
+// Describes the error without the time and the request, e.g. "[wrong-status] GET|/api/events/* reason"
+func (s ErrorSummary) label() string {
+	path := s.URL
+	if u, err := url.Parse(s.URL); err == nil {
+		path = u.Path
+	}
+	label := "[" + string(s.Code) + "] " + s.Method + "|" + counter.NormalizePath(path) + " " + s.Reason
+	if s.Agent != "" {
+		label = "[agent " + s.Agent + "] " + label
+	}
+	return label
+}
+
+// Returns the unique errors, the most frequent first
+func summarizeErrors(errs []bench.ErrorDetail) []ErrorSummary {
+	var summaries []*ErrorSummary
+	byKey := map[string]*ErrorSummary{}
+	for _, e := range errs {
+		// identical errors have the same code, endpoint and reason
+		key := ErrorSummary{ErrorDetail: e}.label()
+		s, ok := byKey[key]
+		if !ok {
+			s = &ErrorSummary{ErrorDetail: e}
+			byKey[key] = s
+			summaries = append(summaries, s)
+		}
+		s.Count++
+		if e.Time.After(s.LastTime) {
+			s.LastTime = e.Time
+		}
+	}
+
+	// stable, so that errors of the same count are in the order of their first occurrence
+	sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].Count > summaries[j].Count })
+
+	result := make([]ErrorSummary, 0, len(summaries))
+	for _, s := range summaries {
+		result = append(result, *s)
+	}
+	return result
+}
+
+// Sets the top ResultErrorTopN of the unique errors and the numbers of errors
+func (r *BenchResult) setErrors(errs []bench.ErrorDetail) {
+	summaries := summarizeErrors(errs)
+	r.NumErrors = len(errs)
+	r.NumUniqueErrors = len(summaries)
+	if len(summaries) > parameter.ResultErrorTopN {
+		summaries = summaries[:parameter.ResultErrorTopN]
+	}
+	r.Errors = summaries
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"expvar"
+
+	"bench"
+	"bench/counter"
+)
+
+// Publishes the counters under /debug/vars of the pprof listener, so that they can be polled by
+// the usual expvar tools while the benchmark is running. Called once, before the listener starts.
+func publishExpvars() {
+	expvar.Publish("counters", expvar.Func(func() interface{} {
+		counters := map[string]int64{}
+		for key, value := range counter.Snapshot().Map() {
+			counters[key.String()] = value
+		}
+		return counters
+	}))
+	expvar.Publish("load_level", expvar.Func(func() interface{} {
+		return counter.Get(loadLevelUpKey)
+	}))
+	expvar.Publish("in_flight_requests", expvar.Func(func() interface{} {
+		return bench.CountInFlightRequests()
+	}))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"bench"
+	"bench/counter"
+)
+
+var (
+	freezeWindow       time.Duration
+	freezeErrorRate    float64
+	freezeSnapshotMtx  sync.Mutex
+	freezeSnapshotTook bool
+	freezeCounts       counter.Counts
+	freezeErrors       int
+)
+
+// Takes a snapshot of the counters when the final window of the benchmark begins.
+// ctx must be the benchmark context whose deadline is the end of the scoring window.
+func watchFreezeWindow(ctx context.Context) {
+	if freezeWindow <= 0 {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+
+	timer := time.NewTimer(time.Until(deadline.Add(-freezeWindow)))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return
+	}
+
+	freezeSnapshotMtx.Lock()
+	freezeCounts = counter.Snapshot()
+	freezeErrors = len(bench.GetCheckerErrors())
+	freezeSnapshotTook = true
+	freezeSnapshotMtx.Unlock()
+
+	log.Println("debug: final window started", freezeWindow)
+}
+
+// Applies the final window policy: requests in the final window are not counted
+// if the error rate in the window exceeds freezeErrorRate.
+// Returns nil if the policy is disabled or the final window has not been reached.
+func applyFreezePolicy(score int64, counts counter.Counts) (int64, *FreezeResult) {
+	freezeSnapshotMtx.Lock()
+	defer freezeSnapshotMtx.Unlock()
+
+	if !freezeSnapshotTook {
+		return score, nil
+	}
+
+	before := sumScoreCounts(freezeCounts.Map())
+	after := sumScoreCounts(counts.Map())
+
+	r := &FreezeResult{
+		WindowSec:          freezeWindow.Seconds(),
+		ErrorRateThreshold: freezeErrorRate,
+		Requests:           (after.Get + after.Post + after.Delete) - (before.Get + before.Post + before.Delete),
+		Errors:             len(bench.GetCheckerErrors()) - freezeErrors,
+	}
+	if r.Requests > 0 {
+		r.ErrorRate = float64(r.Errors) / float64(r.Requests)
+	} else if r.Errors > 0 {
+		r.ErrorRate = 1
+	}
+
+	if r.ErrorRate > freezeErrorRate {
+		frozen := before.Score()
+		r.Frozen = true
+		r.DiscardedScore = score - frozen
+		score = frozen
+
+		appendLoadLog(bench.Msgf("最後の%v秒間のエラー率が%.2f%%を超えたため、その間のリクエストはスコアに含まれません。", freezeWindow.Seconds(), freezeErrorRate*100))
+	}
+
+	log.Printf("final window: requests:%d errors:%d error_rate:%.4f frozen:%v discarded:%d\n", r.Requests, r.Errors, r.ErrorRate, r.Frozen, r.DiscardedScore)
+	return score, r
+}
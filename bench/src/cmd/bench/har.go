@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+
+	"bench"
+)
+
+func writeHAR(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return bench.WriteHAR(f)
+}
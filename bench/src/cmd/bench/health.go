@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"bench"
+	"bench/parameter"
+)
+
+var healthCheck bool
+
+// Health checks every remote and evicts the ones which fail parameter.HealthCheckFailures times in a row.
+// Evicted remotes are re-added as soon as they respond again. Does nothing with a single remote.
+func watchHostHealth(ctx context.Context) {
+	hosts := bench.GetTargetURLs()
+	if !healthCheck || len(hosts) < 2 {
+		return
+	}
+
+	client := &http.Client{
+		Transport: bench.NewTransport(),
+		Timeout:   parameter.HealthCheckTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	failures := make([]int, len(hosts))
+	evicted := make([]bool, len(hosts))
+
+	ticker := time.NewTicker(parameter.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		for i, host := range hosts {
+			err := checkHostHealth(ctx, client, host)
+			if ctx.Err() != nil {
+				return
+			}
+			now := time.Now().Format("01/02 15:04:05")
+
+			if err == nil {
+				failures[i] = 0
+				if evicted[i] {
+					evicted[i] = false
+					bench.SetHostEvicted(i, false)
+					appendLoadLog(bench.Msgf("%v %sが復旧したため負荷走行の対象に戻しました。", now, host))
+					log.Println("Host recovered", host)
+				}
+				continue
+			}
+
+			failures[i]++
+			log.Println("debug: health check failed", host, failures[i], err)
+			if !evicted[i] && failures[i] >= parameter.HealthCheckFailures {
+				evicted[i] = true
+				bench.SetHostEvicted(i, true)
+				appendLoadLog(bench.Msgf("%v %sが応答しないため負荷走行の対象から一時的に外しました。%v", now, host, err))
+				log.Println("Host evicted", host, err)
+			}
+		}
+	}
+}
+
+func checkHostHealth(ctx context.Context, client *http.Client, host string) error {
+	req, err := http.NewRequest("GET", host+parameter.HealthCheckPath, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = bench.TorbAppHost
+	req.Header.Set("User-Agent", bench.UserAgent)
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if 500 <= res.StatusCode {
+		return fmt.Errorf("%s", res.Status)
+	}
+	return nil
+}
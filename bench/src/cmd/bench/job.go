@@ -1,26 +1,100 @@
 package main
 
-import "time"
+import (
+	"time"
+
+	"bench"
+	"bench/parameter"
+)
 
 // portal/job.go と同期する事
 
 type BenchResult struct {
 	JobID   string `json:"job_id"`
 	IPAddrs string `json:"ip_addrs"`
+	Seed    int64  `json:"seed"` // -seed to reproduce the run
+
+	Pass      bool           `json:"pass"`
+	Aborted   bool           `json:"aborted"`
+	Score     int64          `json:"score"`
+	Message   string         `json:"message"`
+	Errors    []ErrorSummary `json:"error"` // top ResultErrorTopN of the unique errors
+	Logs      []string       `json:"log"`
+	LoadLevel int            `json:"load_level"`
+
+	NumErrors       int `json:"num_errors"`
+	NumUniqueErrors int `json:"num_unique_errors"`
+
+	CancelReserveRatio  float64                     `json:"cancel_reserve_ratio"`
+	ReservationTimeline []ReservationSample         `json:"reservation_timeline,omitempty"`
+	ScoreTimeline       []int64                     `json:"score_timeline,omitempty"` // score gained in each second of the load
+	ScoreBuckets        []ScoreBucket               `json:"score_buckets,omitempty"`
+	LatencyClasses      []LatencyClassResult        `json:"latency_classes,omitempty"`
+	Devices             []DeviceResult              `json:"devices,omitempty"`
+	FinalWindow         *FreezeResult               `json:"final_window,omitempty"`
+	ErrorPenalty        *PenaltyResult              `json:"error_penalty,omitempty"`
+	SLA                 *SLAResult                  `json:"sla,omitempty"`
+	RequestCounts       map[string]int64            `json:"request_counts,omitempty"`
+	SlowPaths           []bench.SlowPath            `json:"slow_paths,omitempty"` // slowest requests of the load
+	ThunderingHerd      *bench.ThunderingHerdResult `json:"thundering_herd,omitempty"`
+	RequestPhases       []phaseSummary              `json:"request_phases,omitempty"`
+	Scenarios           []bench.ScenarioStat        `json:"scenarios,omitempty"`
+	Hosts               []bench.HostStat            `json:"hosts,omitempty"` // only with several remotes
+	ConnReuse           []connReuseSummary          `json:"conn_reuse,omitempty"`
+	TransferredBytes    int64                       `json:"transferred_bytes"`
+	Profiles            map[string]string           `json:"profiles,omitempty"` // paths of the pprof profiles in -tempdir
+	BenchBound          bool                        `json:"bench_bound"`        // the bench host was saturated during the load
+	BenchBoundReasons   []string                    `json:"bench_bound_reasons,omitempty"`
+
+	// Scores of runs whose -duration is not parameter.StandardDuration are compared by ScorePerMinute
+	DurationSec         float64 `json:"duration_sec"`
+	ScorePerMinute      int64   `json:"score_per_minute"`
+	NonStandardDuration bool    `json:"non_standard_duration,omitempty"`
+
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	ClockJumps []string  `json:"clock_jumps,omitempty"`
+
+	exitCode int
+}
+
+func (r *BenchResult) normalizeScore(duration time.Duration) {
+	r.DurationSec = duration.Seconds()
+	r.NonStandardDuration = duration != parameter.StandardDuration
+	if duration > 0 {
+		r.ScorePerMinute = int64(float64(r.Score) * float64(time.Minute) / float64(duration))
+	}
+}
 
-	Pass      bool     `json:"pass"`
-	Score     int64    `json:"score"`
-	Message   string   `json:"message"`
-	Errors    []string `json:"error"`
-	Logs      []string `json:"log"`
-	LoadLevel int      `json:"load_level"`
+type LatencyClassResult struct {
+	Name      string  `json:"name"`
+	DelayMs   int64   `json:"delay_ms"`
+	Requests  int64   `json:"requests"`
+	LatencyMs float64 `json:"latency_ms"` // average including the injected delay
+	Score     int64   `json:"score"`
+}
 
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time"`
+// Requests and score of the virtual users of a device class (-user-agents)
+type DeviceResult struct {
+	Device   string `json:"device"`
+	Requests int64  `json:"requests"`
+	Score    int64  `json:"score"`
+}
+
+type FreezeResult struct {
+	WindowSec          float64 `json:"window_sec"`
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	Requests           int64   `json:"requests"`
+	Errors             int     `json:"errors"`
+	ErrorRate          float64 `json:"error_rate"`
+	Frozen             bool    `json:"frozen"`
+	DiscardedScore     int64   `json:"discarded_score"`
 }
 
 type Job struct {
 	ID       int    `json:"id"`
 	TeamID   int    `json:"team_id"`
 	TargetIP string `json:"target_ip"`
+
+	portal string // the portal which the job was acquired from
 }
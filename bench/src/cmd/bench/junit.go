@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"time"
+
+	"bench"
+)
+
+type preTestResult struct {
+	Name     string
+	Duration time.Duration
+	Err      error
+	Errors   []error // CheckerErrors recorded while running the function
+}
+
+var preTestResults []preTestResult
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// Records the result of a preTest function with the CheckerErrors appended since errorsBefore
+func recordPreTestResult(name string, d time.Duration, err error, errorsBefore int) {
+	errs := bench.GetCheckerErrors()
+	if len(errs) < errorsBefore {
+		errorsBefore = len(errs)
+	}
+	preTestResults = append(preTestResults, preTestResult{name, d, err, errs[errorsBefore:]})
+}
+
+// Writes preTest results as a JUnit XML file. One test case per check function.
+func writeJUnit(path string, result *BenchResult) error {
+	suite := junitTestSuite{
+		Name:      "preTest",
+		Timestamp: result.StartTime.Format("2006-01-02T15:04:05"),
+	}
+
+	ran := map[string]bool{}
+	for _, r := range preTestResults {
+		ran[r.Name] = true
+		tc := junitTestCase{Name: r.Name, ClassName: "preTest", Time: r.Duration.Seconds()}
+		if r.Err != nil {
+			body := ""
+			for _, e := range r.Errors {
+				body += e.Error() + "\n"
+			}
+			tc.Failure = &junitFailure{Message: r.Err.Error(), Type: failureType(r.Err), Body: body}
+			suite.Failures++
+		}
+		suite.Time += tc.Time
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	// requestInitialize() failed before any check function ran
+	if len(preTestResults) == 0 && result.Message != "" && !result.Pass {
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      "initialize",
+			ClassName: "preTest",
+			Failure:   &junitFailure{Message: result.Message, Type: "initialize"},
+		})
+		suite.Failures++
+	}
+
+	for _, f := range append(append([]benchFunc{}, checkFuncs...), everyCheckFuncs...) {
+		if ran[f.Name] {
+			continue
+		}
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      f.Name,
+			ClassName: "preTest",
+			Skipped:   &junitSkipped{Message: bench.Msg("先行するチェックが失敗したため実行されませんでした。")},
+		})
+		suite.Skipped++
+	}
+	suite.Tests = len(suite.Cases)
+
+	b, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(b, '\n')...), 0644)
+}
+
+func failureType(err error) string {
+	if cerr, ok := err.(*bench.CheckerError); ok {
+		if cerr.IsTimeout() {
+			return "timeout"
+		}
+		if cerr.IsFatal() {
+			return "fatal"
+		}
+	}
+	return "error"
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"bench"
+)
+
+func getLatencyClassResults() []LatencyClassResult {
+	var results []LatencyClassResult
+	for _, stat := range bench.GetLatencyClassStats() {
+		r := LatencyClassResult{
+			Name:      stat.Name,
+			DelayMs:   int64(stat.Delay / time.Millisecond),
+			Requests:  stat.Requests,
+			LatencyMs: float64(stat.Latency) / float64(time.Millisecond),
+			Score:     sumScoreCounts(stat.Counts).Score(),
+		}
+		log.Printf("latency class %s (+%dms): requests:%d latency:%.1fms score:%d\n", r.Name, r.DelayMs, r.Requests, r.LatencyMs, r.Score)
+		results = append(results, r)
+	}
+	return results
+}
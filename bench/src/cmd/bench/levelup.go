@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"bench"
+	"bench/parameter"
+)
+
+// Reasons why the load level must not be raised now. Rather than any error or slow response, the
+// error rates and the latency percentiles of the last LoadLevelUpWindow are looked at, so that a
+// one-off hiccup does not stop the load while a steady degradation of an endpoint does.
+func getLevelUpBlockers() (errs []string, slows []string) {
+	var requests, errors int64
+	for _, stat := range bench.GetWindowEndpointStats() {
+		requests += stat.Requests
+		errors += stat.Errors
+		if stat.Requests < parameter.LoadLevelUpMinRequests {
+			continue
+		}
+
+		if rate := 1 - stat.Availability(); rate > parameter.LoadLevelUpMaxErrorRate {
+			errs = append(errs, fmt.Sprintf("%s error rate %.1f%% (%d/%d)", stat.Endpoint, rate*100, stat.Errors, stat.Requests))
+		}
+		path := stat.Endpoint[strings.IndexByte(stat.Endpoint, '|')+1:]
+		if p := stat.Percentile(parameter.LoadLevelUpPercentile); p > bench.SlowThresholdOf(path) {
+			slows = append(slows, fmt.Sprintf("%s p%g %dms", stat.Endpoint, parameter.LoadLevelUpPercentile, p.Nanoseconds()/1e6))
+		}
+	}
+	if len(errs) == 0 && requests > 0 && float64(errors)/float64(requests) > parameter.LoadLevelUpMaxErrorRate {
+		errs = append(errs, fmt.Sprintf("error rate %.1f%% (%d/%d)", float64(errors)/float64(requests)*100, errors, requests))
+	}
+
+	if n := bench.CountInFlightSlowRequests(parameter.LoadLevelUpLookback); n >= parameter.LoadLevelUpSlowRequests {
+		paths, _ := bench.GetRecentSlowPaths(parameter.LoadLevelUpLookback)
+		slows = append(slows, fmt.Sprintf("%d slow requests in flight %s", n, bench.FormatSlowPaths(paths)))
+	}
+	return errs, slows
+}
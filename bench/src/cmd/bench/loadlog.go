@@ -0,0 +1,20 @@
+package main
+
+import "sync"
+
+// loadLogs is written by goroutines running alongside the load, e.g. the health checks of remotes
+var loadLogsMtx sync.Mutex
+
+func appendLoadLog(msg string) {
+	loadLogsMtx.Lock()
+	defer loadLogsMtx.Unlock()
+
+	loadLogs = append(loadLogs, msg)
+}
+
+func getLoadLogs() []string {
+	loadLogsMtx.Lock()
+	defer loadLogsMtx.Unlock()
+
+	return append([]string(nil), loadLogs...)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"bench"
+)
+
+// Existing call sites keep using the log package with "debug:", "warn:", ... prefixes on the message
+// (as colog did). slogWriter is installed as the output of the log package and turns every line into
+// a slog record with the level taken from the prefix, tagged with the job ID, the scenario running
+// the call and the source position.
+var logLevelPrefixes = []struct {
+	prefix string
+	level  slog.Level
+}{
+	{"trace:", slog.LevelDebug},
+	{"debug:", slog.LevelDebug},
+	{"info:", slog.LevelInfo},
+	{"warn:", slog.LevelWarn},
+	{"error:", slog.LevelError},
+	{"alert:", slog.LevelError},
+}
+
+type slogWriter struct {
+	logger *slog.Logger
+}
+
+func (w *slogWriter) Write(b []byte) (int, error) {
+	msg := strings.TrimSuffix(string(b), "\n")
+	level := slog.LevelInfo
+	for _, p := range logLevelPrefixes {
+		if strings.HasPrefix(msg, p.prefix) {
+			level = p.level
+			msg = strings.TrimSpace(strings.TrimPrefix(msg, p.prefix))
+			break
+		}
+	}
+
+	ctx := context.Background()
+	if !w.logger.Enabled(ctx, level) {
+		return len(b), nil
+	}
+
+	attrs := []slog.Attr{slog.String("source", logCallerSource())}
+	if scenario := bench.CallerScenario(); scenario != "" {
+		attrs = append(attrs, slog.String("scenario", scenario))
+	}
+	w.logger.LogAttrs(ctx, level, msg, attrs...)
+	return len(b), nil
+}
+
+// Returns the position which called the log package
+func logCallerSource() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log.") {
+			return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	if err != nil {
+		return level, fmt.Errorf("invalid -log-level %q", s)
+	}
+	return level, nil
+}
+
+func setupLogging(w io.Writer, format string, level slog.Level, jobID string) error {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid -log-format %q (text or json)", format)
+	}
+
+	logger := slog.New(handler).With(slog.String("job_id", jobID))
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(&slogWriter{logger: logger})
+	return nil
+}
+
+func init() {
+	// Until the flags are parsed
+	setupLogging(os.Stderr, "text", slog.LevelInfo, "")
+}
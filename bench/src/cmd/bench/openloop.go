@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"bench"
+	"bench/parameter"
+)
+
+// Open-loop load model: load scenarios are started at a fixed arrival rate regardless of
+// how fast the target responds. Unlike the closed-loop goroutines of loadMain whose throughput
+// collapses when the target slows down, arrivals keep coming and pile up as in-flight requests.
+
+var arrivalRate float64 // scenarios per second, 0 to use the closed-loop model
+
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := math.Max(1, rate/10) // allow 100ms worth of burst
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Blocks until a token is available. Not goroutine safe.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		now := time.Now()
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			return nil
+		}
+
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func openLoopMain(ctx context.Context, state *bench.State) {
+	var inFlight, maxInFlight, dropped int64
+	loadStartAt := time.Now()
+
+	go func() {
+		bucket := newTokenBucket(arrivalRate)
+		for bucket.Wait(ctx) == nil {
+			if acquireWorkers(1) == 0 {
+				atomic.AddInt64(&dropped, 1)
+				continue
+			}
+			go func() {
+				defer releaseWorker()
+				n := atomic.AddInt64(&inFlight, 1)
+				defer atomic.AddInt64(&inFlight, -1)
+				for {
+					m := atomic.LoadInt64(&maxInFlight)
+					if n <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+						break
+					}
+				}
+
+				loadFunc := loadFuncs[rand.Intn(len(loadFuncs))]
+				t := time.Now()
+				err := loadFunc.Run(bench.WithThinkTime(ctx), state)
+				log.Println("debug: openLoop:", loadFunc.Name, time.Since(t))
+
+				if err != nil {
+					// バリデーションシナリオを悪用してスコアブーストさせないためエラーのときは少し待つ
+					time.Sleep(parameter.WaitOnError)
+				}
+			}()
+		}
+	}()
+
+	go runScoreTimeline(ctx, loadStartAt)
+
+	ticker := time.NewTicker(parameter.LoadLevelUpInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sampleReservations(state, loadStartAt)
+			sampleLoadLevel(loadStartAt, float64(atomic.LoadInt64(&inFlight)))
+			log.Printf("debug: arrivalRate:%v inFlight:%d runtime.NumGoroutines():%d\n", arrivalRate, atomic.LoadInt64(&inFlight), runtime.NumGoroutine())
+		case <-ctx.Done():
+			// ベンチ終了、このタイミングでエラーの収集をやめる。
+			bench.GuardCheckerError(true)
+			log.Println("Open-loop load finished. max in-flight scenarios:", atomic.LoadInt64(&maxInFlight), "dropped by max-workers:", atomic.LoadInt64(&dropped))
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+
+	"bench"
+)
+
+var (
+	errorPenaltyRate float64 // deducted ratio of the score per non-fatal error
+	errorPenaltyCap  float64 // upper limit of the total deducted ratio
+)
+
+type PenaltyItem struct {
+	Error    string `json:"error"`
+	Count    int    `json:"count"`
+	Deducted int64  `json:"deducted"`
+}
+
+type PenaltyResult struct {
+	RatePerError float64       `json:"rate_per_error"`
+	Cap          float64       `json:"cap"`
+	Errors       int           `json:"errors"`
+	Rate         float64       `json:"rate"` // total deducted ratio after the cap
+	Deducted     int64         `json:"deducted"`
+	Items        []PenaltyItem `json:"items"`
+}
+
+// Deducts errorPenaltyRate of the score per non-fatal checker error, up to errorPenaltyCap in total.
+// Deductions are itemized by the code, the endpoint and the reason of the errors as summarizeErrors
+// does, since the messages differ by their time and request. Returns nil if the penalty is disabled.
+func applyErrorPenalty(score int64) (int64, *PenaltyResult) {
+	if errorPenaltyRate <= 0 {
+		return score, nil
+	}
+
+	errs := bench.GetCheckerErrorDetails()
+
+	r := &PenaltyResult{
+		RatePerError: errorPenaltyRate,
+		Cap:          errorPenaltyCap,
+		Errors:       len(errs),
+		Rate:         errorPenaltyRate * float64(len(errs)),
+	}
+	if r.Rate > errorPenaltyCap {
+		r.Rate = errorPenaltyCap
+	}
+	if r.Errors == 0 || score <= 0 {
+		return score, r
+	}
+
+	// Each error deducts the same amount so that the items sum up to the total after the cap
+	perError := float64(score) * r.Rate / float64(r.Errors)
+	for _, s := range summarizeErrors(errs) {
+		deducted := int64(perError * float64(s.Count))
+		r.Items = append(r.Items, PenaltyItem{Error: s.label(), Count: s.Count, Deducted: deducted})
+		r.Deducted += deducted
+	}
+
+	appendLoadLog(bench.Msgf("エラーが%d件発生したため、スコアから%.1f%%(%d)を減点しました。", r.Errors, r.Rate*100, r.Deducted))
+	log.Printf("error penalty: errors:%d rate:%.4f deducted:%d\n", r.Errors, r.Rate, r.Deducted)
+	return score - r.Deducted, r
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"time"
+)
+
+// CPU profile of the whole run and heap/goroutine profiles at the end are written to -tempdir,
+// so that bench-side bottlenecks can be investigated after the run on any worker machine.
+var (
+	profileDir     string
+	profilePrefix  string
+	cpuProfileFile *os.File
+)
+
+func startProfiling(dir, jobID string) {
+	if dir == "" {
+		return
+	}
+	profileDir = dir
+	profilePrefix = fmt.Sprintf("isucon8q-bench-%d", time.Now().Unix())
+	if jobID != "" {
+		profilePrefix += "-" + jobID
+	}
+
+	path := filepath.Join(profileDir, profilePrefix+"-cpu.pprof")
+	f, err := os.Create(path)
+	if err != nil {
+		log.Println("warn: failed to start cpu profile", err)
+		return
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		log.Println("warn: failed to start cpu profile", err)
+		f.Close()
+		return
+	}
+	cpuProfileFile = f
+}
+
+// Stops the CPU profile, writes the other profiles and returns their paths by profile name
+func captureProfiles() map[string]string {
+	if profileDir == "" {
+		return nil
+	}
+	profiles := map[string]string{}
+
+	if cpuProfileFile != nil {
+		pprof.StopCPUProfile()
+		cpuProfileFile.Close()
+		profiles["cpu"] = cpuProfileFile.Name()
+		cpuProfileFile = nil
+	}
+
+	for _, name := range []string{"heap", "goroutine"} {
+		path := filepath.Join(profileDir, profilePrefix+"-"+name+".pprof")
+		err := func() error {
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return pprof.Lookup(name).WriteTo(f, 0)
+		}()
+		if err != nil {
+			log.Println("warn: failed to write", name, "profile", err)
+			continue
+		}
+		profiles[name] = path
+	}
+
+	log.Println("profiles saved to", profiles)
+	return profiles
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"bench"
+	"bench/counter"
+)
+
+type progressEvent struct {
+	Time      time.Time        `json:"time"`
+	Elapsed   float64          `json:"elapsed"`
+	Score     int64            `json:"score"` // estimated from the current counters
+	LoadLevel int64            `json:"load_level"`
+	Counters  map[string]int64 `json:"counters"`
+	NumErrors int              `json:"num_errors"`
+	LastError string           `json:"last_error,omitempty"`
+}
+
+// Writes one JSON line per second until ctx is done. path "-" means stdout.
+func writeProgress(ctx context.Context, path string) {
+	var w io.Writer
+	if path == "-" {
+		w = os.Stdout
+	} else {
+		f, err := os.Create(path)
+		if err != nil {
+			log.Println("warn: failed to create progress file", err)
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		snapshot := counter.Snapshot().Map()
+		counters := map[string]int64{}
+		for key, value := range snapshot {
+			counters[key.String()] = value
+		}
+		ev := progressEvent{
+			Time:      time.Now(),
+			Elapsed:   time.Since(benchStartAt).Seconds(),
+			Score:     sumScoreCounts(snapshot).Score(),
+			LoadLevel: snapshot[loadLevelUpKey],
+			Counters:  counters,
+			NumErrors: len(bench.GetCheckerErrors()),
+		}
+		if err, _ := bench.GetLastCheckerError(); err != nil {
+			ev.LastError = err.Error()
+		}
+		err := enc.Encode(ev)
+		if err != nil {
+			log.Println("warn: failed to write progress", err)
+			return
+		}
+	}
+}
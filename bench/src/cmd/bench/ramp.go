@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"bench/parameter"
+)
+
+// Ramp profiles decide how many load goroutines run at each load level.
+//
+//	exponential[:ratio]        multiply by ratio on every level up (default, ratio=LoadLevelUpRatio)
+//	linear[:n]                 add n goroutines on every level up
+//	step[:levels[:n]]          add n goroutines once every levels level ups
+//	custom:n0,n1,n2,...        use ni goroutines at load level i, the last value is kept after that
+type rampProfile struct {
+	Name    string
+	Initial float64
+	next    func(level int, numGoroutines float64) float64
+}
+
+// Returns the number of goroutines for the given (already increased) load level
+func (r *rampProfile) Next(level int, numGoroutines float64) float64 {
+	return r.next(level, numGoroutines)
+}
+
+func parseRampFloat(s string, def float64) (float64, error) {
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid ramp parameter %q", s)
+	}
+	return v, nil
+}
+
+func parseRampProfile(spec string) (*rampProfile, error) {
+	args := strings.Split(spec, ":")
+	name := args[0]
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+
+	initial := parameter.LoadInitialNumGoroutines
+
+	switch name {
+	case "", "exponential":
+		ratio, err := parseRampFloat(arg(1), parameter.LoadLevelUpRatio)
+		if err != nil {
+			return nil, err
+		}
+		if ratio <= 1 {
+			return nil, fmt.Errorf("invalid ramp ratio %q (usage: exponential[:ratio], ratio is more than 1)", arg(1))
+		}
+		return &rampProfile{"exponential", initial, func(level int, n float64) float64 {
+			return n * ratio
+		}}, nil
+	case "linear":
+		step, err := parseRampFloat(arg(1), parameter.LoadInitialNumGoroutines)
+		if err != nil {
+			return nil, err
+		}
+		return &rampProfile{"linear", initial, func(level int, n float64) float64 {
+			return n + step
+		}}, nil
+	case "step":
+		levels, err := parseRampFloat(arg(1), 5)
+		if err != nil {
+			return nil, err
+		}
+		if levels < 1 || levels != math.Trunc(levels) {
+			return nil, fmt.Errorf("invalid ramp step levels %q (usage: step[:levels[:n]], levels is an integer of 1 or more)", arg(1))
+		}
+		step, err := parseRampFloat(arg(2), parameter.LoadInitialNumGoroutines*2)
+		if err != nil {
+			return nil, err
+		}
+		return &rampProfile{"step", initial, func(level int, n float64) float64 {
+			if level%int(levels) == 0 {
+				return n + step
+			}
+			return n
+		}}, nil
+	case "custom":
+		var counts []float64
+		for _, s := range strings.Split(arg(1), ",") {
+			v, err := parseRampFloat(strings.TrimSpace(s), 0)
+			if err != nil || v == 0 {
+				return nil, fmt.Errorf("invalid custom ramp %q", spec)
+			}
+			counts = append(counts, v)
+		}
+		return &rampProfile{"custom", counts[0], func(level int, n float64) float64 {
+			if level < len(counts) {
+				return counts[level]
+			}
+			return counts[len(counts)-1]
+		}}, nil
+	}
+
+	return nil, fmt.Errorf("unknown ramp profile %q", name)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"bench"
+)
+
+// Re-issues the requests recorded by -record against the remotes after /initialize, and exits with
+// exitFail if any of them got a status code different from the recording
+func runReplay(ctx context.Context, path string) {
+	header, requests, err := bench.ReadRecording(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Println("Replaying", len(requests), "requests recorded at", header.StartedAt.Format("2006-01-02 15:04:05"), "with seed", header.Seed)
+	if header.AppHost != bench.TorbAppHost {
+		log.Println("warn: recorded with -app-host", header.AppHost, "but replaying with", bench.TorbAppHost)
+	}
+
+	err = requestInitializeWithRetry(ctx, bench.GetRandomTargetURL())
+	if err != nil {
+		log.Fatalln("requestInitialize() failed", err)
+	}
+
+	mismatches := bench.Replay(ctx, requests)
+	for _, m := range mismatches {
+		log.Println("warn: replay mismatch", m)
+	}
+	log.Printf("Replayed %d requests, %d mismatches", len(requests), len(mismatches))
+	if len(mismatches) > 0 {
+		os.Exit(exitFail)
+	}
+}
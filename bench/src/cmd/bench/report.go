@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"bench/counter"
+)
+
+type loadLevelSample struct {
+	Elapsed    float64 // seconds since the load started
+	LoadLevel  int64
+	Goroutines float64
+}
+
+var (
+	loadLevelSampleMtx sync.Mutex
+	loadLevelSamples   []loadLevelSample
+)
+
+func sampleLoadLevel(loadStartAt time.Time, numGoroutines float64) {
+	loadLevelSampleMtx.Lock()
+	defer loadLevelSampleMtx.Unlock()
+
+	loadLevelSamples = append(loadLevelSamples, loadLevelSample{
+		Elapsed:    time.Since(loadStartAt).Seconds(),
+		LoadLevel:  counter.Get(loadLevelUpKey),
+		Goroutines: numGoroutines,
+	})
+}
+
+func getLoadLevelSamples() []loadLevelSample {
+	loadLevelSampleMtx.Lock()
+	defer loadLevelSampleMtx.Unlock()
+
+	samples := make([]loadLevelSample, len(loadLevelSamples))
+	copy(samples, loadLevelSamples)
+	return samples
+}
+
+type chartPoint struct {
+	X, Y float64
+}
+
+// Renders a line chart as an inline SVG so that the report has no external dependencies
+func svgLineChart(title string, points []chartPoint) template.HTML {
+	const (
+		width   = 640
+		height  = 200
+		padding = 40
+	)
+
+	var maxX, maxY float64
+	for _, p := range points {
+		if p.X > maxX {
+			maxX = p.X
+		}
+		if p.Y > maxY {
+			maxY = p.Y
+		}
+	}
+	if maxX == 0 {
+		maxX = 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+
+	var polyline bytes.Buffer
+	for _, p := range points {
+		x := padding + p.X/maxX*(width-2*padding)
+		y := height - padding - p.Y/maxY*(height-2*padding)
+		fmt.Fprintf(&polyline, "%.1f,%.1f ", x, y)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d">`, width, height)
+	fmt.Fprintf(&buf, `<text x="%d" y="20" font-size="14">%s</text>`, padding, template.HTMLEscapeString(title))
+	fmt.Fprintf(&buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, padding, height-padding, width-padding, height-padding)
+	fmt.Fprintf(&buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, padding, padding, padding, height-padding)
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" font-size="10" text-anchor="end">%g</text>`, padding-4, padding+4, maxY)
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" font-size="10" text-anchor="end">0</text>`, padding-4, height-padding)
+	fmt.Fprintf(&buf, `<text x="%d" y="%d" font-size="10" text-anchor="end">%.0fs</text>`, width-padding, height-padding+14, maxX)
+	fmt.Fprintf(&buf, `<polyline fill="none" stroke="#3572b0" stroke-width="2" points="%s"/>`, polyline.String())
+	buf.WriteString(`</svg>`)
+
+	return template.HTML(buf.String())
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>isucon8q bench report {{.Result.JobID}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+td.num { text-align: right; }
+.pass { color: #2a7d2a; } .fail { color: #c0392b; }
+</style>
+</head>
+<body>
+<h1>Benchmark Report</h1>
+<table>
+<tr><th>Result</th><td>{{if .Result.Pass}}<span class="pass">PASS</span>{{else}}<span class="fail">FAIL</span>{{end}}{{if .Result.Aborted}} (aborted){{end}}</td></tr>
+<tr><th>Score</th><td class="num">{{.Result.Score}}</td></tr>
+<tr><th>Message</th><td>{{.Result.Message}}</td></tr>
+<tr><th>Load level</th><td class="num">{{.Result.LoadLevel}}</td></tr>
+<tr><th>Cancel/Reserve ratio</th><td class="num">{{printf "%.3f" .Result.CancelReserveRatio}}</td></tr>
+<tr><th>Remotes</th><td>{{.Result.IPAddrs}}</td></tr>
+<tr><th>Start</th><td>{{.Result.StartTime.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><th>End</th><td>{{.Result.EndTime.Format "2006-01-02 15:04:05"}}</td></tr>
+</table>
+
+<h2>Timeline</h2>
+{{.ScoreChart}}
+{{.LoadLevelChart}}
+{{.GoroutinesChart}}
+{{.OutstandingChart}}
+
+<h2>Load log</h2>
+<ul>{{range .Result.Logs}}<li>{{.}}</li>{{end}}</ul>
+
+<h2>Errors ({{.Result.NumErrors}})</h2>
+<ul>{{range .Result.Errors}}<li><code>{{.Code}}</code> {{.Message}} ×{{.Count}}</li>{{end}}</ul>
+
+<h2>Slowest requests</h2>
+<table>{{range .Result.SlowPaths}}<tr><td>{{.Path}}</td><td class="num">{{printf "%.0f" .LatencyMs}}ms</td><td>{{.Time.Format "15:04:05"}}</td></tr>{{end}}</table>
+
+<h2>Request counts</h2>
+<table>{{range .Requests}}<tr><td>{{.Key}}</td><td class="num">{{.Value}}</td></tr>{{end}}</table>
+
+<h2>Other counts</h2>
+<table>{{range .Others}}<tr><td>{{.Key}}</td><td class="num">{{.Value}}</td></tr>{{end}}</table>
+</body>
+</html>
+`))
+
+// Renders the result, counter summary, errors and timeline into a single static HTML file
+func writeReport(path string, result *BenchResult) error {
+	var scores, levels, goroutines, outstanding []chartPoint
+	for _, b := range result.ScoreBuckets {
+		scores = append(scores, chartPoint{b.Elapsed, float64(b.Score)})
+	}
+	for _, s := range getLoadLevelSamples() {
+		levels = append(levels, chartPoint{s.Elapsed, float64(s.LoadLevel)})
+		goroutines = append(goroutines, chartPoint{s.Elapsed, s.Goroutines})
+	}
+	for _, s := range result.ReservationTimeline {
+		outstanding = append(outstanding, chartPoint{s.Elapsed, float64(s.Outstanding)})
+	}
+
+	requests, others := summarizeCounters()
+
+	var buf bytes.Buffer
+	err := reportTemplate.Execute(&buf, map[string]interface{}{
+		"Result":           result,
+		"Requests":         requests,
+		"Others":           others,
+		"ScoreChart":       svgLineChart("Score per second", scores),
+		"LoadLevelChart":   svgLineChart("Load level", levels),
+		"GoroutinesChart":  svgLineChart("Load goroutines", goroutines),
+		"OutstandingChart": svgLineChart("Outstanding reservations", outstanding),
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"bench"
+)
+
+type ReservationSample struct {
+	Elapsed     float64 `json:"elapsed"` // seconds since the load started
+	Reserved    uint    `json:"reserved"`
+	Canceled    uint    `json:"canceled"`
+	Outstanding int64   `json:"outstanding"` // reserved - canceled
+}
+
+var (
+	reservationSampleMtx sync.Mutex
+	reservationSamples   []ReservationSample
+)
+
+func sampleReservations(state *bench.State, loadStartAt time.Time) {
+	reserved, canceled := state.GetReserveCancelCount()
+
+	reservationSampleMtx.Lock()
+	defer reservationSampleMtx.Unlock()
+
+	reservationSamples = append(reservationSamples, ReservationSample{
+		Elapsed:     time.Since(loadStartAt).Seconds(),
+		Reserved:    reserved,
+		Canceled:    canceled,
+		Outstanding: int64(reserved) - int64(canceled),
+	})
+}
+
+func getReservationSamples() []ReservationSample {
+	reservationSampleMtx.Lock()
+	defer reservationSampleMtx.Unlock()
+
+	samples := make([]ReservationSample, len(reservationSamples))
+	copy(samples, reservationSamples)
+	return samples
+}
+
+// Returns the realized cancel:reserve ratio of the run
+func realizedCancelReserveRatio(state *bench.State) float64 {
+	reserved, canceled := state.GetReserveCancelCount()
+	if reserved == 0 {
+		return 0
+	}
+	return float64(canceled) / float64(reserved)
+}
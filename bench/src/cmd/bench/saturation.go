@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"bench"
+	"bench/parameter"
+)
+
+// Watches the resources of the bench host itself. While the bench is saturated the load level is
+// not raised, and the result is flagged as BenchBound so that a score capped by a weak bench host
+// can be told apart from a slow app.
+var (
+	saturationMtx     sync.Mutex
+	saturatedAt       time.Time
+	saturationReason  string
+	saturationReasons []string
+)
+
+func watchBenchSaturation(ctx context.Context) {
+	ticker := time.NewTicker(parameter.BenchSaturationInterval)
+	defer ticker.Stop()
+
+	lastCPU, lastAt := processCPUTime(), time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		cpu, at := processCPUTime(), time.Now()
+		usage := float64(cpu-lastCPU) / float64(at.Sub(lastAt)) / float64(runtime.NumCPU())
+		lastCPU, lastAt = cpu, at
+
+		var reasons []string
+		if usage >= parameter.BenchCPUThreshold {
+			reasons = append(reasons, bench.Msgf("CPU使用率 %.0f%%", usage*100))
+		}
+		if avail, total := memAvailable(); total > 0 && float64(avail)/float64(total) < parameter.BenchMemAvailableThreshold {
+			reasons = append(reasons, bench.Msgf("空きメモリ %dMB/%dMB", avail>>20, total>>20))
+		}
+		if n := runtime.NumGoroutine(); n >= parameter.BenchMaxGoroutines {
+			reasons = append(reasons, bench.Msgf("goroutine数 %d", n))
+		}
+		if used, total := ephemeralPortUsage(); total > 0 && float64(used)/float64(total) >= parameter.BenchPortUsageThreshold {
+			reasons = append(reasons, bench.Msgf("ポート使用数 %d/%d", used, total))
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		reason := strings.Join(reasons, ", ")
+		saturationMtx.Lock()
+		first := saturatedAt.IsZero()
+		saturatedAt = at
+		saturationReason = reason
+		for _, r := range reasons {
+			kind := strings.Fields(r)[0]
+			if !containsPrefix(saturationReasons, kind) {
+				saturationReasons = append(saturationReasons, r)
+			}
+		}
+		saturationMtx.Unlock()
+
+		if first {
+			appendLoadLog(bench.Msgf("%v ベンチマーカーのリソースが不足しています。スコアはベンチマーカーの性能で頭打ちになっている可能性があります。(%s)", at.Format("01/02 15:04:05"), reason))
+		}
+		log.Println("warn: bench host is saturated", reason)
+	}
+}
+
+func containsPrefix(list []string, prefix string) bool {
+	for _, s := range list {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the reason if the bench host was saturated within the lookback window
+func getRecentSaturation(lookback time.Duration) (string, bool) {
+	saturationMtx.Lock()
+	defer saturationMtx.Unlock()
+	if saturatedAt.IsZero() || time.Since(saturatedAt) >= lookback {
+		return "", false
+	}
+	return saturationReason, true
+}
+
+// Returns the first observation of each kind of saturation, or nil if the bench was never saturated
+func getSaturationReasons() []string {
+	saturationMtx.Lock()
+	defer saturationMtx.Unlock()
+	return append([]string(nil), saturationReasons...)
+}
+
+func processCPUTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// Reads MemAvailable and MemTotal in bytes from /proc/meminfo, or zeros if unavailable
+func memAvailable() (avail, total uint64) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var kb uint64
+		line := scanner.Text()
+		if _, err := fmt.Sscanf(line, "MemTotal: %d kB", &kb); err == nil {
+			total = kb << 10
+		} else if _, err := fmt.Sscanf(line, "MemAvailable: %d kB", &kb); err == nil {
+			avail = kb << 10
+		}
+	}
+	return avail, total
+}
+
+// Counts the TCP sockets of the host against the size of the ephemeral port range, or zeros if unavailable
+func ephemeralPortUsage() (used, total int) {
+	b, err := ioutil.ReadFile("/proc/sys/net/ipv4/ip_local_port_range")
+	if err != nil {
+		return 0, 0
+	}
+	var low, high int
+	if _, err := fmt.Sscanf(string(b), "%d %d", &low, &high); err != nil {
+		return 0, 0
+	}
+
+	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// the first line is the header
+		if n := strings.Count(string(b), "\n") - 1; n > 0 {
+			used += n
+		}
+	}
+	return used, high - low + 1
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"bench/counter"
+)
+
+type ScoreBucket struct {
+	Elapsed   float64     `json:"elapsed"` // seconds since the load started
+	LoadLevel int64       `json:"load_level"`
+	Score     int64       `json:"score"`  // score gained in this bucket
+	Counts    scoreCounts `json:"counts"` // request counts in this bucket
+}
+
+var (
+	scoreTimelineMtx sync.Mutex
+	scoreTimeline    []ScoreBucket
+	lastScoreCounts  counter.Counts
+)
+
+// Samples the score into a bucket every second of the load until ctx is done, independently of
+// the load level up interval
+func runScoreTimeline(ctx context.Context, loadStartAt time.Time) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sampleScore(loadStartAt)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Records the counters since the last call as a bucket
+func sampleScore(loadStartAt time.Time) {
+	snapshot := counter.Snapshot()
+
+	scoreTimelineMtx.Lock()
+	defer scoreTimelineMtx.Unlock()
+
+	// the scores are subtracted rather than scored from the counts in the bucket, so that the buckets
+	// add up to the total score though static files are scored by the hundred
+	scoreTimeline = append(scoreTimeline, ScoreBucket{
+		Elapsed:   snapshot.Time.Sub(loadStartAt).Seconds(),
+		LoadLevel: snapshot.Get(loadLevelUpKey),
+		Score:     sumScoreCounts(snapshot.Map()).Score() - sumScoreCounts(lastScoreCounts.Map()).Score(),
+		Counts:    sumScoreCounts(snapshot.Sub(lastScoreCounts).Map()),
+	})
+	lastScoreCounts = snapshot
+}
+
+func getScoreTimeline() (scores []int64, buckets []ScoreBucket) {
+	scoreTimelineMtx.Lock()
+	defer scoreTimelineMtx.Unlock()
+
+	buckets = make([]ScoreBucket, len(scoreTimeline))
+	copy(buckets, scoreTimeline)
+	for _, b := range buckets {
+		scores = append(scores, b.Score)
+	}
+	return
+}
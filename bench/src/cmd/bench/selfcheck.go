@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"bench"
+	"bench/fakeserver"
+)
+
+// Runs every scenario concurrently against an in-process fake server for benchDuration.
+// This is not meant to score anything. Checks against the fake server may fail,
+// but State and counter are exercised with all scenarios active so that the race detector
+// can catch data races before the benchmarker is deployed.
+func runSelfCheckRace(staticDir string) {
+	if !raceEnabled {
+		log.Fatalln("-selfcheck-race requires a binary built with -race (make selfcheck-race)")
+	}
+
+	server := fakeserver.New()
+	server.StaticDir = staticDir
+	addr, stop := server.Start()
+	defer stop()
+	log.Println("selfcheck-race: fake server is listening on", addr)
+
+	err := bench.SetTargetHosts([]string{addr})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	// The opt-in load scenarios are run too, with the weight 1 unless it is given
+	for _, weight := range []*int{&sessionWeight, &adminWeight, &churnWeight, &chaosWeight, &cancelRaceWeight, &herdWeight, &reportStreamWeight} {
+		if *weight == 0 {
+			*weight = 1
+		}
+	}
+	registerBenchFuncs()
+
+	state := new(bench.State)
+	state.Init()
+
+	ctx, cancel := context.WithTimeout(context.Background(), benchDuration)
+	defer cancel()
+
+	funcs := append(append(append([]benchFunc{}, checkFuncs...), everyCheckFuncs...), postTestFuncs...)
+
+	var wg sync.WaitGroup
+	for _, f := range funcs {
+		wg.Add(1)
+		go func(f benchFunc) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				err := f.Run(ctx, state)
+				if err != nil {
+					log.Println("debug: selfcheck-race:", f.Name, err)
+				}
+			}
+		}(f)
+	}
+
+	go loadMain(ctx, state)
+	wg.Wait()
+
+	printCounterSummary()
+	log.Println("selfcheck-race: finished. Data races, if any, are reported by the race detector above.")
+}
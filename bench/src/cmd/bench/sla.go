@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bench"
+)
+
+// SLA budgets applied to every endpoint. The run fails if any endpoint exceeds them.
+type slaSpec struct {
+	Percentiles  map[float64]time.Duration // e.g. 99 -> 500ms
+	Availability float64                   // e.g. 0.99, 0 if not set
+}
+
+var (
+	sla      *slaSpec
+	slaRules string
+)
+
+type SLAViolation struct {
+	Endpoint string `json:"endpoint"`
+	Rule     string `json:"rule"`
+	Actual   string `json:"actual"`
+	Requests int64  `json:"requests"`
+}
+
+type SLAResult struct {
+	Rules      string         `json:"rules"`
+	Pass       bool           `json:"pass"`
+	Violations []SLAViolation `json:"violations,omitempty"`
+}
+
+// Parses "p99=500ms,p50=100ms,avail=99%"
+func parseSLA(spec string) (*slaSpec, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	s := &slaSpec{Percentiles: map[float64]time.Duration{}}
+	for _, rule := range strings.Split(spec, ",") {
+		kv := strings.SplitN(rule, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid sla %q", rule)
+		}
+		switch {
+		case kv[0] == "avail":
+			v, err := strconv.ParseFloat(strings.TrimSuffix(kv[1], "%"), 64)
+			if err != nil || v <= 0 || 100 < v {
+				return nil, fmt.Errorf("invalid sla availability %q", rule)
+			}
+			s.Availability = v / 100
+		case strings.HasPrefix(kv[0], "p"):
+			p, err := strconv.ParseFloat(kv[0][1:], 64)
+			if err != nil || p <= 0 || 100 < p {
+				return nil, fmt.Errorf("invalid sla percentile %q", rule)
+			}
+			d, err := time.ParseDuration(kv[1])
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid sla latency %q", rule)
+			}
+			s.Percentiles[p] = d
+		default:
+			return nil, fmt.Errorf("invalid sla %q", rule)
+		}
+	}
+	return s, nil
+}
+
+func (s *slaSpec) check(spec string) *SLAResult {
+	percentiles := make([]float64, 0, len(s.Percentiles))
+	for p := range s.Percentiles {
+		percentiles = append(percentiles, p)
+	}
+	sort.Float64s(percentiles)
+
+	r := &SLAResult{Rules: spec}
+	for _, stat := range bench.GetEndpointStats() {
+		for _, p := range percentiles {
+			budget := s.Percentiles[p]
+			if latency := stat.Percentile(p); latency > budget {
+				r.Violations = append(r.Violations, SLAViolation{
+					Endpoint: stat.Endpoint,
+					Rule:     fmt.Sprintf("p%v<=%v", p, budget),
+					Actual:   latency.String(),
+					Requests: stat.Requests,
+				})
+			}
+		}
+		if s.Availability > 0 {
+			if avail := stat.Availability(); avail < s.Availability {
+				r.Violations = append(r.Violations, SLAViolation{
+					Endpoint: stat.Endpoint,
+					Rule:     fmt.Sprintf("avail>=%v%%", s.Availability*100),
+					Actual:   fmt.Sprintf("%.2f%%", avail*100),
+					Requests: stat.Requests,
+				})
+			}
+		}
+	}
+	r.Pass = len(r.Violations) == 0
+
+	for _, v := range r.Violations {
+		log.Printf("sla violation: %s %s actual:%s requests:%d\n", v.Endpoint, v.Rule, v.Actual, v.Requests)
+	}
+	return r
+}
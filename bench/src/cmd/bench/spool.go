@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	// wait before posting a spooled result again, doubled on every failure up to maxSpoolBackoff
+	spoolBackoff    = 30 * time.Second
+	maxSpoolBackoff = 30 * time.Minute
+)
+
+// A result which failed to be posted to the portal. It is written next to the result JSON in
+// -tempdir as <result>.spool, so that it survives restarts of the worker, and posted again on
+// later loops until the portal accepts it.
+type spooledResult struct {
+	Job       *Job      `json:"job"`
+	JSONPath  string    `json:"json_path"`
+	LogPath   string    `json:"log_path"`
+	Aborted   bool      `json:"aborted"`
+	Attempts  int       `json:"attempts"`
+	NextRetry time.Time `json:"next_retry"`
+}
+
+func spoolBackoffOf(attempts int) time.Duration {
+	d := spoolBackoff
+	for i := 1; i < attempts && d < maxSpoolBackoff; i++ {
+		d *= 2
+	}
+	if d > maxSpoolBackoff {
+		d = maxSpoolBackoff
+	}
+	return d
+}
+
+func writeSpool(path string, sr *spooledResult) error {
+	b, err := json.Marshal(sr)
+	if err != nil {
+		return err
+	}
+	// write and rename so that a crash does not leave a broken spool
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Spools the result of job which failed to be posted
+func spoolResult(job *Job, jsonPath, logPath string, aborted bool) {
+	sr := &spooledResult{
+		Job:       job,
+		JSONPath:  jsonPath,
+		LogPath:   logPath,
+		Aborted:   aborted,
+		Attempts:  1,
+		NextRetry: time.Now().Add(spoolBackoffOf(1)),
+	}
+	if err := writeSpool(jsonPath+".spool", sr); err != nil {
+		log.Println("warn: failed to spool the result of job", job.ID, err)
+		return
+	}
+	log.Println("Spooled the result of job", job.ID, "to retry after", spoolBackoffOf(1))
+}
+
+// Posts the spooled results in tempDir whose backoff has passed. The ones the portal accepts are
+// removed from the spool, and the others are posted again after a doubled backoff.
+func resendSpooledResults(tempDir string, post func(job *Job, jsonPath, logPath string, aborted bool) error) {
+	paths, err := filepath.Glob(filepath.Join(tempDir, "*.spool"))
+	if err != nil {
+		log.Println("warn:", err)
+		return
+	}
+
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Println("warn:", err)
+			continue
+		}
+		sr := new(spooledResult)
+		if err := json.Unmarshal(b, sr); err != nil || sr.Job == nil {
+			log.Println("warn: removing the broken spool", path, err)
+			os.Remove(path)
+			continue
+		}
+		if time.Now().Before(sr.NextRetry) {
+			continue
+		}
+
+		err = post(sr.Job, sr.JSONPath, sr.LogPath, sr.Aborted)
+		if err == nil {
+			log.Println("Posted the spooled result of job", sr.Job.ID, "after", sr.Attempts, "failures")
+			os.Remove(path)
+			continue
+		}
+
+		sr.Attempts++
+		backoff := spoolBackoffOf(sr.Attempts)
+		sr.NextRetry = time.Now().Add(backoff)
+		log.Println("warn: failed to post the spooled result of job", sr.Job.ID, err, "retry after", backoff)
+		if err := writeSpool(path, sr); err != nil {
+			log.Println("warn:", err)
+		}
+	}
+}
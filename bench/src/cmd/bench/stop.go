@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"bench"
+	"bench/parameter"
+)
+
+var (
+	maxErrors     int // 0 for no limit
+	failFast      bool
+	stopReasonMtx sync.Mutex
+	stopReason    string
+)
+
+// Cancels the benchmark like a signal does when the checker errors reach -max-errors, or 1 with
+// -fail-fast, so that a broken app is reported with the partial result without waiting for the end.
+func watchStopConditions(ctx context.Context, cancel context.CancelFunc) {
+	limit := maxErrors
+	if failFast {
+		limit = 1
+	}
+	if limit <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(parameter.StopConditionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		n := bench.CountCheckerErrors()
+		if n < limit {
+			continue
+		}
+
+		reason := bench.Msgf("エラーが%d件に達したため負荷走行を打ち切りました。", n)
+		log.Println("Stop condition met, aborting benchmark:", reason)
+		stopReasonMtx.Lock()
+		stopReason = reason
+		stopReasonMtx.Unlock()
+
+		// the requests canceled by the abort are not errors of the app
+		bench.GuardCheckerError(true)
+		cancel()
+		return
+	}
+}
+
+// Returns why the benchmark was stopped by watchStopConditions, or "" if it was not
+func getStopReason() string {
+	stopReasonMtx.Lock()
+	defer stopReasonMtx.Unlock()
+	return stopReason
+}
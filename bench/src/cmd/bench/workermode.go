@@ -17,6 +17,7 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -26,8 +27,113 @@ var (
 	errNoJob   = errors.New("No task")
 	hostname   = "unknown"
 	pathPrefix = "bench/"
+
+	// workermode exits after failing to get a job this many times in a row (about 10 minutes)
+	maxPortalFailures = 20
+
+	// interval of heartbeats with the job progress sent to the portal while a job runs
+	heartbeatInterval = 10 * time.Second
+
+	// sent as a bearer token on all portal requests
+	portalToken = ""
 )
 
+// Tracks consecutive failures of each portal so that workers keep running while one of them is down.
+// All portals are expected to share the same job queue.
+type portalSet struct {
+	mu       sync.Mutex
+	urls     []string
+	failures []int
+}
+
+func newPortalSet(spec string) *portalSet {
+	ps := new(portalSet)
+	for _, u := range strings.Split(spec, ",") {
+		u = strings.TrimSuffix(strings.TrimSpace(u), "/")
+		if u != "" {
+			ps.urls = append(ps.urls, u)
+		}
+	}
+	ps.failures = make([]int, len(ps.urls))
+	return ps
+}
+
+// Returns the portals to try in order: prefer first unless it is failing, then the healthiest ones
+func (ps *portalSet) candidates(prefer string) []string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	idx := make([]int, len(ps.urls))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return ps.failures[idx[a]] < ps.failures[idx[b]]
+	})
+
+	var urls []string
+	for _, i := range idx {
+		if ps.urls[i] == prefer && ps.failures[i] == 0 {
+			urls = append([]string{prefer}, urls...)
+		} else {
+			urls = append(urls, ps.urls[i])
+		}
+	}
+	return urls
+}
+
+func (ps *portalSet) mark(u string, ok bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for i := range ps.urls {
+		if ps.urls[i] != u {
+			continue
+		}
+		if ok {
+			if ps.failures[i] > 0 {
+				log.Println("Portal", u, "recovered")
+			}
+			ps.failures[i] = 0
+		} else {
+			ps.failures[i]++
+		}
+	}
+}
+
+func (ps *portalSet) String() string {
+	return strings.Join(ps.urls, ",")
+}
+
+type heartbeatResponse struct {
+	Success  bool `json:"success"`
+	Canceled bool `json:"canceled"`
+}
+
+type jobHeartbeat struct {
+	Hostname  string  `json:"hostname"`
+	Elapsed   float64 `json:"elapsed"` // seconds since the job started
+	Phase     string  `json:"phase"`   // "starting" until the benchmarker reports progress, then "running"
+	Score     int64   `json:"score"`
+	LoadLevel int64   `json:"load_level"`
+	NumErrors int     `json:"num_errors"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+// Returns the last line of the progress NDJSON written by the benchmarker, or nil if there is none yet
+func readLastProgress(path string) *progressEvent {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	ev := new(progressEvent)
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), ev); err != nil {
+		return nil
+	}
+	return ev
+}
+
 func updateHostname() {
 	name, err := os.Hostname()
 	if err == nil {
@@ -36,26 +142,34 @@ func updateHostname() {
 }
 
 func runWorkerMode(tempDir, portalUrl string) {
-	portalUrl = strings.TrimSuffix(portalUrl, "/")
+	portals := newPortalSet(portalUrl)
+	if len(portals.urls) == 0 {
+		log.Fatalln("No portal is specified")
+	}
 
 	for _, arg := range os.Args {
 		if strings.HasPrefix(arg, "-remotes") ||
-			strings.HasPrefix(arg, "-output") {
+			strings.HasPrefix(arg, "-output") ||
+			strings.HasPrefix(arg, "-progress") {
 			log.Fatalln("Cannot use the option", arg, "on workermode")
 		}
 	}
+	if portalToken == "" {
+		log.Println("warn: -portal-token is not set, the portal may reject the requests")
+	}
 
 	updateHostname()
 
 	var baseArgs []string
 	for _, arg := range os.Args {
-		if !strings.HasPrefix(arg, "-workermode") {
+		// the benchmarker itself does not talk to the portal, so keep the token out of its args and logs
+		if !strings.HasPrefix(arg, "-workermode") && !strings.HasPrefix(arg, "-portal-token") {
 			baseArgs = append(baseArgs, arg)
 		}
 	}
 
-	getUrl := func(path string) (*url.URL, error) {
-		u, err := url.Parse(portalUrl + path)
+	getUrl := func(base, path string) (*url.URL, error) {
+		u, err := url.Parse(base + path)
 		if err != nil {
 			return nil, err
 		}
@@ -65,16 +179,53 @@ func runWorkerMode(tempDir, portalUrl string) {
 		return u, nil
 	}
 
-	getJob := func() (*Job, error) {
-		u, err := getUrl("/" + pathPrefix + "job")
-		if err != nil {
-			return nil, err
+	// Sends the request built by newReq to the portals in turn until one of them answers without a 5xx.
+	// Returns the response and the portal which answered it.
+	doPortal := func(prefer string, newReq func(base string) (*http.Request, error)) (*http.Response, string, error) {
+		var lastErr error
+		for _, base := range portals.candidates(prefer) {
+			req, err := newReq(base)
+			if err != nil {
+				return nil, "", err
+			}
+			if portalToken != "" {
+				req.Header.Set("Authorization", "Bearer "+portalToken)
+			}
+
+			res, err := http.DefaultClient.Do(req)
+			if err == nil && res.StatusCode >= 500 {
+				res.Body.Close()
+				err = fmt.Errorf("%s: %s", base, res.Status)
+			}
+			if err != nil {
+				portals.mark(base, false)
+				lastErr = err
+				log.Println("warn: portal request failed, failing over", err)
+				continue
+			}
+
+			portals.mark(base, true)
+			if res.StatusCode == http.StatusUnauthorized {
+				res.Body.Close()
+				log.Fatalln("Portal rejected the request, check -portal-token", base)
+			}
+			return res, base, nil
 		}
+		return nil, "", lastErr
+	}
 
-		q := u.Query()
-		q.Set("hostname", hostname)
-		u.RawQuery = q.Encode()
-		res, err := http.Get(u.String())
+	getJob := func() (*Job, error) {
+		res, base, err := doPortal("", func(base string) (*http.Request, error) {
+			u, err := getUrl(base, "/"+pathPrefix+"job")
+			if err != nil {
+				return nil, err
+			}
+
+			q := u.Query()
+			q.Set("hostname", hostname)
+			u.RawQuery = q.Encode()
+			return http.NewRequest("GET", u.String(), nil)
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -89,25 +240,10 @@ func runWorkerMode(tempDir, portalUrl string) {
 		if err != nil {
 			return nil, err
 		}
+		j.portal = base
 		return j, nil
 	}
 
-	getJobLoop := func() *Job {
-		for {
-			task, err := getJob()
-			if err == nil {
-				return task
-			}
-
-			log.Println(err)
-			if err == errNoJob {
-				time.Sleep(5 * time.Second)
-			} else {
-				time.Sleep(30 * time.Second)
-			}
-		}
-	}
-
 	postResult := func(job *Job, jsonPath string, logPath string, aborted bool) error {
 		body := &bytes.Buffer{}
 		writer := multipart.NewWriter(body)
@@ -126,26 +262,27 @@ func runWorkerMode(tempDir, portalUrl string) {
 
 		writer.Close()
 
-		u, err := getUrl("/" + pathPrefix + "job/result")
-		if err != nil {
-			return err
-		}
-
-		q := u.Query()
-		q.Set("job_id", fmt.Sprint(job.ID))
-		if aborted {
-			q.Set("is_aborted", "1")
-		}
-		u.RawQuery = q.Encode()
+		res, _, err := doPortal(job.portal, func(base string) (*http.Request, error) {
+			u, err := getUrl(base, "/"+pathPrefix+"job/result")
+			if err != nil {
+				return nil, err
+			}
 
-		req, err := http.NewRequest("POST", u.String(), body)
-		if err != nil {
-			return err
-		}
+			q := u.Query()
+			q.Set("job_id", fmt.Sprint(job.ID))
+			if aborted {
+				q.Set("is_aborted", "1")
+			}
+			u.RawQuery = q.Encode()
 
-		req.Header.Set("Content-Type", writer.FormDataContentType())
+			req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body.Bytes()))
+			if err != nil {
+				return nil, err
+			}
 
-		res, err := http.DefaultClient.Do(req)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			return req, nil
+		})
 		if err != nil {
 			return err
 		}
@@ -156,10 +293,114 @@ func runWorkerMode(tempDir, portalUrl string) {
 			return err
 		}
 
+		// 5xx is failed over by doPortal and spooled if no portal accepts it
 		log.Println(string(b))
 		return nil
 	}
 
+	// Returns whether the job has been canceled on the portal
+	postHeartbeat := func(job *Job, hb *jobHeartbeat) (bool, error) {
+		body, err := json.Marshal(hb)
+		if err != nil {
+			return false, err
+		}
+
+		res, _, err := doPortal(job.portal, func(base string) (*http.Request, error) {
+			u, err := getUrl(base, "/"+pathPrefix+"job/heartbeat")
+			if err != nil {
+				return nil, err
+			}
+
+			q := u.Query()
+			q.Set("job_id", fmt.Sprint(job.ID))
+			u.RawQuery = q.Encode()
+
+			req, err := http.NewRequest("POST", u.String(), bytes.NewReader(body))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			return req, nil
+		})
+		if err != nil {
+			return false, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			io.Copy(ioutil.Discard, res.Body)
+			return false, fmt.Errorf("heartbeat: %s", res.Status)
+		}
+
+		var r heartbeatResponse
+		if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+			return false, err
+		}
+		return r.Canceled, nil
+	}
+
+	heartbeatLoop := func(ctx context.Context, job *Job, progressPath string, onCancel func()) {
+		startedAt := time.Now()
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			hb := &jobHeartbeat{
+				Hostname: hostname,
+				Elapsed:  time.Since(startedAt).Seconds(),
+				Phase:    "starting",
+			}
+			if ev := readLastProgress(progressPath); ev != nil {
+				hb.Phase = "running"
+				hb.Score = ev.Score
+				hb.LoadLevel = ev.LoadLevel
+				hb.NumErrors = ev.NumErrors
+				hb.LastError = ev.LastError
+			}
+			canceled, err := postHeartbeat(job, hb)
+			if err != nil {
+				log.Println("warn: failed to post heartbeat", err)
+				continue
+			}
+			if canceled {
+				log.Println("Job", job.ID, "was canceled on the portal")
+				onCancel()
+				return
+			}
+		}
+	}
+
+	getJobLoop := func() *Job {
+		failures := 0
+		for {
+			resendSpooledResults(tempDir, postResult)
+
+			task, err := getJob()
+			if err == nil {
+				return task
+			}
+
+			log.Println(err)
+			if err == errNoJob {
+				failures = 0
+				time.Sleep(5 * time.Second)
+			} else {
+				failures++
+				if failures >= maxPortalFailures {
+					log.Println("Portal is unreachable", portals)
+					os.Exit(exitPortalUnreachable)
+				}
+				time.Sleep(30 * time.Second)
+			}
+		}
+	}
+
 	for {
 		job := getJobLoop()
 		name := fmt.Sprintf("isucon8q-benchresult-%d-%d.json", time.Now().Unix(), job.ID)
@@ -170,6 +411,7 @@ func runWorkerMode(tempDir, portalUrl string) {
 		args = append(args, fmt.Sprintf("-jobid=%d", job.ID))
 		args = append(args, fmt.Sprintf("-remotes=%s", job.TargetIP))
 		args = append(args, fmt.Sprintf("-output=%s", output))
+		args = append(args, fmt.Sprintf("-progress=%s", output+".progress"))
 
 		ctx, cancel := context.WithCancel(context.Background())
 		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
@@ -217,10 +459,19 @@ func runWorkerMode(tempDir, portalUrl string) {
 					return err
 				}
 				logbuf.WriteString(str)
-				log.Print(str)
+				// already formatted by the benchmarker
+				os.Stderr.WriteString(str)
 			}
 		}
 
+		heartbeatCtx, heartbeatCancel := context.WithCancel(ctx)
+		go heartbeatLoop(heartbeatCtx, job, output+".progress", func() {
+			// The benchmarker aborts on SIGINT and still writes the partial result to output
+			if err := cmd.Process.Signal(os.Interrupt); err != nil {
+				log.Println(err)
+			}
+		})
+
 		var wg sync.WaitGroup
 
 		wg.Add(3)
@@ -250,7 +501,9 @@ func runWorkerMode(tempDir, portalUrl string) {
 
 		wg.Wait()
 		tm.Stop()
+		heartbeatCancel()
 		cancel()
+		os.Remove(output + ".progress")
 
 		_, err = os.Stat(output)
 		aborted := err != nil
@@ -270,10 +523,10 @@ func runWorkerMode(tempDir, portalUrl string) {
 			log.Println(err)
 		}
 
-		// TODO:POST失敗した時のこと考える
 		err = postResult(job, output, output+".log", aborted)
 		if err != nil {
 			log.Println(err)
+			spoolResult(job, output, output+".log", aborted)
 		}
 
 		time.Sleep(time.Second)
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"bench"
+)
+
+var (
+	maxWorkers    int
+	numWorkers    int64
+	workerCapLogs int32
+)
+
+// Reserves up to n load workers within the -max-workers budget and returns how many were granted.
+// Granted workers must be released by releaseWorker.
+func acquireWorkers(n int) int {
+	if maxWorkers <= 0 {
+		atomic.AddInt64(&numWorkers, int64(n))
+		return n
+	}
+
+	for {
+		cur := atomic.LoadInt64(&numWorkers)
+		granted := int64(maxWorkers) - cur
+		if granted > int64(n) {
+			granted = int64(n)
+		}
+		if granted < 0 {
+			granted = 0
+		}
+		if atomic.CompareAndSwapInt64(&numWorkers, cur, cur+granted) {
+			if granted < int64(n) {
+				logWorkerCapHit(n, int(granted))
+			}
+			return int(granted)
+		}
+	}
+}
+
+func releaseWorker() {
+	atomic.AddInt64(&numWorkers, -1)
+}
+
+func logWorkerCapHit(requested, granted int) {
+	// Only the first hit is reported as a warning not to flood the logs
+	if !atomic.CompareAndSwapInt32(&workerCapLogs, 0, 1) {
+		log.Printf("debug: max-workers(%d) reached. requested:%d granted:%d\n", maxWorkers, requested, granted)
+		return
+	}
+
+	log.Printf("warn: max-workers(%d) reached. requested:%d granted:%d\n", maxWorkers, requested, granted)
+	appendLoadLog(bench.Msgf("%v 負荷走行の並列数が上限(%d)に達しました。", time.Now().Format("01/02 15:04:05"), maxWorkers))
+}
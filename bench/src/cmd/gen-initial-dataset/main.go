@@ -6,9 +6,12 @@ import (
 )
 
 var dataPath = flag.String("data", "./data", "path to data directory")
+var usersPath = flag.String("users", "", "CSV of login_name,password,nickname replacing the initial users (same as -users of bench)")
 
 func main() {
+	flag.Parse()
 	bench.DataPath = *dataPath
+	bench.UsersPath = *usersPath
 	bench.PrepareDataSet()
 	bench.GenerateInitialDataSetSQL("../db/isucon8q-initial-dataset.sql.gz")
 }
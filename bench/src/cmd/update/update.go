@@ -4,6 +4,7 @@ import (
 	"bench"
 	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -67,23 +68,25 @@ type TemplateArg struct {
 }
 
 type StaticFile struct {
-	Path string
-	Size int64
-	Hash string
+	Path   string
+	Size   int64
+	Hash   string
+	SHA256 string
 }
 
 const staticFileTemplate = `
 package bench
 
 type StaticFile struct {
-	Path string
-	Size int64
-	Hash string
+	Path   string
+	Size   int64
+	Hash   string // MD5
+	SHA256 string
 }
 
 var (
 	StaticFiles = []*StaticFile {
-{{ range .StaticFiles }} &StaticFile { "{{ .Path }}", {{ .Size }}, "{{ .Hash }}" },
+{{ range .StaticFiles }} &StaticFile { "{{ .Path }}", {{ .Size }}, "{{ .Hash }}", "{{ .SHA256 }}" },
 {{ end }}
 	}
 
@@ -113,15 +116,15 @@ func prepareStaticFiles() []*StaticFile {
 		defer f.Close()
 
 		h := md5.New()
-		_, err = io.Copy(h, f)
+		h256 := sha256.New()
+		_, err = io.Copy(io.MultiWriter(h, h256), f)
 		must(err)
 
-		hash := hex.EncodeToString(h.Sum(nil))
-
 		ret = append(ret, &StaticFile{
-			Path: subPath,
-			Size: info.Size(),
-			Hash: hash,
+			Path:   subPath,
+			Size:   info.Size(),
+			Hash:   hex.EncodeToString(h.Sum(nil)),
+			SHA256: hex.EncodeToString(h256.Sum(nil)),
 		})
 
 		return nil
@@ -5,6 +5,9 @@ my $database  = $ENV{ISUCON8_DATABASE}  || 'isucon8_portal';
 my $start_at  = $ENV{ISUCON8_START_AT}  || '2018-09-15T10:00:00+09:00';
 my $finish_at = $ENV{ISUCON8_FINISH_AT} || '2018-09-15T18:00:00+09:00';
 
+# ベンチマーカーの -portal-token と合わせる (未設定なら認証しない)
+my $bench_token = $ENV{ISUCON8_BENCH_TOKEN};
+
 # 9/15
 # my $manual_url  = 'https://gist.github.com/rkmathi/04d02d5fd95ddcf2a9d59ae2b5d79432';
 # my $discord_url = 'https://discordapp.com/channels/484181541476368393/489669006387838976';
@@ -28,6 +31,7 @@ my $discord_url = 'https://discordapp.com/channels/484182004989034496/4841820049
             mysql_enable_utf8mb4 => 1,
         },
     },
+    bench_token => $bench_token,
     contest_period => {
         start_at  => Time::Moment->from_string($start_at)->epoch,
         finish_at => Time::Moment->from_string($finish_at)->epoch,
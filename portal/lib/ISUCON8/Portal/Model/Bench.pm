@@ -88,6 +88,48 @@ sub enqueue_job {
     return $is_success, $err;
 }
 
+sub cancel_job {
+    my ($self, $params) = @_;
+    my $team_id = $params->{team_id};
+
+    my $is_success = 0;
+    my $err        = undef;
+    eval {
+        $self->db->txn(sub {
+            my $dbh = shift;
+            # 実行中のジョブはここで canceled にしておき、ワーカーがハートビートの応答で気付いて中断する
+            my ($stmt, @bind) = $self->sql->update(
+                'bench_queues',
+                {
+                    state      => JOB_QUEUE_STATE_CANCELED,
+                    updated_at => \'UNIX_TIMESTAMP()',
+                },
+                {
+                    team_id => $team_id,
+                    state   => [ JOB_QUEUE_STATE_WAITING, JOB_QUEUE_STATE_RUNNING ],
+                },
+            );
+            my $rv = $dbh->do($stmt, undef, @bind);
+            if ($rv == 0) {
+                $err = 'Benchmark Job does not exist!';
+                return;
+            }
+
+            $is_success = 1;
+        });
+    };
+    if (my $e = $@) {
+        $e->rethrow if ref $e eq 'ISUCON8::Portal::Exception';
+        ISUCON8::Portal::Exception->throw(
+            code    => ERROR_INTERNAL_ERROR,
+            message => "$e",
+            logger  => sub { $self->log->critf(@_) },
+        );
+    }
+
+    return $is_success, $err;
+}
+
 sub dequeue_job {
     my ($self, $params) = @_;
     my $hostname = $params->{hostname};
@@ -160,13 +202,13 @@ sub done_job {
             my $dbh = shift;
             my ($stmt, @bind) = $self->sql->select(
                 'bench_queues',
-                ['team_id'],
+                ['team_id', 'state'],
                 {
                     id    => $job_id,
-                    state => JOB_QUEUE_STATE_RUNNING,
+                    state => [ JOB_QUEUE_STATE_RUNNING, JOB_QUEUE_STATE_CANCELED ],
                 },
             );
-            my ($team_id) = $dbh->selectrow_array($stmt, undef, @bind);
+            my ($team_id, $state) = $dbh->selectrow_array($stmt, undef, @bind);
             unless ($team_id) {
                 ISUCON8::Portal::Exception->throw(
                     code    => ERROR_CONFLICT,
@@ -175,6 +217,25 @@ sub done_job {
                 );
             }
 
+            # キャンセルされたジョブは途中までの結果だけ残してスコアには反映しない
+            if ($state eq JOB_QUEUE_STATE_CANCELED) {
+                ($stmt, @bind) = $self->sql->update(
+                    'bench_queues',
+                    {
+                        result_score  => $result_json->{score},
+                        result_status => JOB_RESULT_FAIL,
+                        result_json   => $self->json->encode($result_json),
+                        log_text      => $log,
+                        updated_at    => \'UNIX_TIMESTAMP()',
+                    },
+                    {
+                        id => $job_id,
+                    },
+                );
+                $dbh->do($stmt, undef, @bind);
+                return;
+            }
+
             ($stmt, @bind) = $self->sql->update(
                 'bench_queues',
                 {
@@ -264,6 +325,20 @@ sub abort_job {
                 },
             );
             $dbh->do($stmt, undef, @bind);
+
+            ($stmt, @bind) = $self->sql->update(
+                'bench_queues',
+                {
+                    updated_at  => \'UNIX_TIMESTAMP()',
+                    result_json => $self->json->encode($result_json),
+                    log_text    => $log,
+                },
+                {
+                    id    => $job_id,
+                    state => JOB_QUEUE_STATE_CANCELED,
+                },
+            );
+            $dbh->do($stmt, undef, @bind);
         });
     };
     if (my $e = $@) {
@@ -278,6 +353,59 @@ sub abort_job {
     return;
 }
 
+sub heartbeat_job {
+    my ($self, $job_id, $progress) = @_;
+
+    # 実行中のジョブの進捗を result_json に入れておき、終了時に結果で上書きされる
+    my $result_json = {
+        message  => sprintf(
+            '実行中 (%s, 経過 %d秒, 負荷レベル %d, エラー %d件)',
+            $progress->{phase} // 'unknown', $progress->{elapsed} // 0,
+            $progress->{load_level} // 0, $progress->{num_errors} // 0,
+        ),
+        progress => $progress,
+    };
+
+    my $is_canceled = 0;
+    eval {
+        $self->db->txn(sub {
+            my $dbh = shift;
+            my ($stmt, @bind) = $self->sql->update(
+                'bench_queues',
+                {
+                    updated_at  => \'UNIX_TIMESTAMP()',
+                    result_json => $self->json->encode($result_json),
+                },
+                {
+                    id    => $job_id,
+                    state => JOB_QUEUE_STATE_RUNNING,
+                },
+            );
+            $dbh->do($stmt, undef, @bind);
+
+            ($stmt, @bind) = $self->sql->select(
+                'bench_queues',
+                ['state'],
+                {
+                    id => $job_id,
+                },
+            );
+            my ($state) = $dbh->selectrow_array($stmt, undef, @bind);
+            $is_canceled = ($state // '') eq JOB_QUEUE_STATE_CANCELED ? 1 : 0;
+        });
+    };
+    if (my $e = $@) {
+        $e->rethrow if ref $e eq 'ISUCON8::Portal::Exception';
+        ISUCON8::Portal::Exception->throw(
+            code    => ERROR_INTERNAL_ERROR,
+            message => "$e",
+            logger  => sub { $self->log->critf(@_) },
+        );
+    }
+
+    return $is_canceled;
+}
+
 sub abort_timeout_job {
     my ($self) = @_;
     my $result_json = { reason => 'Benchmark timeout' };
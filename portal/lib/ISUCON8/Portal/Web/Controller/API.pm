@@ -29,6 +29,22 @@ sub enqueue_job {
     }
 }
 
+sub cancel_job {
+    my ($self, $c) = @_;
+    my $team_id = $c->team_id;
+
+    my ($is_success, $err) = $c->model('Bench')->cancel_job({
+        team_id => $team_id,
+    });
+
+    if ($is_success) {
+        return $c->render_json({ success => JSON::true });
+    }
+    else {
+        return $c->render_json({ success => JSON::false, error => $err });
+    }
+}
+
 sub change_target {
     my ($self, $c) = @_;
     state $rule = $c->make_validator(
@@ -87,4 +87,36 @@ sub post_job_result {
     return $c->render_json({ success => JSON::true });
 }
 
+sub post_job_heartbeat {
+    my ($self, $c) = @_;
+    state $rule = $c->make_validator(
+        job_id => { isa => 'Str' },
+    );
+
+    my $params = $c->validate($rule, $c->req->query_parameters->mixed);
+    unless ($params) {
+        return $c->create_response(
+            HTTP_BAD_REQUEST,
+            ['Content-Type', 'text/plain'],
+            ['Invalid Params'],
+        );
+    }
+
+    my $progress = eval { $c->json->decode($c->req->content) };
+    if (my $e = $@) {
+        return $c->create_response(
+            HTTP_BAD_REQUEST,
+            ['Content-Type', 'text/plain'],
+            ['Invalid progress json'],
+        );
+    }
+
+    my $is_canceled = $c->model('Bench')->heartbeat_job($params->{job_id}, $progress);
+
+    return $c->render_json({
+        success  => JSON::true,
+        canceled => $is_canceled ? JSON::true : JSON::false,
+    });
+}
+
 1;
@@ -44,8 +44,9 @@ post '/admin/enqueue'     => 'Admin#post_enqueue';
 get  '/admin/enqueue_all' => 'Admin#get_enqueue_all';
 post '/admin/enqueue_all' => 'Admin#post_enqueue_all';
 
-get  '/bench/job'        => 'Bench#get_job';
-post '/bench/job/result' => 'Bench#post_job_result';
+get  '/bench/job'           => 'Bench#get_job';
+post '/bench/job/result'    => 'Bench#post_job_result';
+post '/bench/job/heartbeat' => 'Bench#post_job_heartbeat';
 
 sub handle_exception {
     my ($class, $c, $e) = @_;
@@ -17,8 +17,20 @@ sub init {
             my $path   = $c->req->path;
             my $method = $c->req->method;
 
-            # benchmaker は session 不要
+            # benchmaker は session 不要だが、bench_token が設定されていれば Bearer で認証する
             if ($path =~ m|^/bench|) {
+                my $bench_token = $c->config->{bench_token};
+                return unless $bench_token;
+
+                my ($token) = ($c->req->header('Authorization') // '') =~ m|^Bearer\s+(\S+)$|;
+                unless (defined $token && $token eq $bench_token) {
+                    $c->log->warnf('Invalid bench token (path: %s)', $path);
+                    return $c->create_response(
+                        401,
+                        ['Content-Type', 'text/plain', 'WWW-Authenticate', 'Bearer'],
+                        ['Unauthorized'],
+                    );
+                }
                 return;
             }
 